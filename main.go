@@ -1,10 +1,102 @@
 package main
 
 import (
+	"comrade-pavlik2/pkg/bundle"
 	"comrade-pavlik2/pkg/server"
+	"context"
+	"flag"
+	"fmt"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		}
+	}
+
 	m := server.NewServer()
 	m.Run()
 }
+
+// write bundle of package versions served by GitLab, e.g.
+// pavlik export -o bundle.tar.gz composer:acme/auth@1.2.0 npm:@acme/ui
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "pavlik-bundle.tar.gz", "bundle file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: pavlik export [-o bundle.tar.gz] kind:name[@version] ...")
+		return 2
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+
+	manifest, err := server.ExportBundle(context.Background(), f, flags.Args())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(*output)
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+
+	for _, p := range manifest.Packages {
+		fmt.Printf("==> Exported %s %s: %d versions\n", p.Kind, p.Name, len(p.Versions))
+	}
+
+	fmt.Println("==> Bundle:", *output)
+	return 0
+}
+
+// import bundles into PAVLIK_BUNDLE_DIR, served after restart
+func runImport(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: pavlik import bundle.tar.gz ...")
+		return 2
+	}
+
+	store, err := bundle.NewStore(os.Getenv("PAVLIK_BUNDLE_DIR"))
+	if err == nil && store == nil {
+		err = fmt.Errorf("PAVLIK_BUNDLE_DIR is not set")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		return 1
+	}
+
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			return 1
+		}
+
+		manifest, err := store.Import(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s: %s\n", name, err)
+			return 1
+		}
+
+		for _, p := range manifest.Packages {
+			fmt.Printf("==> Imported %s %s: %d versions\n", p.Kind, p.Name, len(p.Versions))
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,284 @@
+package audit
+
+// Append-only log of package downloads and metadata access
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type (
+	// Entry - single access record, stored as json line
+	Entry struct {
+		Time      time.Time `json:"time"`
+		User      string    `json:"user"`
+		Kind      string    `json:"kind"`
+		Package   string    `json:"package"`
+		UUID      string    `json:"uuid,omitempty"`
+		Version   string    `json:"version,omitempty"`
+		Route     string    `json:"route"`
+		IP        string    `json:"ip"`
+		UserAgent string    `json:"user_agent"`
+		Status    int       `json:"status"`
+	}
+
+	// Filter - query parameters, empty fields match any entry
+	Filter struct {
+		User    string
+		Kind    string
+		Package string
+		Limit   int
+	}
+
+	// Logger - audit log rotated by size, rotated files are
+	// numbered audit.log.1 (newest) to audit.log.N (oldest)
+	Logger struct {
+		path     string
+		maxSize  int64
+		maxFiles int
+		lock     *sync.Mutex
+		file     *os.File
+		size     int64
+	}
+)
+
+var (
+	logFile = "audit.log"
+
+	// fields provided by client (user agent, requested name) are truncated,
+	// so single request can't produce a line too long to be read back
+	maxFieldLength = 1024
+	maxLineLength  = 64 * 1024
+)
+
+// NewLogger - open audit log in directory, logger is disabled (nil)
+// when directory is not provided.
+func NewLogger(dir string, maxSize int64, maxFiles int) (*Logger, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		path:     filepath.Join(dir, logFile),
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		lock:     new(sync.Mutex),
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Write - append entry to log, log is rotated when it grows over max size
+func (l *Logger) Write(e *Entry) error {
+	entry := *e
+	entry.Package = truncateField(entry.Package)
+	entry.UserAgent = truncateField(entry.UserAgent)
+
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+// Query - find entries matching filter, newest first,
+// current log and all rotated files are scanned.
+func (l *Logger) Query(f Filter) ([]Entry, error) {
+	fileList, err := l.openFileList()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range fileList {
+			file.Close()
+		}
+	}()
+
+	list := make([]Entry, 0)
+	for _, file := range fileList {
+		entryList, err := readLogFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// entries are appended, so file is read backwards
+		for j := len(entryList) - 1; j >= 0; j-- {
+			if !f.matches(&entryList[j]) {
+				continue
+			}
+
+			list = append(list, entryList[j])
+			if f.Limit > 0 && len(list) >= f.Limit {
+				return list, nil
+			}
+		}
+	}
+
+	return list, nil
+}
+
+//
+// Private API
+//
+
+// open current log for appending
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// shift rotated files, oldest one is removed, and start new log
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(l.getFilePath(l.maxFiles))
+	for i := l.maxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(l.getFilePath(i), l.getFilePath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return l.open()
+}
+
+// Open current log and all rotated files, newest first. Files are opened
+// while log is locked, so rotation can't shift them in between, and read
+// after lock is released: writes are never blocked by slow query, and open
+// file is still readable after it's renamed or removed by rotation.
+func (l *Logger) openFileList() ([]*os.File, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	fileList := make([]*os.File, 0)
+	for i := 0; i <= l.maxFiles; i++ {
+		file, err := os.Open(l.getFilePath(i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			for _, file := range fileList {
+				file.Close()
+			}
+			return nil, err
+		}
+
+		fileList = append(fileList, file)
+	}
+
+	return fileList, nil
+}
+
+// 0 is current log
+func (l *Logger) getFilePath(index int) string {
+	if index == 0 {
+		return l.path
+	}
+
+	return fmt.Sprintf("%s.%d", l.path, index)
+}
+
+// package is matched by substring of name or uuid
+func (f Filter) matches(e *Entry) bool {
+	if f.User != "" && !strings.EqualFold(f.User, e.User) {
+		return false
+	}
+
+	if f.Kind != "" && f.Kind != e.Kind {
+		return false
+	}
+
+	return f.Package == "" || strings.Contains(e.Package, f.Package) || strings.Contains(e.UUID, f.Package)
+}
+
+// keep at most maxFieldLength bytes, cut at rune boundary
+func truncateField(value string) string {
+	if len(value) <= maxFieldLength {
+		return value
+	}
+
+	end := maxFieldLength
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+
+	return value[:end]
+}
+
+// read all entries from file, malformed lines (e.g. after crash)
+// and lines longer than maxLineLength are skipped
+func readLogFile(file *os.File) ([]Entry, error) {
+	list := make([]Entry, 0)
+
+	reader := bufio.NewReaderSize(file, maxLineLength)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// drop the rest of too long line
+			for err == bufio.ErrBufferFull {
+				_, err = reader.ReadSlice('\n')
+			}
+			if err == io.EOF {
+				return list, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		e := Entry{}
+		if len(line) > 0 && json.Unmarshal(line, &e) == nil {
+			list = append(list, e)
+		}
+
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
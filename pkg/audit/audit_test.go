@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogger_Disabled(t *testing.T) {
+	l, err := NewLogger("", 1024, 1)
+
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+}
+
+func TestLogger_Query(t *testing.T) {
+	dir := createTestLogDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLogger(dir, 1024*1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, l.Write(&Entry{Time: time.Now(), User: "john_smith", Kind: "npm", Package: "@acme/auth", Version: "v1.0.0", Status: 200}))
+	assert.Nil(t, l.Write(&Entry{Time: time.Now(), User: "jane", Kind: "composer", Package: "acme/billing", Status: 403}))
+	assert.Nil(t, l.Write(&Entry{Time: time.Now(), User: "john_smith", Kind: "npm", Package: "@acme/billing", Status: 200}))
+
+	list, err := l.Query(Filter{User: "John_Smith"})
+	assert.Nil(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "@acme/billing", list[0].Package)
+	assert.Equal(t, "@acme/auth", list[1].Package)
+
+	list, err = l.Query(Filter{Package: "billing", Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "npm", list[0].Kind)
+
+	list, err = l.Query(Filter{Kind: "composer"})
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, 403, list[0].Status)
+}
+
+func TestLogger_Rotate(t *testing.T) {
+	dir := createTestLogDir(t)
+	defer os.RemoveAll(dir)
+
+	// every entry is larger than max size, so each write rotates log
+	l, err := NewLogger(dir, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"v1", "v2", "v3", "v4"} {
+		assert.Nil(t, l.Write(&Entry{Package: "acme/auth", Version: version}))
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "audit.log.2"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "audit.log.3"))
+	assert.True(t, os.IsNotExist(err))
+
+	// oldest entry is dropped
+	list, err := l.Query(Filter{})
+	assert.Nil(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, "v4", list[0].Version)
+	assert.Equal(t, "v2", list[2].Version)
+
+	// log is appended after restart
+	l, err = NewLogger(dir, 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, l.Write(&Entry{Package: "acme/auth", Version: "v5"}))
+	list, err = l.Query(Filter{})
+	assert.Nil(t, err)
+	assert.Len(t, list, 4)
+}
+
+func TestLogger_Query_UUID(t *testing.T) {
+	dir := createTestLogDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLogger(dir, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, l.Write(&Entry{Kind: "npm", Package: "@acme/auth", UUID: "d4b5f0f4-auth", Version: "v1.0.0"}))
+	assert.Nil(t, l.Write(&Entry{Kind: "npm", Package: "@acme/billing", UUID: "8f2c41aa-billing"}))
+
+	// package is found by name and by uuid
+	for _, query := range []string{"acme/auth", "d4b5f0f4"} {
+		list, err := l.Query(Filter{Package: query})
+		assert.Nil(t, err)
+		if assert.Len(t, list, 1, query) {
+			assert.Equal(t, "@acme/auth", list[0].Package)
+			assert.Equal(t, "d4b5f0f4-auth", list[0].UUID)
+		}
+	}
+}
+
+func TestLogger_LongLine(t *testing.T) {
+	dir := createTestLogDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLogger(dir, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	longValue := strings.Repeat("x", 100*1024)
+
+	// fields provided by client are truncated on write
+	assert.Nil(t, l.Write(&Entry{Package: "acme/auth", Version: "v1", UserAgent: longValue}))
+
+	// line written before truncation was introduced is skipped
+	line := []byte(`{"package":"acme/auth","version":"v2","user_agent":"` + longValue + `"}` + "\n")
+	if _, err := l.file.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	l.size += int64(len(line))
+
+	assert.Nil(t, l.Write(&Entry{Package: "acme/auth", Version: "v3"}))
+
+	list, err := l.Query(Filter{})
+	assert.Nil(t, err)
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, "v3", list[0].Version)
+		assert.Equal(t, "v1", list[1].Version)
+		assert.Len(t, list[1].UserAgent, maxFieldLength)
+	}
+}
+
+func TestTruncateField(t *testing.T) {
+	assert.Equal(t, "npm/5.6.0", truncateField("npm/5.6.0"))
+	assert.Len(t, truncateField(strings.Repeat("a", maxFieldLength+1)), maxFieldLength)
+
+	// multi-byte rune on the boundary is dropped as a whole
+	value := strings.Repeat("a", maxFieldLength-1) + "é"
+	assert.Equal(t, strings.Repeat("a", maxFieldLength-1), truncateField(value))
+}
+
+func createTestLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pavlik-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
@@ -0,0 +1,241 @@
+package bundle
+
+// Offline bundles: artifacts of selected composer and npm package versions
+// with metadata generated by registries, served without GitLab.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+type (
+	// Manifest - contents of bundle, or of all bundles imported into directory
+	Manifest struct {
+		Created  time.Time  `json:"created"`
+		Packages []*Package `json:"packages"`
+	}
+
+	// Package - exported package, metadata is generated with BaseURL as download endpoint
+	Package struct {
+		Kind     string    `json:"kind"`
+		Name     string    `json:"name"`
+		UUID     string    `json:"uuid"`
+		Metadata string    `json:"metadata"` // path of metadata file in bundle
+		Versions []Version `json:"versions"`
+	}
+
+	// Version - exported version and its artifact
+	Version struct {
+		Version string `json:"version"`
+		File    string `json:"file"` // path of artifact in bundle, the same as download url path
+		SHA256  string `json:"sha256"`
+	}
+
+	// Request - package and versions to export, all versions when list is empty
+	Request struct {
+		Kind        string
+		Name        string
+		VersionList []string
+	}
+)
+
+var (
+	// BaseURL - endpoint of download urls in exported metadata, replaced with public host when served
+	BaseURL = "http://pavlik.bundle"
+
+	// KindComposer - composer packages, metadata is map of versions
+	KindComposer = "composer"
+
+	// KindNpm - npm packages, metadata is npm package document
+	KindNpm = "npm"
+
+	// ErrInvalidBundle - bundle is malformed or doesn't match its manifest
+	ErrInvalidBundle = errors.New("Invalid bundle")
+
+	// ErrUnsupportedKind - only composer and npm packages are exported
+	ErrUnsupportedKind = errors.New("Only composer and npm packages are supported")
+
+	// ErrPackageNotFound - package is not exported or imported
+	ErrPackageNotFound = errors.New("Package not found")
+
+	// ErrVersionNotFound - package has no such version
+	ErrVersionNotFound = errors.New("Version not found")
+
+	// ErrArtifactConflict - imported artifact differs from artifact imported earlier
+	ErrArtifactConflict = errors.New("Artifact differs from imported one")
+
+	manifestFile = "manifest.json"
+)
+
+// ParseRequestList - parse "kind:name[@version]" list, versions of the same package are merged,
+// e.g. "composer:acme/auth@1.2.0", "npm:@acme/ui@2.0.1" or "npm:@acme/ui" for all versions.
+func ParseRequestList(specList []string) ([]*Request, error) {
+	requestList := make([]*Request, 0)
+	requestMap := make(map[string]*Request)
+
+	for _, spec := range specList {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid package %q, kind:name[@version] expected", spec)
+		}
+
+		kind, name, version := parts[0], parts[1], ""
+		if kind != KindComposer && kind != KindNpm {
+			return nil, fmt.Errorf("%s: %s", spec, ErrUnsupportedKind)
+		}
+
+		// npm scope starts with "@"
+		if pos := strings.LastIndex(name, "@"); pos > 0 {
+			name, version = name[:pos], name[pos+1:]
+		}
+
+		key := kind + ":" + name
+		req, ok := requestMap[key]
+		if !ok {
+			req = &Request{Kind: kind, Name: name, VersionList: make([]string, 0)}
+			requestMap[key] = req
+			requestList = append(requestList, req)
+		}
+
+		if version != "" {
+			req.VersionList = append(req.VersionList, version)
+		}
+	}
+
+	return requestList, nil
+}
+
+// ParseArtifactFile - get package uuid and commit from artifact path,
+// e.g. "composer/<uuid>/<ref>.zip" or "npm/<uuid>/<ref>.tgz"
+func ParseArtifactFile(file string) (string, string, string, error) {
+	parts := strings.Split(file, "/")
+	if len(parts) != 3 || parts[1] == "" {
+		return "", "", "", ErrInvalidBundle
+	}
+
+	ext := ""
+	switch parts[0] {
+	case KindComposer:
+		ext = ".zip"
+	case KindNpm:
+		ext = ".tgz"
+	default:
+		return "", "", "", ErrInvalidBundle
+	}
+
+	if !strings.HasSuffix(parts[2], ext) || len(parts[2]) == len(ext) {
+		return "", "", "", ErrInvalidBundle
+	}
+
+	return parts[0], parts[1], strings.TrimSuffix(parts[2], ext), nil
+}
+
+//
+// Private API
+//
+
+// path of metadata file in bundle
+func getMetadataFile(kind, name string) string {
+	return path.Join("metadata", kind, url.PathEscape(name)+".json")
+}
+
+// versions of package metadata: composer metadata is map of versions,
+// npm metadata is package document with "versions" map
+func getVersionMap(kind string, metadata map[string]interface{}) map[string]interface{} {
+	if kind == KindComposer {
+		return metadata
+	}
+
+	versionMap, _ := metadata["versions"].(map[string]interface{})
+	if versionMap == nil {
+		versionMap = make(map[string]interface{})
+		metadata["versions"] = versionMap
+	}
+
+	return versionMap
+}
+
+// download url of version, relative to BaseURL
+func getArtifactFile(kind string, version interface{}) (string, error) {
+	versionData, _ := version.(map[string]interface{})
+	dist, _ := versionData["dist"].(map[string]interface{})
+
+	field := "url"
+	if kind == KindNpm {
+		field = "tarball"
+	}
+
+	downloadURL, _ := dist[field].(string)
+	if !strings.HasPrefix(downloadURL, BaseURL+"/") {
+		return "", ErrInvalidBundle
+	}
+
+	file := strings.TrimPrefix(downloadURL, BaseURL+"/")
+	if _, _, _, err := ParseArtifactFile(file); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
+
+// npm shasum of version
+func getNpmShasum(version interface{}) string {
+	versionData, _ := version.(map[string]interface{})
+	dist, _ := versionData["dist"].(map[string]interface{})
+	shasum, _ := dist["shasum"].(string)
+	return shasum
+}
+
+// tags pointing to dropped versions are removed, "latest" is the highest version left
+func fixNpmDistTags(metadata map[string]interface{}) {
+	versionMap := getVersionMap(KindNpm, metadata)
+
+	distTags, _ := metadata["dist-tags"].(map[string]interface{})
+	if distTags == nil {
+		distTags = make(map[string]interface{})
+		metadata["dist-tags"] = distTags
+	}
+
+	for tag, version := range distTags {
+		if v, ok := version.(string); !ok || versionMap[v] == nil {
+			delete(distTags, tag)
+		}
+	}
+
+	var latest *semver.Version
+	for v := range versionMap {
+		parsed, err := semver.Make(v)
+		if err != nil {
+			continue
+		}
+
+		if latest == nil || parsed.GT(*latest) {
+			latest = &parsed
+		}
+	}
+
+	if latest != nil {
+		distTags["latest"] = latest.String()
+	}
+}
+
+// version requested matches version with or without "v" prefix
+func isVersionMatched(version, requested string) bool {
+	return strings.TrimPrefix(version, "v") == strings.TrimPrefix(requested, "v")
+}
+
+// decode metadata file
+func decodeMetadata(data []byte) (map[string]interface{}, error) {
+	metadata := make(map[string]interface{})
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, ErrInvalidBundle
+	}
+
+	return metadata, nil
+}
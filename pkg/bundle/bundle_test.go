@@ -0,0 +1,226 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRequestList(t *testing.T) {
+	list, err := ParseRequestList([]string{
+		"composer:acme/auth@1.2.0",
+		"npm:@acme/ui",
+		"composer:acme/auth@v1.3.0",
+		"npm:@acme/ui@2.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, list, 2)
+	assert.Equal(t, &Request{Kind: "composer", Name: "acme/auth", VersionList: []string{"1.2.0", "v1.3.0"}}, list[0])
+	assert.Equal(t, &Request{Kind: "npm", Name: "@acme/ui", VersionList: []string{"2.0.1"}}, list[1])
+
+	_, err = ParseRequestList([]string{"helm:acme-api"})
+	assert.NotNil(t, err)
+
+	_, err = ParseRequestList([]string{"acme/auth"})
+	assert.NotNil(t, err)
+}
+
+func TestParseArtifactFile(t *testing.T) {
+	kind, uuid, ref, err := ParseArtifactFile("npm/48bfe31a/abc.tgz")
+	assert.Nil(t, err)
+	assert.Equal(t, "npm", kind)
+	assert.Equal(t, "48bfe31a", uuid)
+	assert.Equal(t, "abc", ref)
+
+	for _, file := range []string{"npm/48bfe31a/abc.zip", "helm/48bfe31a/abc.tgz", "npm/48bfe31a/.tgz", "npm/abc.tgz", "../npm/48bfe31a/abc.tgz"} {
+		_, _, _, err := ParseArtifactFile(file)
+		assert.Equal(t, ErrInvalidBundle, err, file)
+	}
+}
+
+func TestWriter_AddPackage_VersionNotFound(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+
+	_, err := w.AddPackage(&Request{Kind: KindComposer, Name: "acme/auth", VersionList: []string{"9.9.9"}}, getComposerMetadata())
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), ErrVersionNotFound.Error()))
+}
+
+func TestStore_Import(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first bundle: single composer version and npm package requested without scope
+	data := writeTestBundle(t, map[string][]byte{"abc": []byte("zip 1.2.0"), "bbb": []byte("tgz 2.0.1")},
+		&Request{Kind: KindComposer, Name: "acme/auth", VersionList: []string{"v1.2.0"}},
+		&Request{Kind: KindNpm, Name: "ui", VersionList: []string{"2.0.1"}},
+	)
+
+	imported, err := s.Import(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, imported.Packages, 2)
+	assert.Equal(t, "@acme/ui", imported.Packages[1].Name)
+
+	packages, err := s.GetComposerPackages("https://packages.example.com/", nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(packages), `"url":"https://packages.example.com/composer/48bfe31a/abc.zip"`))
+	assert.False(t, strings.Contains(string(packages), "v1.3.0"))
+
+	// second bundle adds version, artifact imported earlier is the same
+	data = writeTestBundle(t, map[string][]byte{"abc": []byte("zip 1.2.0"), "def": []byte("zip 1.3.0")},
+		&Request{Kind: KindComposer, Name: "acme/auth"},
+	)
+
+	_, err = s.Import(bytes.NewReader(data))
+	assert.Nil(t, err)
+
+	// store is loaded from directory
+	s, err = NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packages, err = s.GetComposerPackages("https://packages.example.com", nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(packages), `"url":"https://packages.example.com/composer/48bfe31a/def.zip"`))
+
+	npmPackage, err := s.GetNpmPackage("@acme/ui", "https://packages.example.com", nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(npmPackage), `"latest": "2.0.1"`))
+	assert.False(t, strings.Contains(string(npmPackage), `"1.0.0"`))
+
+	archive, err := s.GetArtifact("composer/48bfe31a/def.zip", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "zip 1.3.0", string(archive))
+
+	// package scope is checked for metadata and artifacts
+	deny := func(kind, uuid string) bool { return kind != KindNpm }
+	_, err = s.GetArtifact("npm/5c4a6e2f/bbb.tgz", deny)
+	assert.Equal(t, ErrPackageNotFound, err)
+	_, err = s.GetNpmPackage("@acme/ui", "https://packages.example.com", deny)
+	assert.Equal(t, ErrPackageNotFound, err)
+
+	_, err = s.GetArtifact("composer/48bfe31a/fff.zip", nil)
+	assert.Equal(t, ErrPackageNotFound, err)
+
+	// imported artifacts are immutable, nothing is imported on conflict
+	data = writeTestBundle(t, map[string][]byte{"abc": []byte("zip 1.2.0, rebuilt"), "def": []byte("zip 1.3.0")},
+		&Request{Kind: KindComposer, Name: "acme/auth"},
+	)
+
+	_, err = s.Import(bytes.NewReader(data))
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), ErrArtifactConflict.Error()))
+
+	archive, err = s.GetArtifact("composer/48bfe31a/abc.zip", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "zip 1.2.0", string(archive))
+}
+
+func TestStore_Import_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Import(strings.NewReader("not a bundle"))
+	assert.Equal(t, ErrInvalidBundle, err)
+
+	// artifact doesn't match manifest
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	artifactList, err := w.AddPackage(&Request{Kind: KindComposer, Name: "acme/auth", VersionList: []string{"1.2.0"}}, getComposerMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, w.AddArtifact(artifactList[0], []byte("zip 1.2.0")))
+	w.manifest.Packages[0].Versions[0].SHA256 = "broken"
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Import(buf)
+	assert.NotNil(t, err)
+	assert.Len(t, s.PackageList(), 0)
+}
+
+func TestNewStore_Disabled(t *testing.T) {
+	s, err := NewStore("")
+
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+}
+
+// write bundle of test packages, artifacts are keyed by commit
+func writeTestBundle(t *testing.T, artifactMap map[string][]byte, requestList ...*Request) []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	for _, req := range requestList {
+		metadata := getComposerMetadata()
+		if req.Kind == KindNpm {
+			metadata = getNpmMetadata(artifactMap)
+		}
+
+		artifactList, err := w.AddPackage(req, metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, a := range artifactList {
+			if err := w.AddArtifact(a, artifactMap[a.Reference]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// composer metadata of package, the way registry generates it
+func getComposerMetadata() []byte {
+	return []byte(`{
+		"v1.2.0": {"name": "acme/auth", "version": "v1.2.0", "dist": {"url": "http://pavlik.bundle/composer/48bfe31a/abc.zip", "type": "zip", "reference": "abc"}},
+		"v1.3.0": {"name": "acme/auth", "version": "v1.3.0", "dist": {"url": "http://pavlik.bundle/composer/48bfe31a/def.zip", "type": "zip", "reference": "def"}}
+	}`)
+}
+
+// npm metadata of package, the way registry generates it
+func getNpmMetadata(artifactMap map[string][]byte) []byte {
+	return []byte(fmt.Sprintf(`{
+		"name": "@acme/ui",
+		"dist-tags": {"latest": "2.0.1", "next": "1.0.0"},
+		"versions": {
+			"1.0.0": {"name": "@acme/ui", "version": "1.0.0", "dist": {"shasum": "%x", "tarball": "http://pavlik.bundle/npm/5c4a6e2f/aaa.tgz"}},
+			"2.0.1": {"name": "@acme/ui", "version": "2.0.1", "dist": {"shasum": "%x", "tarball": "http://pavlik.bundle/npm/5c4a6e2f/bbb.tgz"}}
+		}
+	}`, sha1.Sum(artifactMap["aaa"]), sha1.Sum(artifactMap["bbb"])))
+}
@@ -0,0 +1,446 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// AccessFunc - check package of kind is allowed, everything is allowed when nil
+	AccessFunc func(kind, uuid string) bool
+
+	// Store - bundles imported into directory, served read-only
+	Store struct {
+		dir      string
+		lock     *sync.RWMutex
+		manifest *Manifest
+	}
+)
+
+// NewStore - load bundles imported into directory,
+// store is disabled (nil) when directory is not provided.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:  dir,
+		lock: new(sync.RWMutex),
+		manifest: &Manifest{
+			Packages: make([]*Package, 0),
+		},
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s.manifest); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Import - verify bundle against its manifest and merge it with bundles imported earlier,
+// nothing is imported when any artifact is broken or differs from imported one.
+func (s *Store) Import(r io.Reader) (*Manifest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	staging, err := ioutil.TempDir(s.dir, ".import_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractBundle(r, staging); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(staging, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, ErrInvalidBundle
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	imported := &Manifest{}
+	if err := json.Unmarshal(data, imported); err != nil {
+		return nil, ErrInvalidBundle
+	}
+
+	for _, p := range imported.Packages {
+		if err := s.verifyPackage(staging, p); err != nil {
+			return nil, fmt.Errorf("%s: %s", p.Name, err)
+		}
+	}
+
+	for _, p := range imported.Packages {
+		if err := s.mergePackage(staging, p); err != nil {
+			return nil, fmt.Errorf("%s: %s", p.Name, err)
+		}
+	}
+
+	s.manifest.Created = time.Now().UTC()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return imported, nil
+}
+
+// PackageList - get imported packages
+func (s *Store) PackageList() []Package {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	list := make([]Package, 0, len(s.manifest.Packages))
+	for _, p := range s.manifest.Packages {
+		list = append(list, *p)
+	}
+
+	return list
+}
+
+// GetComposerPackages - packages.json of allowed composer packages, download urls point to endpoint
+func (s *Store) GetComposerPackages(endpoint string, allow AccessFunc) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	packageMap := make(map[string]map[string]interface{})
+	for _, p := range s.manifest.Packages {
+		if p.Kind != KindComposer || (allow != nil && !allow(p.Kind, p.UUID)) {
+			continue
+		}
+
+		metadata, err := readMetadata(s.dir, p)
+		if err != nil {
+			return nil, err
+		}
+
+		packageMap[p.Name] = metadata
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"packages": packageMap})
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceBaseURL(data, endpoint), nil
+}
+
+// GetNpmPackage - npm package document, download urls point to endpoint,
+// for backward compatibility package is also found by name without scope.
+func (s *Store) GetNpmPackage(name, endpoint string, allow AccessFunc) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p := s.findPackage(KindNpm, name)
+	if p == nil {
+		p = s.findPackage(KindNpm, name[strings.Index(name, "/")+1:])
+	}
+
+	if p == nil || (allow != nil && !allow(p.Kind, p.UUID)) {
+		return nil, ErrPackageNotFound
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(p.Metadata)))
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceBaseURL(data, endpoint), nil
+}
+
+// GetArtifact - imported artifact by download path, e.g. "npm/<uuid>/<ref>.tgz"
+func (s *Store) GetArtifact(file string, allow AccessFunc) ([]byte, error) {
+	kind, uuid, _, err := ParseArtifactFile(file)
+	if err != nil || (allow != nil && !allow(kind, uuid)) {
+		return nil, ErrPackageNotFound
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, p := range s.manifest.Packages {
+		for _, v := range p.Versions {
+			if v.File != file {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(file)))
+			if err != nil {
+				return nil, err
+			}
+
+			if fmt.Sprintf("%x", sha256.Sum256(data)) != v.SHA256 {
+				return nil, fmt.Errorf("%s: sha256 doesn't match manifest", file)
+			}
+
+			return data, nil
+		}
+	}
+
+	return nil, ErrPackageNotFound
+}
+
+//
+// Private API
+//
+
+// check package metadata and artifacts in staging directory
+func (s *Store) verifyPackage(staging string, p *Package) error {
+	if (p.Kind != KindComposer && p.Kind != KindNpm) || p.Metadata != getMetadataFile(p.Kind, p.Name) {
+		return ErrInvalidBundle
+	}
+
+	if _, err := readMetadata(staging, p); err != nil {
+		return err
+	}
+
+	for _, v := range p.Versions {
+		kind, uuid, _, err := ParseArtifactFile(v.File)
+		if err != nil || kind != p.Kind || uuid != p.UUID {
+			return ErrInvalidBundle
+		}
+
+		sum, err := getFileSHA256(filepath.Join(staging, filepath.FromSlash(v.File)))
+		if err != nil || sum != v.SHA256 {
+			return ErrInvalidBundle
+		}
+
+		// imported artifacts are immutable
+		sum, err = getFileSHA256(filepath.Join(s.dir, filepath.FromSlash(v.File)))
+		if err == nil && sum != v.SHA256 {
+			return fmt.Errorf("%s: %s", v.File, ErrArtifactConflict)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move artifacts into store, merge versions of metadata and manifest
+func (s *Store) mergePackage(staging string, p *Package) error {
+	for _, v := range p.Versions {
+		dst := filepath.Join(s.dir, filepath.FromSlash(v.File))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(v.File)), dst); err != nil {
+			return err
+		}
+	}
+
+	metadata, err := readMetadata(staging, p)
+	if err != nil {
+		return err
+	}
+
+	existing := s.findPackage(p.Kind, p.Name)
+	if existing == nil {
+		existing = &Package{
+			Kind:     p.Kind,
+			Name:     p.Name,
+			UUID:     p.UUID,
+			Metadata: p.Metadata,
+			Versions: make([]Version, 0),
+		}
+		s.manifest.Packages = append(s.manifest.Packages, existing)
+	} else {
+		merged, err := readMetadata(s.dir, existing)
+		if err != nil {
+			return err
+		}
+
+		versionMap := getVersionMap(p.Kind, merged)
+		for version, data := range getVersionMap(p.Kind, metadata) {
+			versionMap[version] = data
+		}
+
+		metadata = merged
+	}
+
+	if p.Kind == KindNpm {
+		fixNpmDistTags(metadata)
+	}
+
+	for _, v := range p.Versions {
+		replaced := false
+		for i := range existing.Versions {
+			if existing.Versions[i].Version == v.Version {
+				existing.Versions[i] = v
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			existing.Versions = append(existing.Versions, v)
+		}
+	}
+
+	sort.Slice(existing.Versions, func(i, j int) bool {
+		return existing.Versions[i].Version < existing.Versions[j].Version
+	})
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(s.dir, filepath.FromSlash(p.Metadata)), data)
+}
+
+// find package by kind and name
+func (s *Store) findPackage(kind, name string) *Package {
+	for _, p := range s.manifest.Packages {
+		if p.Kind == kind && p.Name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// read and decode package metadata from directory
+func readMetadata(dir string, p *Package) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p.Metadata)))
+	if os.IsNotExist(err) {
+		return nil, ErrInvalidBundle
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetadata(data)
+}
+
+// write manifest of imported bundles
+func (s *Store) save() error {
+	sort.Slice(s.manifest.Packages, func(i, j int) bool {
+		if s.manifest.Packages[i].Kind != s.manifest.Packages[j].Kind {
+			return s.manifest.Packages[i].Kind < s.manifest.Packages[j].Kind
+		}
+
+		return s.manifest.Packages[i].Name < s.manifest.Packages[j].Name
+	})
+
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(s.dir, manifestFile), data)
+}
+
+// unpack regular files of bundle into directory, paths escaping directory are refused
+func extractBundle(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ErrInvalidBundle
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrInvalidBundle
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return ErrInvalidBundle
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return ErrInvalidBundle
+		}
+	}
+}
+
+// sha256 of file contents
+func getFileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// write file to temporary file and rename, file is never left half-written
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	tmpName := name + ".tmp"
+	if err := ioutil.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, name)
+}
+
+// point download urls to endpoint, urls are json strings
+func replaceBaseURL(data []byte, endpoint string) []byte {
+	encoded, err := json.Marshal(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return data
+	}
+
+	return bytes.Replace(data, []byte(BaseURL), encoded[1:len(encoded)-1], -1)
+}
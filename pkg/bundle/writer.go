@@ -0,0 +1,202 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type (
+	// Artifact - artifact of exported version, to be added with AddArtifact
+	Artifact struct {
+		Kind      string
+		UUID      string
+		Reference string
+		File      string
+		shasum    string // npm only
+		pkg       *Package
+		version   string
+	}
+
+	// Writer - bundle written as tar.gz, manifest is written last
+	Writer struct {
+		gz       *gzip.Writer
+		tw       *tar.Writer
+		manifest *Manifest
+	}
+)
+
+// NewWriter - start bundle
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{
+		gz: gz,
+		tw: tar.NewWriter(gz),
+		manifest: &Manifest{
+			Created:  time.Now().UTC(),
+			Packages: make([]*Package, 0),
+		},
+	}
+}
+
+// AddPackage - add package metadata generated with BaseURL as endpoint, only versions
+// requested are kept. Artifacts of kept versions are returned, each of them should be
+// added with AddArtifact before bundle is closed.
+func (w *Writer) AddPackage(req *Request, metadata []byte) ([]*Artifact, error) {
+	decoded, err := decodeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	versionMap := getVersionMap(req.Kind, decoded)
+	for _, requested := range req.VersionList {
+		found := false
+		for version := range versionMap {
+			if isVersionMatched(version, requested) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%s@%s: %s", req.Name, requested, ErrVersionNotFound)
+		}
+	}
+
+	// npm package may be requested without scope
+	name := req.Name
+	if packageName, ok := decoded["name"].(string); ok && req.Kind == KindNpm && packageName != "" {
+		name = packageName
+	}
+
+	pkg := &Package{
+		Kind:     req.Kind,
+		Name:     name,
+		Metadata: getMetadataFile(req.Kind, name),
+		Versions: make([]Version, 0),
+	}
+
+	artifactList := make([]*Artifact, 0)
+	for version, data := range versionMap {
+		kept := len(req.VersionList) == 0
+		for _, requested := range req.VersionList {
+			kept = kept || isVersionMatched(version, requested)
+		}
+
+		if !kept {
+			delete(versionMap, version)
+			continue
+		}
+
+		file, err := getArtifactFile(req.Kind, data)
+		if err != nil {
+			return nil, err
+		}
+
+		_, uuid, reference, _ := ParseArtifactFile(file)
+		pkg.UUID = uuid
+
+		artifactList = append(artifactList, &Artifact{
+			Kind:      req.Kind,
+			UUID:      uuid,
+			Reference: reference,
+			File:      file,
+			shasum:    getNpmShasum(data),
+			pkg:       pkg,
+			version:   version,
+		})
+	}
+
+	if len(artifactList) == 0 {
+		return nil, fmt.Errorf("%s: %s", req.Name, ErrVersionNotFound)
+	}
+
+	if req.Kind == KindNpm {
+		fixNpmDistTags(decoded)
+	}
+
+	data, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.writeFile(pkg.Metadata, data); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(artifactList, func(i, j int) bool {
+		return artifactList[i].version < artifactList[j].version
+	})
+
+	w.manifest.Packages = append(w.manifest.Packages, pkg)
+	return artifactList, nil
+}
+
+// AddArtifact - add artifact of exported version, npm artifact should match shasum in metadata
+func (w *Writer) AddArtifact(a *Artifact, data []byte) error {
+	if a.shasum != "" && a.shasum != fmt.Sprintf("%x", sha1.Sum(data)) {
+		return fmt.Errorf("%s: shasum doesn't match metadata", a.File)
+	}
+
+	if err := w.writeFile(a.File, data); err != nil {
+		return err
+	}
+
+	a.pkg.Versions = append(a.pkg.Versions, Version{
+		Version: a.version,
+		File:    a.File,
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256(data)),
+	})
+
+	return nil
+}
+
+// Close - write manifest and finish bundle
+func (w *Writer) Close() (*Manifest, error) {
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.writeFile(manifestFile, data); err != nil {
+		return nil, err
+	}
+
+	if err := w.tw.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := w.gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return w.manifest, nil
+}
+
+//
+// Private API
+//
+
+// write regular file into bundle
+func (w *Writer) writeFile(name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  w.manifest.Created,
+		Typeflag: tar.TypeReg,
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := w.tw.Write(data)
+	return err
+}
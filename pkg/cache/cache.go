@@ -0,0 +1,211 @@
+package cache
+
+// LRU caches which can be inspected and evicted via admin API
+
+import (
+	"github.com/hashicorp/golang-lru"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Cache - LRU cache remembering when each value was added
+	Cache struct {
+		name      string
+		capacity  int
+		lru       *lru.Cache
+		lock      *sync.Mutex
+		addedList map[string]time.Time
+	}
+
+	// Entry - cached value, package and version are parsed from key,
+	// keys are expected to be formatted as "type_package_version"
+	Entry struct {
+		Cache   string    `json:"cache"`
+		Key     string    `json:"key"`
+		Type    string    `json:"type"`
+		Package string    `json:"package"`
+		Version string    `json:"version"`
+		Size    int       `json:"size"` // bytes, zero for non-binary values
+		Added   time.Time `json:"added"`
+	}
+
+	// Usage - cache utilization
+	Usage struct {
+		Name     string `json:"name"`
+		Len      int    `json:"len"`
+		Capacity int    `json:"capacity"`
+		Size     int    `json:"size"` // bytes of binary values
+	}
+
+	// Filter - entry filter, empty fields match any entry
+	Filter struct {
+		Key     string
+		Package string
+		Version string
+	}
+)
+
+var (
+	cacheList     = make([]*Cache, 0)
+	cacheListLock = new(sync.Mutex)
+)
+
+// New - create named cache of given capacity, cache is registered
+// for administration.
+func New(name string, capacity int) *Cache {
+	c := &Cache{
+		name:      name,
+		capacity:  capacity,
+		lock:      new(sync.Mutex),
+		addedList: make(map[string]time.Time),
+	}
+
+	// called for both evicted and removed values
+	c.lru, _ = lru.NewWithEvict(capacity, func(key interface{}, value interface{}) {
+		c.lock.Lock()
+		delete(c.addedList, key.(string))
+		c.lock.Unlock()
+	})
+
+	cacheListLock.Lock()
+	cacheList = append(cacheList, c)
+	cacheListLock.Unlock()
+
+	return c
+}
+
+// List - get all registered caches
+func List() []*Cache {
+	cacheListLock.Lock()
+	defer cacheListLock.Unlock()
+
+	return append([]*Cache{}, cacheList...)
+}
+
+// Evict - remove entries matching filter from all caches,
+// number of removed entries is returned
+func Evict(f Filter) int {
+	count := 0
+	for _, c := range List() {
+		for _, e := range c.Entries(f) {
+			c.Remove(e.Key)
+			count++
+		}
+	}
+
+	return count
+}
+
+// Get - lookup value, value becomes recently used
+func (c *Cache) Get(key string) (interface{}, bool) {
+	return c.lru.Get(key)
+}
+
+// Add - add value, true is returned when oldest value is evicted
+func (c *Cache) Add(key string, value interface{}) bool {
+	evicted := c.lru.Add(key, value)
+
+	c.lock.Lock()
+	c.addedList[key] = time.Now()
+	c.lock.Unlock()
+
+	return evicted
+}
+
+// Remove - remove value
+func (c *Cache) Remove(key string) {
+	c.lru.Remove(key)
+}
+
+// Usage - get cache utilization
+func (c *Cache) Usage() Usage {
+	u := Usage{
+		Name:     c.name,
+		Capacity: c.capacity,
+	}
+
+	for _, e := range c.Entries(Filter{}) {
+		u.Len++
+		u.Size += e.Size
+	}
+
+	return u
+}
+
+// Entries - get entries matching filter, ordered by key,
+// inspecting entries doesn't change recently used order
+func (c *Cache) Entries(f Filter) []Entry {
+	list := make([]Entry, 0)
+	for _, rawKey := range c.lru.Keys() {
+		key, _ := rawKey.(string)
+		value, ok := c.lru.Peek(key)
+		if !ok {
+			continue
+		}
+
+		e := Entry{Cache: c.name, Key: key}
+		e.Type, e.Package, e.Version = parseKey(key)
+		if !f.matches(&e) {
+			continue
+		}
+
+		if data, ok := value.([]byte); ok {
+			e.Size = len(data)
+		}
+
+		c.lock.Lock()
+		e.Added = c.addedList[key]
+		c.lock.Unlock()
+
+		list = append(list, e)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+
+	return list
+}
+
+//
+// Private API
+//
+
+func (f Filter) matches(e *Entry) bool {
+	if f.Key != "" && f.Key != e.Key {
+		return false
+	}
+
+	if f.Package != "" && f.Package != e.Package {
+		return false
+	}
+
+	return f.Version == "" || f.Version == e.Version
+}
+
+// "type_package_version", package may contain underscores (e.g. maven "group_artifact"),
+// metadata files are cached as "file_project_ref_path".
+func parseKey(key string) (string, string, string) {
+	partList := strings.SplitN(key, "_", 2)
+	if len(partList) != 2 {
+		return key, "", ""
+	}
+
+	keyType, rest := partList[0], partList[1]
+	if keyType == "file" {
+		fileList := strings.SplitN(rest, "_", 3)
+		if len(fileList) == 3 {
+			return keyType, fileList[0], fileList[1]
+		}
+	}
+
+	pos := strings.LastIndex(rest, "_")
+	if pos < 0 {
+		return keyType, rest, ""
+	}
+
+	return keyType, rest[:pos], rest[pos+1:]
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCache_Entries(t *testing.T) {
+	c := New("test-entries", 2)
+
+	c.Add("archive_48bfe31a_abc", []byte("archive"))
+	c.Add("jar_com.acme_auth_1.0.0", []byte("jar"))
+	c.Add("file_12_abc_src/package.json", []byte("{}"))
+
+	// oldest entry is evicted, and forgotten
+	list := c.Entries(Filter{})
+	assert.Len(t, list, 2)
+	assert.Equal(t, "file", list[0].Type)
+	assert.Equal(t, "12", list[0].Package)
+	assert.Equal(t, "abc", list[0].Version)
+	assert.Equal(t, "jar", list[1].Type)
+	assert.Equal(t, "com.acme_auth", list[1].Package)
+	assert.Equal(t, "1.0.0", list[1].Version)
+	assert.Equal(t, 3, list[1].Size)
+	assert.False(t, list[1].Added.IsZero())
+	assert.Len(t, c.addedList, 2)
+
+	usage := c.Usage()
+	assert.Equal(t, 2, usage.Len)
+	assert.Equal(t, 5, usage.Size)
+}
+
+func TestEvict(t *testing.T) {
+	c := New("test-evict", 10)
+
+	c.Add("npm_48bfe31a_abc", []byte("raw"))
+	c.Add("archive_48bfe31a_abc", []byte("tgz"))
+	c.Add("archive_48bfe31a_def", []byte("tgz"))
+	c.Add("chart_acme-api_1.2.0", []byte("chart"))
+
+	assert.Equal(t, 2, Evict(Filter{Package: "48bfe31a", Version: "abc"}))
+	assert.Equal(t, 1, Evict(Filter{Key: "chart_acme-api_1.2.0"}))
+
+	list := c.Entries(Filter{})
+	assert.Len(t, list, 1)
+	assert.Equal(t, "archive_48bfe31a_def", list[0].Key)
+
+	_, ok := c.Get("archive_48bfe31a_abc")
+	assert.False(t, ok)
+}
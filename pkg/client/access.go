@@ -0,0 +1,209 @@
+package client
+
+import (
+	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// repo.json entry access rule, entry without rule is available
+	// for every token which can see GitLab project
+	accessRule struct {
+		UserList  []string
+		GroupList []string
+		Hidden    bool // denied package is reported as missing instead of forbidden
+	}
+
+	// GitLab user behind the token and user's groups
+	cachedIdentity struct {
+		Expire    time.Time
+		User      *gitlab.User
+		GroupList []*gitlab.Group
+	}
+)
+
+var (
+	// ErrPackageNotFound - package is not defined in repo.json or hidden for token
+	ErrPackageNotFound = errors.New("Package not found")
+
+	// ErrPackageAccessDenied - package is restricted by repo.json access rule
+	ErrPackageAccessDenied = errors.New("Access to package denied")
+
+	// ErrReadOnlyToken - token belongs to user listed in PAVLIK_READONLY_USERS or is issued by Pavlik
+	ErrReadOnlyToken = errors.New("Token is read-only")
+
+	// set once any repo.json entry with access rule is loaded
+	accessRuleDefined int32
+)
+
+// CheckAccess - check package is available for the token, cached archives
+// are served without any GitLab requests, so access rules should be
+// checked beforehand. Check is skipped until any access rule is defined,
+// unless snapshots are enabled: frozen archives outlive cache and restarts,
+// so package is always resolved for the token before frozen archive is served.
+func (c *GitLabConnection) CheckAccess(ctx context.Context, kind, uuid string) error {
+	if c.tokenScope != nil && !c.tokenScope.Allows(kind, uuid) {
+		return ErrPackageNotFound
+	}
+
+	if atomic.LoadInt32(&accessRuleDefined) == 0 && !helpers.IsSnapshotEnabled() {
+		return nil
+	}
+
+	if err := c.fetchBasicData(ctx, kind); err != nil {
+		return err
+	}
+
+	_, err := c.findPackageRepoByUUID(uuid)
+	return err
+}
+
+// CheckWriteAccess - check token is allowed to change Pavlik state (e.g. cache),
+// read-only users are usually CI bots, issued tokens are always read-only.
+func (c *GitLabConnection) CheckWriteAccess(ctx context.Context) error {
+	if c.tokenScope != nil {
+		return ErrReadOnlyToken
+	}
+
+	if len(readOnlyUserList) == 0 {
+		return nil
+	}
+
+	identity, err := c.getIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	if hasName(readOnlyUserList, identity.User.Username) {
+		return ErrReadOnlyToken
+	}
+
+	return nil
+}
+
+// GetUsername - get GitLab username behind the token, identity is cached,
+// so it is cheap enough to be called on every request (e.g. audit log).
+func (c *GitLabConnection) GetUsername(ctx context.Context) (string, error) {
+	identity, err := c.getIdentity(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return identity.User.Username, nil
+}
+
+//
+// Private API
+//
+
+// parse "access" field of repo.json entry, e.g.:
+// {"users": ["alice"], "groups": ["devops", "backend/core"], "hidden": true}
+func newAccessRule(data JsonMap) *accessRule {
+	raw, err := data.GetMapInterface("access", nil)
+	if err != nil {
+		return nil
+	}
+
+	rule := &accessRule{
+		UserList:  getNameList(*raw, "users"),
+		GroupList: getNameList(*raw, "groups"),
+	}
+	rule.Hidden, _ = (*raw)["hidden"].(bool)
+
+	atomic.StoreInt32(&accessRuleDefined, 1)
+	return rule
+}
+
+// check user is listed in rule or is a member of listed group,
+// group is matched by full path (with parent groups) when GitLab provides it.
+func (r *accessRule) isAllowed(identity *cachedIdentity) bool {
+	if hasName(r.UserList, identity.User.Username) {
+		return true
+	}
+
+	for _, group := range identity.GroupList {
+		groupPath := group.FullPath
+		if groupPath == "" {
+			groupPath = group.Path
+		}
+
+		if hasName(r.GroupList, groupPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// return cache key for identity of token
+func (c *GitLabConnection) getIdentityCacheKey() string {
+	return fmt.Sprintf("identity_%s", c.tokenKey)
+}
+
+// fetch GitLab user and groups for the token, result is cached
+// per token same way as project list.
+func (c *GitLabConnection) getIdentity(ctx context.Context) (*cachedIdentity, error) {
+	// deploy and issued tokens are not GitLab users, so they are not members of any group,
+	// job token is resolved on behalf of user running the pipeline as any other token
+	if c.tokenUser != nil {
+		return &cachedIdentity{User: c.tokenUser, GroupList: make([]*gitlab.Group, 0)}, nil
+	}
+
+	cacheKey := c.getIdentityCacheKey()
+	if item, ok := cacheGet(cacheKey); ok {
+		if identity, ok := item.(*cachedIdentity); ok && identity.Expire.After(time.Now()) {
+			return identity, nil
+		}
+
+		globalCache.Remove(cacheKey)
+	}
+
+	user, err := c.client.GetCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groupList, err := c.client.GetGroupList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &cachedIdentity{
+		Expire:    time.Now().Add(30 * time.Minute),
+		User:      user,
+		GroupList: groupList,
+	}
+
+	cacheAdd(cacheKey, identity)
+	return identity, nil
+}
+
+// extract list of non-empty strings from map
+func getNameList(data map[string]interface{}, key string) []string {
+	list := make([]string, 0)
+	rawList, _ := data[key].([]interface{})
+	for _, raw := range rawList {
+		if name, _ := raw.(string); name != "" {
+			list = append(list, name)
+		}
+	}
+
+	return list
+}
+
+// check name is in list, case-insensitive, GitLab paths are case-insensitive
+func hasName(list []string, name string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/tokens"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewAccessRule(t *testing.T) {
+	testList := []struct {
+		name string
+		data JsonMap
+		rule *accessRule
+	}{
+		{
+			name: "no rule",
+			data: JsonMap{"uuid": "uuid-1"},
+			rule: nil,
+		},
+		{
+			name: "users and groups",
+			data: JsonMap{"access": map[string]interface{}{
+				"users":  []interface{}{"alice", "", 42},
+				"groups": []interface{}{"devops", "backend/core"},
+			}},
+			rule: &accessRule{
+				UserList:  []string{"alice"},
+				GroupList: []string{"devops", "backend/core"},
+			},
+		},
+		{
+			name: "hidden",
+			data: JsonMap{"access": map[string]interface{}{
+				"users":  []interface{}{"alice"},
+				"hidden": true,
+			}},
+			rule: &accessRule{
+				UserList:  []string{"alice"},
+				GroupList: []string{},
+				Hidden:    true,
+			},
+		},
+	}
+
+	for _, test := range testList {
+		assert.Equal(t, test.rule, newAccessRule(test.data), test.name)
+	}
+}
+
+func TestAccessRule_IsAllowed(t *testing.T) {
+	rule := &accessRule{
+		UserList:  []string{"alice"},
+		GroupList: []string{"devops", "backend/core"},
+	}
+
+	testList := []struct {
+		name     string
+		identity *cachedIdentity
+		allowed  bool
+	}{
+		{
+			name:     "listed user",
+			identity: newTestIdentity("alice"),
+			allowed:  true,
+		},
+		{
+			name:     "listed user, case-insensitive",
+			identity: newTestIdentity("Alice"),
+			allowed:  true,
+		},
+		{
+			name:     "unlisted user without groups",
+			identity: newTestIdentity("bob"),
+			allowed:  false,
+		},
+		{
+			name:     "group path",
+			identity: newTestIdentity("bob", &gitlab.Group{Path: "devops"}),
+			allowed:  true,
+		},
+		{
+			name:     "group full path",
+			identity: newTestIdentity("bob", &gitlab.Group{Path: "core", FullPath: "backend/core"}),
+			allowed:  true,
+		},
+		{
+			name:     "subgroup with same path in another parent",
+			identity: newTestIdentity("bob", &gitlab.Group{Path: "core", FullPath: "frontend/core"}),
+			allowed:  false,
+		},
+		{
+			name:     "full path wins over path",
+			identity: newTestIdentity("bob", &gitlab.Group{Path: "devops", FullPath: "frontend/devops"}),
+			allowed:  false,
+		},
+	}
+
+	for _, test := range testList {
+		assert.Equal(t, test.allowed, rule.isAllowed(test.identity), test.name)
+	}
+}
+
+func TestGitLabConnection_FilterProjectList(t *testing.T) {
+	projectList := []*gitlab.Project{
+		{ID: 1, HTTPURL: "https://gitlab.local/acme/open.git"},
+		{ID: 2, SSHURL: "git@gitlab.local:acme/denied.git"},
+		{ID: 3, HTTPURL: "https://gitlab.local/acme/hidden.git"},
+		{ID: 4, HTTPURL: "https://gitlab.local/acme/allowed.git"},
+	}
+
+	newContainerRepoList := func() []*containerItem {
+		return []*containerItem{
+			{GitURL: "https://gitlab.local/acme/open.git", UUID: "uuid-open"},
+			{GitURL: "git@gitlab.local:acme/denied.git", UUID: "uuid-denied",
+				Access: &accessRule{UserList: []string{"alice"}}},
+			{GitURL: "https://gitlab.local/acme/hidden.git", UUID: "uuid-hidden",
+				Access: &accessRule{UserList: []string{"alice"}, Hidden: true}},
+			{GitURL: "https://gitlab.local/acme/allowed.git", UUID: "uuid-allowed",
+				Access: &accessRule{GroupList: []string{"backend"}}},
+			{GitURL: "https://gitlab.local/acme/missing.git", UUID: "uuid-missing"},
+		}
+	}
+
+	testList := []struct {
+		name        string
+		identity    *cachedIdentity
+		tokenScope  *tokens.Token
+		packageList []string
+		deniedList  []string
+	}{
+		{
+			name:        "listed user",
+			identity:    newTestIdentity("alice"),
+			packageList: []string{"uuid-denied", "uuid-hidden", "uuid-open"},
+			deniedList:  []string{"uuid-allowed"},
+		},
+		{
+			name:        "group member, hidden entry is dropped",
+			identity:    newTestIdentity("bob", &gitlab.Group{Path: "backend", FullPath: "backend"}),
+			packageList: []string{"uuid-allowed", "uuid-open"},
+			deniedList:  []string{"uuid-denied"},
+		},
+		{
+			name:        "issued token scope",
+			identity:    newTestIdentity("alice"),
+			tokenScope:  &tokens.Token{UUIDList: []string{"uuid-open", "uuid-denied"}},
+			packageList: []string{"uuid-denied", "uuid-open"},
+			deniedList:  []string{},
+		},
+	}
+
+	for _, test := range testList {
+		c := newTestConnection(test.name, test.identity)
+		c.tokenScope = test.tokenScope
+		c.visibleProjectList = projectList
+		c.containerRepoList = newContainerRepoList()
+
+		err := c.filterProjectList(context.Background(), KindNpm)
+		if assert.Nil(t, err, test.name) {
+			assert.Equal(t, test.packageList, getTestUUIDList(c.packageRepoList), test.name)
+			assert.Equal(t, test.deniedList, getTestUUIDList(c.deniedRepoList), test.name)
+		}
+	}
+}
+
+func TestGitLabConnection_FindPackageRepoByUUID(t *testing.T) {
+	c := &GitLabConnection{
+		packageRepoList: []*containerItem{{UUID: "uuid-open"}},
+		deniedRepoList:  []*containerItem{{UUID: "uuid-denied"}},
+	}
+
+	testList := []struct {
+		uuid string
+		err  error
+	}{
+		{uuid: "uuid-open", err: nil},
+		{uuid: "uuid-denied", err: ErrPackageAccessDenied},
+		{uuid: "uuid-hidden", err: ErrPackageNotFound},
+	}
+
+	for _, test := range testList {
+		item, err := c.findPackageRepoByUUID(test.uuid)
+		assert.Equal(t, test.err, err, test.uuid)
+		if test.err == nil {
+			assert.Equal(t, test.uuid, item.UUID)
+		} else {
+			assert.Nil(t, item, test.uuid)
+		}
+	}
+}
+
+func TestGitLabConnection_CheckWriteAccess(t *testing.T) {
+	defer func(list []string) {
+		readOnlyUserList = list
+	}(readOnlyUserList)
+
+	testList := []struct {
+		name         string
+		readOnlyList []string
+		tokenScope   *tokens.Token
+		err          error
+	}{
+		{
+			name: "no read-only users",
+			err:  nil,
+		},
+		{
+			name:         "unlisted user",
+			readOnlyList: []string{"ci-bot"},
+			err:          nil,
+		},
+		{
+			name:         "listed user",
+			readOnlyList: []string{"Alice"},
+			err:          ErrReadOnlyToken,
+		},
+		{
+			name:       "issued token",
+			tokenScope: &tokens.Token{},
+			err:        ErrReadOnlyToken,
+		},
+	}
+
+	for _, test := range testList {
+		readOnlyUserList = test.readOnlyList
+
+		c := newTestConnection(test.name, newTestIdentity("alice"))
+		c.tokenScope = test.tokenScope
+
+		assert.Equal(t, test.err, c.CheckWriteAccess(context.Background()), test.name)
+	}
+}
+
+//
+// Private API
+//
+
+// identity of GitLab user, member of groups
+func newTestIdentity(username string, groupList ...*gitlab.Group) *cachedIdentity {
+	return &cachedIdentity{
+		Expire:    time.Now().Add(time.Minute),
+		User:      &gitlab.User{Username: username},
+		GroupList: append(make([]*gitlab.Group, 0), groupList...),
+	}
+}
+
+// connection with identity already cached, so GitLab is never requested
+func newTestConnection(token string, identity *cachedIdentity) *GitLabConnection {
+	c := &GitLabConnection{tokenKey: "test_" + token}
+	globalCache.Add(c.getIdentityCacheKey(), identity)
+
+	return c
+}
+
+// sorted UUIDs of entries, filtered list order depends on goroutines
+func getTestUUIDList(itemList []*containerItem) []string {
+	list := make([]string, 0)
+	for _, item := range itemList {
+		list = append(list, item.UUID)
+	}
+	sort.Strings(list)
+
+	return list
+}
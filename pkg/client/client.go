@@ -3,14 +3,21 @@ package client
 // Communication with GitLab
 
 import (
+	"comrade-pavlik2/pkg/cache"
 	"comrade-pavlik2/pkg/client/gitlab"
 	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/manifest"
+	"comrade-pavlik2/pkg/metrics"
+	"comrade-pavlik2/pkg/pins"
+	"comrade-pavlik2/pkg/tokens"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/hashicorp/golang-lru"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"runtime"
 	"strings"
 	"sync"
@@ -24,9 +31,22 @@ type (
 		containerRepo      *gitlab.Project   // project with repo.json
 		containerRepoList  []*containerItem  // all entries from repo.json
 		packageRepoList    []*containerItem  // filtered list of entries
+		deniedRepoList     []*containerItem  // entries restricted by access rule
 
-		token  string
-		client *gitlab.Client
+		tokenKey   string        // HMAC of token, raw token is kept by GitLab client only
+		tokenUser  *gitlab.User  // owner of deploy/issued token, API is accessed with service token
+		tokenScope *tokens.Token // issued token, optional
+		client     *gitlab.Client
+
+		download *Download // archive served for current request, optional
+	}
+
+	// Package archive served for request, recorded by registries, so audit log
+	// and download stats know package behind urls addressed by name and version
+	Download struct {
+		Kind      string
+		UUID      string
+		Reference string
 	}
 
 	// Represent project/package repository
@@ -38,10 +58,17 @@ type (
 		MetadataLock *sync.RWMutex
 	}
 
+	// Represent repo.json entry visible for token, without tags and metadata
+	PackageEntry struct {
+		UUID    string
+		Project *gitlab.Project
+	}
+
 	// Represent project/package tag
 	Tag struct {
 		Name         string
 		Reference    string
+		Time         time.Time // tagged commit date
 		Metadata     *JsonMap
 		MetadataLock *sync.RWMutex
 	}
@@ -51,6 +78,7 @@ type (
 		GitURL    string
 		UUID      string
 		LabelList []string
+		Access    *accessRule // optional
 		Project   *gitlab.Project
 	}
 
@@ -59,6 +87,12 @@ type (
 		Expire      time.Time
 		ProjectList []*gitlab.Project
 	}
+
+	// timed list of package names defined in repo.json
+	cachedNameList struct {
+		Expire   time.Time
+		NameList []string
+	}
 )
 
 var (
@@ -67,22 +101,49 @@ var (
 	baseURL                   string
 	repoPathWithNamespace     string
 	repoListJsonNamespace     string
-	repoListJsonFileExtraList string // temporary storage
+	repoListJsonFileExtraList string   // temporary storage
+	serviceToken              string   // optional, used for readiness checks
+	readOnlyUserList          []string // optional, users not allowed to manage cache
+	deployTokenUserList       []string // optional, deploy tokens allowed to access packages
+	backgroundTimeout         = 5 * time.Minute
+
+	// ErrConfigIncomplete - GitLab or package list environment variables are not set
+	ErrConfigIncomplete = errors.New("Please check environment variables, some of them are not set!")
 
 	// predefined constants
 	KindComposer = "composer"
 	KindNpm      = "npm"
+	KindGo       = "go"
+	KindPypi     = "pypi"
+	KindHelm     = "helm"
+	KindMaven    = "maven"
+	KindCargo    = "cargo"
+	KindGem      = "gem"
+	KindList     = []string{KindComposer, KindNpm, KindGo, KindPypi, KindHelm, KindMaven, KindCargo, KindGem}
 
 	composerMetadataFile = "composer.json"
 	npmMetadataFile      = "package.json"
+	goMetadataFile       = "go.mod"
+	pypiMetadataFileList = []string{"pyproject.toml", "setup.cfg"}
+	helmMetadataFile     = "Chart.yaml"
+	mavenMetadataFile    = "pom.xml"
+	cargoMetadataFile    = "Cargo.toml"
+	gemMetadataFileExt   = ".gemspec"
 
 	// Cache policy:
 	//
 	//  * projectList - per token, for a relatively small amount of time (5-10 min)
-	//  * tag metadata file (composer.json/package.json) - forever, except master.
+	//  * tag metadata file (composer.json/package.json/go.mod) - forever, except master.
 	//  * archive []bytes - forever, except master.
 	//
-	globalCache, _ = lru.New(1024)
+	globalCache = cache.New("gitlab", 1024)
+
+	// in-flight GitLab downloads, keyed by cache keys
+	globalFlight = helpers.NewFlightGroup()
+
+	// first-seen commits of tags, archives and metadata are cached by commit,
+	// so moved tag would silently change archive checksum
+	tagPinStore *pins.Store
 )
 
 func init() {
@@ -91,12 +152,28 @@ func init() {
 	repoListJsonFile = os.Getenv("GITLAB_REPO_FILE")
 	repoListJsonFileExtraList = os.Getenv("GITLAB_REPO_FILE_EXTRA_LIST")
 	repoListJsonNamespace = os.Getenv("GITLAB_FILE_NAMESPACE")
+	serviceToken = os.Getenv("GITLAB_SERVICE_TOKEN")
+	readOnlyUserList = helpers.GetListFromEnv("PAVLIK_READONLY_USERS")
+	deployTokenUserList = helpers.GetListFromEnv("PAVLIK_DEPLOY_TOKEN_USERS")
+
+	gitlab.RequestTimeout = helpers.GetDurationFromEnv("GITLAB_REQUEST_TIMEOUT", gitlab.RequestTimeout)
+	gitlab.MaxRetries = helpers.GetIntFromEnv("GITLAB_MAX_RETRIES", gitlab.MaxRetries)
+	gitlab.RateLimit = float64(helpers.GetIntFromEnv("GITLAB_RATE_LIMIT", 0))
+	readinessTTL = helpers.GetDurationFromEnv("PAVLIK_READINESS_TTL", readinessTTL)
 
 	fmt.Println("> Pavlik reporting")
-	if baseURL == "" || repoPathWithNamespace == "" || repoListJsonFile == "" || repoListJsonNamespace == "" {
-		fmt.Println("ERROR: Please check environment variables, some of them are not set!")
+	if IsOffline() {
+		fmt.Println("==> Offline, bundles:", os.Getenv("PAVLIK_BUNDLE_DIR"))
+		return
+	}
+
+	var err error
+	tagPinStore, err = pins.NewStore(os.Getenv("PAVLIK_DATA_DIR"), os.Getenv("PAVLIK_MOVED_TAG_POLICY"))
+	if err != nil {
+		fmt.Println("ERROR: Failed to load tag pins:", err)
 		os.Exit(1)
 	}
+	tagPinStore.AutoSave(time.Minute)
 
 	// parse additional files
 	repoJsonFilesList = append(repoJsonFilesList, repoListJsonFile)
@@ -110,60 +187,106 @@ func init() {
 		}
 	}
 
-	fmt.Println("==> GitLab:", baseURL)
+	// incomplete configuration is reported by CheckConfig
+	if CheckConfig() != nil {
+		return
+	}
+
+	fmt.Println("==> GitLab:", helpers.RedactURL(baseURL))
 	fmt.Println("==> Repository:", repoPathWithNamespace)
 	fmt.Println("==> Namespace:", repoListJsonNamespace)
 	fmt.Println("==> Source Files:", strings.Join(repoJsonFilesList, ", "))
+	fmt.Println("==> Moved tag policy:", tagPinStore.Policy())
+}
+
+// CheckConfig - make sure GitLab and package list are configured, unless Pavlik runs offline
+func CheckConfig() error {
+	if IsOffline() {
+		return nil
+	}
+
+	if baseURL == "" || repoPathWithNamespace == "" || repoListJsonFile == "" || repoListJsonNamespace == "" {
+		return ErrConfigIncomplete
+	}
+
+	return nil
+}
+
+// IsOffline - GitLab is not configured, only bundles imported into PAVLIK_BUNDLE_DIR are served
+func IsOffline() bool {
+	return baseURL == "" && os.Getenv("PAVLIK_BUNDLE_DIR") != ""
+}
+
+// GetMovedTagList - get moved tags detected, newest first
+func GetMovedTagList() []pins.Event {
+	return tagPinStore.EventList()
 }
 
-// NewConnectionFromRequest - create new GitLabConnection for a given request
+// NewConnectionFromRequest - create new GitLabConnection for a given request,
+// connection is validated within request context.
 func NewConnectionFromRequest(r *http.Request) (*GitLabConnection, error) {
-	token := helpers.GetTokenFromRequest(r)
+	username, token := helpers.GetCredentialsFromRequest(r)
 
-	driver, err := gitlab.NewClient(baseURL, token)
-	if err != nil {
-		// possible errors:
-		//  * ErrGitLabInvalidToken
-		//  * ErrGitLabInvalidEndpoint
-		return nil, err
+	tokenType := getTokenType(username, token)
+	if tokenType == gitlab.TokenTypeJob || tokenType == gitlab.TokenTypeDeploy {
+		return newServiceConnection(r.Context(), username, token, tokenType)
 	}
 
-	c := &GitLabConnection{
-		token:  token,
-		client: driver,
+	return newConnection(r.Context(), token, tokenType)
+}
+
+// NewConnectionFromToken - create new GitLabConnection for a given personal access token,
+// connection is validated within provided context.
+func NewConnectionFromToken(ctx context.Context, token string) (*GitLabConnection, error) {
+	return newConnection(ctx, token, gitlab.TokenTypePersonal)
+}
+
+// GetCurrentUser - get GitLab user owning the token
+func (c *GitLabConnection) GetCurrentUser(ctx context.Context) (*gitlab.User, error) {
+	if c.tokenUser != nil {
+		return c.tokenUser, nil
 	}
-	return c, nil
+
+	return c.client.GetCurrentUser(ctx)
 }
 
 // GetArchive - get binary buffer (tar.gz) for whole project by ref
-func (c *GitLabConnection) GetArchive(kind, uuid, ref string) ([]byte, error) {
+func (c *GitLabConnection) GetArchive(ctx context.Context, kind, uuid, ref string) ([]byte, error) {
 	var packageRepo *containerItem
 	var item interface{}
 	var ok bool
 	var err error
 	var archive []byte
+	var value interface{}
 
 	cacheKey := fmt.Sprintf("%s_%s_%s", kind, uuid, ref)
 	ok = false
 
 	// WARNING: *never* cache master ref
 	if ref != "master" {
-		item, ok = globalCache.Get(cacheKey)
+		item, ok = cacheGet(cacheKey)
 	}
 
 	if !ok {
-		if err = c.fetchBasicData(kind); err != nil {
+		if err = c.fetchBasicData(ctx, kind); err != nil {
 			return nil, err
 		}
 		if packageRepo, err = c.findPackageRepoByUUID(uuid); err != nil {
 			return nil, err
 		}
-		if archive, err = c.client.GetArchive(packageRepo.Project, ref); err != nil {
+
+		// concurrent requests for the same archive share single download
+		value, err = globalFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+			return c.client.GetArchive(ctx, packageRepo.Project, ref)
+		})
+		if err != nil {
 			return nil, err
 		}
+
+		archive = value.([]byte)
 		// WARNING: *don't even think* to put master ref into cache
 		if ref != "master" {
-			globalCache.Add(cacheKey, archive)
+			cacheAdd(cacheKey, archive)
 		}
 	} else {
 		if archive, ok = item.([]byte); !ok {
@@ -176,8 +299,8 @@ func (c *GitLabConnection) GetArchive(kind, uuid, ref string) ([]byte, error) {
 }
 
 // GetRepo - return package repository
-func (c *GitLabConnection) GetRepo(kind, uuid string) (*GitLabRepo, error) {
-	if err := c.fetchBasicData(kind); err != nil {
+func (c *GitLabConnection) GetRepo(ctx context.Context, kind, uuid string) (*GitLabRepo, error) {
+	if err := c.fetchBasicData(ctx, kind); err != nil {
 		return nil, err
 	}
 
@@ -187,19 +310,90 @@ func (c *GitLabConnection) GetRepo(kind, uuid string) (*GitLabRepo, error) {
 	}
 
 	log.Printf("==> Fetching repository data: %s", packageRepo.Project.Name)
-	return c.fetchRepoData(kind, packageRepo)
+	return c.fetchRepoData(ctx, kind, packageRepo)
+}
+
+// IsPrivatePackageName - check package name is defined by any repo.json entry, no matter
+// whether package is visible for current token, so private names are never resolved
+// via public uplink. Names are resolved with service token and cached for a short time.
+func IsPrivatePackageName(ctx context.Context, kind, name string) (bool, error) {
+	nameList, err := getPrivatePackageNameList(ctx, kind)
+	if err != nil {
+		return false, err
+	}
+
+	return hasName(nameList, name), nil
+}
+
+// GetPackageName - resolve package name of repo.json entry from its metadata at given ref,
+// e.g. for audit log of downloads addressed by uuid. Names of tagged commits never change,
+// so they are cached along with metadata files.
+func (c *GitLabConnection) GetPackageName(ctx context.Context, kind, uuid, ref string) (string, error) {
+	cacheKey := fmt.Sprintf("name-%s_%s_%s", kind, uuid, ref)
+	if item, ok := cacheGet(cacheKey); ok {
+		if name, ok := item.(string); ok {
+			return name, nil
+		}
+
+		globalCache.Remove(cacheKey)
+	}
+
+	if err := c.fetchBasicData(ctx, kind); err != nil {
+		return "", err
+	}
+
+	packageRepo, err := c.findPackageRepoByUUID(uuid)
+	if err != nil {
+		return "", err
+	}
+
+	metadataFileList, err := c.metadataFileListForKind(kind, packageRepo.Project)
+	if err != nil {
+		return "", err
+	}
+
+	r := make(JsonMap, 0)
+	if err := c.fetchMetadata(ctx, packageRepo.Project, ref, metadataFileList, &r); err != nil {
+		return "", err
+	}
+
+	name := getPackageName(kind, r)
+	if name == "" {
+		return "", ErrPackageNotFound
+	}
+
+	// WARNING: master metadata could be changed any time
+	if ref != "master" {
+		cacheAdd(cacheKey, name)
+	}
+
+	return name, nil
+}
+
+// SetDownload - record package archive served for current request
+func (c *GitLabConnection) SetDownload(kind, uuid, ref string) {
+	c.download = &Download{
+		Kind:      kind,
+		UUID:      uuid,
+		Reference: ref,
+	}
+}
+
+// GetDownload - package archive served for current request, nil when nothing was downloaded
+func (c *GitLabConnection) GetDownload() *Download {
+	return c.download
 }
 
 // GetRepoList - return list of package repositories
-func (c *GitLabConnection) GetRepoList(kind string) ([]*GitLabRepo, error) {
-	if err := c.fetchBasicData(kind); err != nil {
+func (c *GitLabConnection) GetRepoList(ctx context.Context, kind string) ([]*GitLabRepo, error) {
+	if err := c.fetchBasicData(ctx, kind); err != nil {
 		return nil, err
 	}
 
 	list := make([]*GitLabRepo, 0)
 	for _, packageRepo := range c.packageRepoList {
 		log.Printf("==> Fetching repository data: %s", packageRepo.Project.Name)
-		packageRepo, err := c.fetchRepoData(kind, packageRepo)
+		packageRepo, err := c.fetchRepoData(ctx, kind, packageRepo)
 		if err != nil {
 			return nil, err
 		}
@@ -210,6 +404,24 @@ func (c *GitLabConnection) GetRepoList(kind string) ([]*GitLabRepo, error) {
 	return list, nil
 }
 
+// GetPackageList - return list of packages visible for token, cheap enough
+// for browsing, as neither tags nor metadata are requested
+func (c *GitLabConnection) GetPackageList(ctx context.Context, kind string) ([]*PackageEntry, error) {
+	if err := c.fetchBasicData(ctx, kind); err != nil {
+		return nil, err
+	}
+
+	list := make([]*PackageEntry, 0)
+	for _, packageRepo := range c.packageRepoList {
+		list = append(list, &PackageEntry{
+			UUID:    packageRepo.UUID,
+			Project: packageRepo.Project,
+		})
+	}
+
+	return list, nil
+}
+
 // return www items values for list of cached projects
 func (c *GitLabConnection) GetCachedList() ([]string, time.Time) {
 	var cachedData cachedProjectList
@@ -240,23 +452,47 @@ func (c *GitLabConnection) GetCachedList() ([]string, time.Time) {
 
 // ClearCachedList - force remove projectList cache key for current token
 func (c *GitLabConnection) ClearCachedList() {
-	cacheKey := c.getProjectListCacheKey()
-	globalCache.Remove(cacheKey)
+	globalCache.Remove(c.getProjectListCacheKey())
+	globalCache.Remove(c.getIdentityCacheKey())
 }
 
 // EnqueueProjectCache - trigger projectList load code for current token,
 // but if cache is exists, do nothing.
-// Function will run in background.
+// Function will run in background, detached from request context.
 func (c *GitLabConnection) EnqueueProjectCache() {
-	go c.fetchProjectList()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+
+		if err := c.fetchProjectList(ctx); err != nil {
+			log.Printf("==> Notice: Failed to enqueue project cache: %s", err)
+		}
+	}()
 }
 
 //
 // Private API
 //
 
+// create connection for personal access or OAuth token
+func newConnection(ctx context.Context, token, tokenType string) (*GitLabConnection, error) {
+	driver, err := gitlab.NewClientWithTokenType(ctx, baseURL, token, tokenType)
+	if err != nil {
+		// possible errors:
+		//  * ErrGitLabInvalidToken
+		//  * ErrGitLabInvalidEndpoint
+		return nil, err
+	}
+
+	c := &GitLabConnection{
+		tokenKey: helpers.GetTokenKey(token),
+		client:   driver,
+	}
+	return c, nil
+}
+
 // method which wraps all fetch/filter/fetch steps into one
-func (c *GitLabConnection) fetchBasicData(kind string) error {
+func (c *GitLabConnection) fetchBasicData(ctx context.Context, kind string) error {
 
 	// few steps to bootstrap GitLab connection:
 	//
@@ -265,15 +501,15 @@ func (c *GitLabConnection) fetchBasicData(kind string) error {
 	//  * fetch repo.json
 	//  * build package projects by filtering projects by kind(tag, label)
 	//
-	if err := c.fetchProjectList(); err != nil {
+	if err := c.fetchProjectList(ctx); err != nil {
 		return err
 	}
 
-	if err := c.fetchSourceRepoList(kind); err != nil {
+	if err := c.fetchSourceRepoList(ctx, kind); err != nil {
 		return err
 	}
 
-	if err := c.filterProjectList(kind); err != nil {
+	if err := c.filterProjectList(ctx, kind); err != nil {
 		return err
 	}
 
@@ -288,12 +524,19 @@ func (c *GitLabConnection) findPackageRepoByUUID(uuid string) (*containerItem, e
 		}
 	}
 
-	return nil, fmt.Errorf("Project with uuid=%s not found", uuid)
+	for _, containerRepo := range c.deniedRepoList {
+		if containerRepo.UUID == uuid {
+			return nil, ErrPackageAccessDenied
+		}
+	}
+
+	log.Printf("==> Notice: Project with uuid=%s not found", uuid)
+	return nil, ErrPackageNotFound
 }
 
 // return cache key for project list
 func (c *GitLabConnection) getProjectListCacheKey() string {
-	return fmt.Sprintf("project_list_%s", c.token)
+	return fmt.Sprintf("project_list_%s", c.tokenKey)
 }
 
 //
@@ -301,7 +544,7 @@ func (c *GitLabConnection) getProjectListCacheKey() string {
 // is cached per token for a relatively small amount of time,
 // in order to allow regular npm/composer operations to be fast.
 //
-func (c *GitLabConnection) fetchProjectList() error {
+func (c *GitLabConnection) fetchProjectList(ctx context.Context) error {
 	var cachedData cachedProjectList
 	var item interface{}
 	var ok bool
@@ -310,7 +553,7 @@ func (c *GitLabConnection) fetchProjectList() error {
 
 	// check global cache and, if something is found, check expire field.
 	cacheKey := c.getProjectListCacheKey()
-	if item, ok = globalCache.Get(cacheKey); ok {
+	if item, ok = cacheGet(cacheKey); ok {
 		if cachedData, ok = item.(cachedProjectList); ok {
 			if cachedData.Expire.Before(time.Now()) {
 				ok = false
@@ -324,12 +567,12 @@ func (c *GitLabConnection) fetchProjectList() error {
 
 	if !ok {
 		log.Println("==> Fetching list of available projects")
-		if projectList, err = c.client.GetProjectList(); err != nil {
+		if projectList, err = c.client.GetProjectList(ctx); err != nil {
 			return err
 		}
 
 		// store data to cache
-		globalCache.Add(cacheKey, cachedProjectList{
+		cacheAdd(cacheKey, cachedProjectList{
 			Expire:      time.Now().Add(30 * time.Minute),
 			ProjectList: projectList,
 		})
@@ -371,8 +614,21 @@ func (c *GitLabConnection) fetchProjectList() error {
 }
 
 // for each repo.json entry, find corresponding GitLab project.
-// project may be unavailable due membership of current token.
-func (c *GitLabConnection) filterProjectList(kind string) error {
+// project may be unavailable due membership of current token,
+// restricted by access rule of entry or by scope of issued token.
+func (c *GitLabConnection) filterProjectList(ctx context.Context, kind string) error {
+	var identity *cachedIdentity
+	var err error
+
+	// access rules are evaluated against GitLab user behind the token
+	for _, containerRepo := range c.containerRepoList {
+		if containerRepo.Access != nil {
+			if identity, err = c.getIdentity(ctx); err != nil {
+				return err
+			}
+			break
+		}
+	}
 
 	itemChan := make(chan *containerItem)
 	guardChan := make(chan bool, runtime.NumCPU())
@@ -394,16 +650,29 @@ func (c *GitLabConnection) filterProjectList(kind string) error {
 			}
 
 			// nothing found..
-			log.Printf("==> Notice: Can't find project for source: %s", containerRepo.GitURL)
+			log.Printf("==> Notice: Can't find project for source: %s", helpers.RedactURL(containerRepo.GitURL))
 			itemChan <- nil
 
 		}(containerRepo)
 	}
 
 	c.packageRepoList = make([]*containerItem, 0)
+	c.deniedRepoList = make([]*containerItem, 0)
 	for i := 0; i < len(c.containerRepoList); i++ {
 		item := <-itemChan
-		if item != nil {
+		switch {
+		case item == nil:
+
+		case c.tokenScope != nil && !c.tokenScope.Allows(kind, item.UUID):
+			// out of issued token scope, always hidden
+
+		case item.Access != nil && !item.Access.isAllowed(identity):
+			log.Printf("==> Notice: Access denied to source: %s", helpers.RedactURL(item.GitURL))
+			if !item.Access.Hidden {
+				c.deniedRepoList = append(c.deniedRepoList, item)
+			}
+
+		default:
 			c.packageRepoList = append(c.packageRepoList, item)
 		}
 	}
@@ -411,30 +680,50 @@ func (c *GitLabConnection) filterProjectList(kind string) error {
 	return nil
 }
 
-// return package metadata file name (composer.json/package.json) for each registry
-func (c *GitLabConnection) metadataFileForKind(kind string) (string, error) {
+// return package metadata file names (composer.json/package.json/go.mod) for each registry,
+// first existing file is used when registry supports few of them
+func (c *GitLabConnection) metadataFileListForKind(kind string, p *gitlab.Project) ([]string, error) {
 	switch kind {
 	case KindComposer:
-		return composerMetadataFile, nil
+		return []string{composerMetadataFile}, nil
 
 	case KindNpm:
-		return npmMetadataFile, nil
+		return []string{npmMetadataFile}, nil
+
+	case KindGo:
+		return []string{goMetadataFile}, nil
+
+	case KindPypi:
+		return pypiMetadataFileList, nil
+
+	case KindHelm:
+		return []string{helmMetadataFile}, nil
+
+	case KindMaven:
+		return []string{mavenMetadataFile}, nil
+
+	case KindCargo:
+		return []string{cargoMetadataFile}, nil
+
+	case KindGem:
+		// gemspec is expected to be named after repository
+		return []string{path.Base(p.PathWithNamespace) + gemMetadataFileExt}, nil
 	}
 
-	return "", fmt.Errorf("Unknown kind: %s", kind)
+	return nil, fmt.Errorf("Unknown kind: %s", kind)
 }
 
 // fetch mandatory information from project repository: such as tags, metadata file
 // and create final package/project entries.
-func (c *GitLabConnection) fetchRepoData(kind string, src *containerItem) (*GitLabRepo, error) {
+func (c *GitLabConnection) fetchRepoData(ctx context.Context, kind string, src *containerItem) (*GitLabRepo, error) {
 	// WARNING: *do not cache* this api call
-	tagList, err := c.client.GetTagList(src.Project)
+	tagList, err := c.client.GetTagList(ctx, src.Project)
 	if err != nil {
 		return nil, err
 	}
 
-	// guessing package.json/composer.json
-	metadataFile, err := c.metadataFileForKind(kind)
+	// guessing package.json/composer.json/go.mod
+	metadataFileList, err := c.metadataFileListForKind(kind, src.Project)
 	if err != nil {
 		return nil, err
 	}
@@ -449,7 +738,7 @@ func (c *GitLabConnection) fetchRepoData(kind string, src *containerItem) (*GitL
 
 	// fetch metadata for master branch, mostly required for npm
 	r := make(JsonMap, 0)
-	if err := c.fetchJsonFile(src.Project, "master", metadataFile, &r); err != nil {
+	if err := c.fetchMetadata(ctx, src.Project, "master", metadataFileList, &r); err != nil {
 		return nil, err
 	}
 
@@ -461,23 +750,47 @@ func (c *GitLabConnection) fetchRepoData(kind string, src *containerItem) (*GitL
 	tagChan := make(chan *Tag)
 	guardChan := make(chan bool, runtime.NumCPU())
 
+	var fetchErr error
+	fetchErrLock := new(sync.Mutex)
+
 	for _, tag := range tagList {
 		go func(tag *gitlab.Tag) {
-			guardChan <- true
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				tagChan <- nil
+				return
+			}
 			defer func() {
 				<-guardChan
 			}()
 
+			// moved tag is either served from pinned commit or not served at all
+			reference, ok := tagPinStore.Check(src.UUID, src.Project.PathWithNamespace, tag.Name, tag.Commit.ID)
+			if !ok {
+				tagChan <- nil
+				return
+			}
+
 			r := make(JsonMap, 0)
-			err := c.fetchJsonFile(src.Project, tag.Commit.ID, metadataFile, &r)
+			err := c.fetchMetadata(ctx, src.Project, reference, metadataFileList, &r)
 			if err != nil {
+				// tag without valid metadata file is not a package version, skip it,
+				// but don't let GitLab failure silently hide existing version
+				if !isMissingMetadata(err) {
+					fetchErrLock.Lock()
+					fetchErr = err
+					fetchErrLock.Unlock()
+				}
+
 				tagChan <- nil
 				return
 			}
 
 			t := &Tag{
 				Name:         tag.Name,
-				Reference:    tag.Commit.ID,
+				Reference:    reference,
+				Time:         tag.Commit.CommittedDate,
 				MetadataLock: new(sync.RWMutex),
 			}
 
@@ -497,11 +810,30 @@ func (c *GitLabConnection) fetchRepoData(kind string, src *containerItem) (*GitL
 		}
 	}
 
+	// request is cancelled, tag list is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+
 	return result, nil
 }
 
+// metadata file is absent or malformed
+func isMissingMetadata(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError, *manifest.ParseError:
+		return true
+	}
+
+	return err == gitlab.ErrGitLabNotFound
+}
+
 // Convert entries in repo.json into containerItem structures
-func (c *GitLabConnection) fetchSourceRepoList(kind string) error {
+func (c *GitLabConnection) fetchSourceRepoList(ctx context.Context, kind string) error {
 
 	//
 	// unpack repo.json
@@ -512,13 +844,18 @@ func (c *GitLabConnection) fetchSourceRepoList(kind string) error {
 	sourceJsonData := make([]JsonMap, 0)
 	for _, jsonFile := range repoJsonFilesList {
 		go func(jsonFile string) {
-			gitlabChan <- true
+			select {
+			case gitlabChan <- true:
+			case <-ctx.Done():
+				jsonChan <- nil
+				return
+			}
 			defer func() {
 				<-gitlabChan
 			}()
 
 			jsonSource := make([]JsonMap, 0)
-			if err := c.fetchJsonFile(c.containerRepo, "master", jsonFile, &jsonSource); err != nil {
+			if err := c.fetchJsonFile(ctx, c.containerRepo, "master", jsonFile, &jsonSource); err != nil {
 				jsonChan <- nil
 				return
 			}
@@ -535,6 +872,11 @@ func (c *GitLabConnection) fetchSourceRepoList(kind string) error {
 		}
 	}
 
+	// request is cancelled, list of packages is incomplete
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	//
 	// transform repo.json entries into real GitLab repositories
 	//
@@ -560,6 +902,7 @@ func (c *GitLabConnection) fetchSourceRepoList(kind string) error {
 				GitURL:    cloneUrl,
 				UUID:      uuid,
 				LabelList: make([]string, 0),
+				Access:    newAccessRule(data),
 			}
 
 			for _, tag := range *tagsInterface {
@@ -586,35 +929,223 @@ func (c *GitLabConnection) fetchSourceRepoList(kind string) error {
 	return nil
 }
 
+// Get first available metadata file from the list
+func (c *GitLabConnection) fetchMetadata(ctx context.Context, p *gitlab.Project, ref string, pathList []string, rec *JsonMap) error {
+	var err error
+	for _, path := range pathList {
+		if err = c.fetchMetadataFile(ctx, p, ref, path, rec); err == nil || !isMissingMetadata(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Get metadata file from repository and decode it according to file format
+func (c *GitLabConnection) fetchMetadataFile(ctx context.Context, p *gitlab.Project, ref, path string, rec *JsonMap) error {
+	if strings.HasSuffix(path, ".json") {
+		return c.fetchJsonFile(ctx, p, ref, path, rec)
+	}
+
+	fileContent, err := c.fetchFile(ctx, p, ref, path)
+	if err != nil {
+		return err
+	}
+
+	// gemspec file name depends on repository
+	format := path
+	if strings.HasSuffix(path, gemMetadataFileExt) {
+		format = gemMetadataFileExt
+	}
+
+	var metadata map[string]interface{}
+	switch format {
+	case goMetadataFile:
+		metadata, err = manifest.ParseGoMod(fileContent)
+		if err == nil {
+			// go.mod should be served as is
+			metadata["mod"] = string(fileContent)
+		}
+
+	case "pyproject.toml":
+		metadata, err = manifest.ParsePyProject(fileContent)
+
+	case "setup.cfg":
+		metadata, err = manifest.ParseSetupCfg(fileContent)
+
+	case helmMetadataFile:
+		metadata, err = manifest.ParseChart(fileContent)
+
+	case mavenMetadataFile:
+		metadata, err = manifest.ParsePom(fileContent)
+		if err == nil {
+			// pom.xml should be served as is
+			metadata["pom"] = string(fileContent)
+		}
+
+	case cargoMetadataFile:
+		metadata, err = manifest.ParseCargoToml(fileContent)
+
+	case gemMetadataFileExt:
+		metadata, err = manifest.ParseGemspec(fileContent)
+
+	default:
+		err = fmt.Errorf("Unknown metadata file format: %s", path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*rec = JsonMap(metadata)
+	return nil
+}
+
 // Get json file from repository and auto-unpack it into provided interface
-func (c *GitLabConnection) fetchJsonFile(p *gitlab.Project, ref, path string, rec interface{}) error {
+func (c *GitLabConnection) fetchJsonFile(ctx context.Context, p *gitlab.Project, ref, path string, rec interface{}) error {
+	fileContent, err := c.fetchFile(ctx, p, ref, path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(fileContent, rec)
+}
+
+// Get raw file contents from repository
+func (c *GitLabConnection) fetchFile(ctx context.Context, p *gitlab.Project, ref, path string) ([]byte, error) {
 	var fileContent []byte
 	var ok bool
 	var err error
 	var item interface{}
+	var value interface{}
 
-	cacheKey := fmt.Sprintf("json_%d_%s", p.ID, ref)
+	cacheKey := fmt.Sprintf("file_%d_%s_%s", p.ID, ref, path)
 	ok = false
 
 	// WARNING: *never* cache master ref
 	if ref != "master" {
-		item, ok = globalCache.Get(cacheKey)
+		item, ok = cacheGet(cacheKey)
 	}
 
 	if !ok {
-		if fileContent, err = c.client.GetFile(p, path, ref); err != nil {
-			return err
+		// concurrent requests for the same file share single download
+		value, err = globalFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+			return c.client.GetFile(ctx, p, path, ref)
+		})
+		if err != nil {
+			return nil, err
 		}
+
+		fileContent = value.([]byte)
 		// WARNING: *don't even think* to put master ref into cache
 		if ref != "master" {
-			globalCache.Add(cacheKey, fileContent)
+			cacheAdd(cacheKey, fileContent)
 		}
 	} else {
 		if fileContent, ok = item.([]byte); !ok {
 			globalCache.Remove(cacheKey)
-			return fmt.Errorf("Cache broken for key: %s", cacheKey)
+			return nil, fmt.Errorf("Cache broken for key: %s", cacheKey)
 		}
 	}
 
-	return json.Unmarshal(fileContent, rec)
+	return fileContent, nil
+}
+
+// return names from master branch metadata of every repo.json entry visible for service token,
+// access rules are not applied, as denied and hidden packages are private as well.
+func getPrivatePackageNameList(ctx context.Context, kind string) ([]string, error) {
+	cacheKey := fmt.Sprintf("package_names_%s", kind)
+	if item, ok := cacheGet(cacheKey); ok {
+		if cached, ok := item.(cachedNameList); ok && cached.Expire.After(time.Now()) {
+			return cached.NameList, nil
+		}
+
+		globalCache.Remove(cacheKey)
+	}
+
+	value, err := globalFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		c, err := NewConnectionFromServiceToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.fetchBasicData(ctx, kind); err != nil {
+			return nil, err
+		}
+
+		nameList := make([]string, 0)
+		for _, containerRepo := range c.containerRepoList {
+			if containerRepo.Project == nil {
+				continue
+			}
+
+			metadataFileList, err := c.metadataFileListForKind(kind, containerRepo.Project)
+			if err != nil {
+				return nil, err
+			}
+
+			r := make(JsonMap, 0)
+			if err := c.fetchMetadata(ctx, containerRepo.Project, "master", metadataFileList, &r); err != nil {
+				if isMissingMetadata(err) {
+					continue
+				}
+				return nil, err
+			}
+
+			if name, _ := r.GetString("name"); name != "" {
+				nameList = append(nameList, name)
+			}
+		}
+
+		cacheAdd(cacheKey, cachedNameList{
+			Expire:   time.Now().Add(5 * time.Minute),
+			NameList: nameList,
+		})
+		return nameList, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]string), nil
+}
+
+// package name as client requests it: module path for go, groupId:artifactId for maven
+func getPackageName(kind string, r JsonMap) string {
+	switch kind {
+	case KindGo:
+		module, _ := r.GetString("module")
+		return module
+
+	case KindMaven:
+		groupID, _ := r.GetString("groupId")
+		artifactID, _ := r.GetString("artifactId")
+		if groupID == "" || artifactID == "" {
+			return ""
+		}
+
+		return groupID + ":" + artifactID
+	}
+
+	name, _ := r.GetString("name")
+	return name
+}
+
+// lookup item in global cache, keeping track of hits and misses
+func cacheGet(key string) (interface{}, bool) {
+	item, ok := globalCache.Get(key)
+	if ok {
+		metrics.CacheHit("gitlab")
+	} else {
+		metrics.CacheMiss("gitlab")
+	}
+
+	return item, ok
+}
+
+// put item into global cache, keeping track of evictions
+func cacheAdd(key string, value interface{}) {
+	if evicted := globalCache.Add(key, value); evicted {
+		metrics.CacheEvictionsTotal.Inc("gitlab")
+	}
 }
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetPackageName(t *testing.T) {
+	testList := []struct {
+		kind     string
+		metadata JsonMap
+		name     string
+	}{
+		{kind: KindComposer, metadata: JsonMap{"name": "acme/auth"}, name: "acme/auth"},
+		{kind: KindNpm, metadata: JsonMap{"name": "@acme/auth"}, name: "@acme/auth"},
+		{kind: KindGo, metadata: JsonMap{"module": "gitlab.local/acme/auth", "name": "auth"}, name: "gitlab.local/acme/auth"},
+		{kind: KindMaven, metadata: JsonMap{"groupId": "com.acme", "artifactId": "auth"}, name: "com.acme:auth"},
+		{kind: KindMaven, metadata: JsonMap{"artifactId": "auth"}, name: ""},
+		{kind: KindGem, metadata: JsonMap{"name": "acme-auth"}, name: "acme-auth"},
+		{kind: KindPypi, metadata: JsonMap{}, name: ""},
+	}
+
+	for _, test := range testList {
+		assert.Equal(t, test.name, getPackageName(test.kind, test.metadata), test.kind)
+	}
+}
+
+func TestGitLabConnection_GetPackageName_Cached(t *testing.T) {
+	cacheAdd("name-npm_uuid-cached_48bfe31a", "@acme/cached")
+
+	// GitLab is never requested for cached name
+	c := &GitLabConnection{}
+	name, err := c.GetPackageName(context.Background(), KindNpm, "uuid-cached", "48bfe31a")
+	assert.Nil(t, err)
+	assert.Equal(t, "@acme/cached", name)
+}
+
+func TestGitLabConnection_SetDownload(t *testing.T) {
+	c := &GitLabConnection{}
+	assert.Nil(t, c.GetDownload())
+
+	c.SetDownload(KindGo, "uuid-auth", "48bfe31a")
+	assert.Equal(t, &Download{Kind: KindGo, UUID: "uuid-auth", Reference: "48bfe31a"}, c.GetDownload())
+}
@@ -1,12 +1,16 @@
 package gitlab
 
 import (
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"gopkg.in/resty.v0"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type (
@@ -15,8 +19,11 @@ type (
 		HasV4Support bool
 		HasV3Support bool
 		Endpoint     string
-		Token        string
+		TokenType    string
 		APIPrefix    string
+		Sudo         string // username API is accessed on behalf of, admin token only
+
+		token string // never exposed, @see String
 	}
 )
 
@@ -26,18 +33,39 @@ var (
 
 	//
 	ErrGitLabInvalidEndpoint = errors.New("Invalid GitLab endpoint")
+
+	// ErrGitLabNotFound - requested resource doesn't exist or not visible for token
+	ErrGitLabNotFound = errors.New("Not found")
+
+	// ErrGitLabSudoDenied - token is not an admin token with "sudo" scope, or user is unknown
+	ErrGitLabSudoDenied = errors.New("Sudo is not allowed")
+
+	// RequestTimeout - deadline for every single call to GitLab
+	RequestTimeout = 60 * time.Second
+
+	// predefined token types, every type is sent with own header
+	TokenTypePersonal = "personal" // PRIVATE-TOKEN
+	TokenTypeOAuth    = "oauth"    // Authorization: Bearer
+	TokenTypeJob      = "job"      // JOB-TOKEN, v4 only, most of API is not available
+	TokenTypeDeploy   = "deploy"   // API is not available, git over HTTP only
 )
 
 //
-func NewClient(endpoint string, token string) (*Client, error) {
+func NewClient(ctx context.Context, endpoint string, token string) (*Client, error) {
+	return NewClientWithTokenType(ctx, endpoint, token, TokenTypePersonal)
+}
+
+// NewClientWithTokenType - create client for personal access, OAuth or CI job token
+func NewClientWithTokenType(ctx context.Context, endpoint, token, tokenType string) (*Client, error) {
 	client := &Client{
 		HasV4Support: false,
 		HasV3Support: false,
 		Endpoint:     endpoint,
-		Token:        token,
+		TokenType:    tokenType,
+		token:        token,
 	}
 
-	err := client.guessAPIVersion()
+	err := client.guessAPIVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -45,15 +73,103 @@ func NewClient(endpoint string, token string) (*Client, error) {
 	return client, nil
 }
 
+// NewClientWithSudo - create client for admin token, every request is made on behalf of user,
+// so user's projects and groups are visible only.
+func NewClientWithSudo(ctx context.Context, endpoint, token, username string) (*Client, error) {
+	client := &Client{
+		HasV4Support: false,
+		HasV3Support: false,
+		Endpoint:     endpoint,
+		TokenType:    TokenTypePersonal,
+		Sudo:         username,
+		token:        token,
+	}
+
+	err := client.guessAPIVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// String - client description without token, safe for logs and dumps
+func (c *Client) String() string {
+	return fmt.Sprintf("gitlab.Client{Endpoint: %s, TokenType: %s, APIPrefix: %s, Sudo: %s}", c.Endpoint, c.TokenType, c.APIPrefix, c.Sudo)
+}
+
+// GoString - same as String, used by %#v
+func (c *Client) GoString() string {
+	return c.String()
+}
+
+// Ping - check GitLab instance is reachable without any token,
+// any response except 5xx means GitLab is up and running.
+func Ping(ctx context.Context, endpoint string) error {
+	client := &Client{
+		Endpoint: endpoint,
+	}
+
+	resp, err := client.executeHead(ctx, "Ping", "/api/v4/user")
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return fmt.Errorf("GitLab responded with: %s", resp.Status())
+	}
+
+	return nil
+}
+
+// CheckRepositoryAccess - check credentials allow to clone repository over HTTP,
+// used for tokens which can't access API at all (deploy tokens) or
+// limited by project allowlist (CI job tokens with "gitlab-ci-token" username).
+func CheckRepositoryAccess(ctx context.Context, endpoint, pathWithNamespace, username, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	requestURL := fmt.Sprintf("%s/%s.git/info/refs?service=git-upload-pack", strings.TrimRight(endpoint, "/"), pathWithNamespace)
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+
+	start := time.Now()
+	resp, err := resty.R().SetContext(ctx).SetHeader("Authorization", "Basic "+credentials).Get(requestURL)
+	observeRequest("CheckRepositoryAccess", start, resp, err)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return nil
+
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return ErrGitLabInvalidToken
+	}
+
+	return fmt.Errorf("GitLab responded with: %s", resp.Status())
+}
+
 //
 // Guess API version, by making HEAD
 // request to /api/vX/namespaces endpoint
 //
-func (c *Client) guessAPIVersion() error {
+func (c *Client) guessAPIVersion(ctx context.Context) error {
+	// job token is not allowed to access user
+	if c.TokenType == TokenTypeJob {
+		return c.checkJobToken(ctx)
+	}
+
 	// Checking: HEAD /api/v4/namespaces
-	resp, _ := c.executeHead("/api/v4/user")
+	resp, err := c.executeHead(ctx, "GuessAPIVersion", "/api/v4/user")
+	if err != nil {
+		return err
+	}
 	if resp.StatusCode() == http.StatusUnauthorized {
-		return ErrGitLabInvalidToken
+		return c.guessOAuthToken(ctx)
+	}
+	if resp.StatusCode() == http.StatusForbidden && c.Sudo != "" {
+		return ErrGitLabSudoDenied
 	}
 
 	// HEAD request succeeded.
@@ -65,7 +181,10 @@ func (c *Client) guessAPIVersion() error {
 	}
 
 	// Checking: HEAD /api/v3/namespaces
-	resp, _ = c.executeHead("/api/v3/user")
+	resp, err = c.executeHead(ctx, "GuessAPIVersion", "/api/v3/user")
+	if err != nil {
+		return err
+	}
 	if resp.StatusCode() == http.StatusUnauthorized {
 		return ErrGitLabInvalidToken
 	}
@@ -82,9 +201,52 @@ func (c *Client) guessAPIVersion() error {
 }
 
 //
-// Execute API method and return array of response bodies
+// Token sent as "Authorization: Bearer" may be either personal access token
+// or OAuth access token, GitLab rejects OAuth token sent as PRIVATE-TOKEN,
+// so rejected personal token is checked once more as OAuth token.
+//
+func (c *Client) guessOAuthToken(ctx context.Context) error {
+	if c.TokenType != TokenTypePersonal || c.Sudo != "" {
+		return ErrGitLabInvalidToken
+	}
+
+	c.TokenType = TokenTypeOAuth
+	if err := c.guessAPIVersion(ctx); err != nil {
+		c.TokenType = TokenTypePersonal
+		return err
+	}
+
+	return nil
+}
+
+//
+// Job tokens appeared along with API v4,
+// token is valid while job is running
+//
+func (c *Client) checkJobToken(ctx context.Context) error {
+	resp, err := c.executeGet(ctx, "GuessAPIVersion", "/api/v4/job")
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		c.HasV4Support = true
+		c.APIPrefix = "/api/v4"
+		return nil
+
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrGitLabInvalidToken
+	}
+
+	return ErrGitLabInvalidEndpoint
+}
+
+//
+// Execute API method and return array of response bodies,
+// method is the name of client method used for metrics
 //
-func (c *Client) executeAPIMethod(baseRequestURI string) ([][]byte, error) {
+func (c *Client) executeAPIMethod(ctx context.Context, method, baseRequestURI string) ([][]byte, error) {
 
 	list := make([][]byte, 0)
 	baseRequestURI = strings.TrimLeft(baseRequestURI, "/")
@@ -99,10 +261,13 @@ func (c *Client) executeAPIMethod(baseRequestURI string) ([][]byte, error) {
 	}
 
 	reqURI := fmt.Sprintf("%s%sper_page=%d", baseRequestURI, addArg, perPage)
-	resp, err := c.executeGet(reqURI)
+	resp, err := c.executeGet(ctx, method, reqURI)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 
 	// store body of initial request
 	list = append(list, resp.Body())
@@ -129,14 +294,19 @@ func (c *Client) executeAPIMethod(baseRequestURI string) ([][]byte, error) {
 
 	for i := nextPage; i <= totalPages; i++ {
 		go func(i int) {
-			guardChan <- true
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				bodyChan <- nil
+				return
+			}
 			defer func() {
 				<-guardChan
 			}()
 
 			reqURI := fmt.Sprintf("%s%sper_page=%d&page=%d", baseRequestURI, addArg, perPage, i)
-			resp, err := c.executeGet(reqURI)
-			if err != nil {
+			resp, err := c.executeGet(ctx, method, reqURI)
+			if err != nil || checkResponse(resp) != nil {
 				bodyChan <- nil
 				return
 			}
@@ -152,6 +322,10 @@ func (c *Client) executeAPIMethod(baseRequestURI string) ([][]byte, error) {
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if len(list) != totalPages {
 		return nil, errors.New("Failed to get some pages..")
 	}
@@ -162,19 +336,80 @@ func (c *Client) executeAPIMethod(baseRequestURI string) ([][]byte, error) {
 //
 // HEAD request helper
 //
-func (c *Client) executeHead(requestURI string) (*resty.Response, error) {
+func (c *Client) executeHead(ctx context.Context, method, requestURI string) (*resty.Response, error) {
 	requestURI = strings.TrimLeft(requestURI, "/")
 	requestURL := fmt.Sprintf("%s/%s", c.Endpoint, requestURI)
 
-	return resty.R().SetHeader("PRIVATE-TOKEN", c.Token).Head(requestURL)
+	return c.execute(ctx, method, resty.MethodHead, requestURL)
 }
 
 //
 // GET request helper
 //
-func (c *Client) executeGet(requestURI string) (*resty.Response, error) {
+func (c *Client) executeGet(ctx context.Context, method, requestURI string) (*resty.Response, error) {
 	requestURI = strings.TrimLeft(requestURI, "/")
 	requestURL := fmt.Sprintf("%s/%s", c.Endpoint, requestURI)
 
-	return resty.R().SetHeader("PRIVATE-TOKEN", c.Token).Get(requestURL)
+	return c.execute(ctx, method, resty.MethodGet, requestURL)
+}
+
+//
+// Single HTTP request, limited by RequestTimeout
+//
+func (c *Client) executeOnce(ctx context.Context, method, httpMethod, requestURL string) (*resty.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	req := resty.R().SetContext(ctx)
+	switch c.TokenType {
+	case TokenTypeOAuth:
+		req.SetHeader("Authorization", "Bearer "+c.token)
+
+	case TokenTypeJob:
+		req.SetHeader("JOB-TOKEN", c.token)
+
+	default:
+		req.SetHeader("PRIVATE-TOKEN", c.token)
+	}
+
+	if c.Sudo != "" {
+		req.SetHeader("Sudo", c.Sudo)
+	}
+
+	start := time.Now()
+	resp, err := req.Execute(httpMethod, requestURL)
+	observeRequest(method, start, resp, err)
+
+	return resp, err
+}
+
+//
+// Convert unsuccessful response into error
+//
+func checkResponse(resp *resty.Response) error {
+	switch code := resp.StatusCode(); {
+	case code >= 200 && code < 300:
+		return nil
+
+	case code == http.StatusUnauthorized:
+		return ErrGitLabInvalidToken
+
+	case code == http.StatusNotFound:
+		return ErrGitLabNotFound
+	}
+
+	return fmt.Errorf("GitLab responded with: %s", resp.Status())
+}
+
+//
+// Record GitLab API call count and latency
+//
+func observeRequest(method string, start time.Time, resp *resty.Response, err error) {
+	code := "error"
+	if err == nil && resp != nil {
+		code = strconv.Itoa(resp.StatusCode())
+	}
+
+	metrics.GitLabRequestsTotal.Inc(method, code)
+	metrics.GitLabRequestDuration.ObserveSince(start, method)
 }
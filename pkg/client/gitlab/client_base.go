@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -8,13 +9,80 @@ import (
 	"net/url"
 )
 
+// @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/users.md#current-user
+// @see https://docs.gitlab.com/ee/api/users.html#for-normal-users-1
+//
+// User owning the token.
+func (c *Client) GetCurrentUser(ctx context.Context) (*User, error) {
+	pageList, err := c.executeAPIMethod(ctx, "GetCurrentUser", "user")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pageList) == 0 {
+		return nil, errors.New("No such user")
+	}
+
+	result := &User{}
+	if err := json.Unmarshal(pageList[0], result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// @see https://docs.gitlab.com/ee/api/jobs.html#get-job-tokens-job
+//
+// Job owning the token, available for job tokens only.
+func (c *Client) GetCurrentJob(ctx context.Context) (*Job, error) {
+	pageList, err := c.executeAPIMethod(ctx, "GetCurrentJob", "job")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pageList) == 0 {
+		return nil, errors.New("No such job")
+	}
+
+	result := &Job{}
+	if err := json.Unmarshal(pageList[0], result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/groups.md#list-project-groups
+// @see https://docs.gitlab.com/ee/api/groups.html#list-groups
+//
+// v4 lists all visible groups by default, membership is requested via min_access_level,
+// v3 lists groups where user is a member and ignores the parameter.
+func (c *Client) GetGroupList(ctx context.Context) ([]*Group, error) {
+	pageList, err := c.executeAPIMethod(ctx, "GetGroupList", "groups?min_access_level=10")
+	if err != nil {
+		return nil, err
+	}
+
+	groupList := make([]*Group, 0)
+	for _, body := range pageList {
+		page := make([]*Group, 0)
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+
+		groupList = append(groupList, page...)
+	}
+
+	return groupList, nil
+}
+
 // @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/projects.md#list-projects
 // https://docs.gitlab.com/ee/api/projects.html#list-projects
 //
-func (c *Client) GetProjectList() ([]*Project, error) {
+func (c *Client) GetProjectList(ctx context.Context) ([]*Project, error) {
 
 	endpoint := "projects"
-	pageList, err := c.executeAPIMethod(endpoint)
+	pageList, err := c.executeAPIMethod(ctx, "GetProjectList", endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -35,10 +103,10 @@ func (c *Client) GetProjectList() ([]*Project, error) {
 // @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/projects.md#get-single-project
 // @see https://docs.gitlab.com/ee/api/projects.html#get-single-project
 //
-func (c *Client) GetProjectById(projectId int) (*Project, error) {
+func (c *Client) GetProjectById(ctx context.Context, projectId int) (*Project, error) {
 	endpoint := fmt.Sprintf("projects/%d", projectId)
 
-	pageList, err := c.executeAPIMethod(endpoint)
+	pageList, err := c.executeAPIMethod(ctx, "GetProjectById", endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +123,42 @@ func (c *Client) GetProjectById(projectId int) (*Project, error) {
 	return result, nil
 }
 
+// @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/projects.md#get-single-project
+// @see https://docs.gitlab.com/ee/api/projects.html#get-single-project
+//
+// Project is requested by url-encoded "namespace/project" path instead of id.
+//
+func (c *Client) GetProjectByPath(ctx context.Context, pathWithNamespace string) (*Project, error) {
+	endpoint := fmt.Sprintf("projects/%s", url.QueryEscape(pathWithNamespace))
+
+	pageList, err := c.executeAPIMethod(ctx, "GetProjectByPath", endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pageList) == 0 {
+		return nil, errors.New("No such project")
+	}
+
+	result := &Project{}
+	if err := json.Unmarshal(pageList[0], result); err != nil {
+		return nil, err
+	}
+
+	if result.PathWithNamespace != pathWithNamespace {
+		return nil, errors.New("No such project")
+	}
+
+	return result, nil
+}
+
 // @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/tags.md#list-project-repository-tags
 // @see https://docs.gitlab.com/ee/api/tags.html#list-project-repository-tags
 //
-func (c *Client) GetTagList(project *Project) ([]*Tag, error) {
+func (c *Client) GetTagList(ctx context.Context, project *Project) ([]*Tag, error) {
 	endpoint := fmt.Sprintf("projects/%d/repository/tags", project.ID)
 
-	pageList, err := c.executeAPIMethod(endpoint)
+	pageList, err := c.executeAPIMethod(ctx, "GetTagList", endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -82,14 +179,14 @@ func (c *Client) GetTagList(project *Project) ([]*Tag, error) {
 // @see https://gitlab.com/gitlab-org/gitlab-ce/blob/8-5-stable/doc/api/repositories.md#get-file-archive
 // @see https://docs.gitlab.com/ee/api/repositories.html#get-file-archive
 //
-func (c *Client) GetArchive(project *Project, ref string) ([]byte, error) {
+func (c *Client) GetArchive(ctx context.Context, project *Project, ref string) ([]byte, error) {
 	endpoint := fmt.Sprintf(
 		"projects/%d/repository/archive.tar.gz?sha=%s",
 		project.ID,
 		url.QueryEscape(ref),
 	)
 
-	pageList, err := c.executeAPIMethod(endpoint)
+	pageList, err := c.executeAPIMethod(ctx, "GetArchive", endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +210,7 @@ func (c *Client) GetArchive(project *Project, ref string) ([]byte, error) {
 // To maintain compatibility between all v3, v4-pre and v4 versions,
 // one extra HEAD request should be executed.
 //
-func (c *Client) GetFile(project *Project, path, ref string) ([]byte, error) {
+func (c *Client) GetFile(ctx context.Context, project *Project, path, ref string) ([]byte, error) {
 	var endpoint string
 
 	// v3 and v4:legacy method for accessing files
@@ -126,7 +223,10 @@ func (c *Client) GetFile(project *Project, path, ref string) ([]byte, error) {
 
 	if c.HasV4Support {
 		// check broken v4 api
-		r, _ := c.executeHead(endpoint)
+		r, err := c.executeHead(ctx, "GetFile", endpoint)
+		if err != nil {
+			return nil, err
+		}
 		if r.StatusCode() != 200 {
 			// ok, gitlab has correct v4 support
 			endpoint = fmt.Sprintf(
@@ -138,7 +238,7 @@ func (c *Client) GetFile(project *Project, path, ref string) ([]byte, error) {
 		}
 	}
 
-	pageList, err := c.executeAPIMethod(endpoint)
+	pageList, err := c.executeAPIMethod(ctx, "GetFile", endpoint)
 	if err != nil {
 		return nil, err
 	}
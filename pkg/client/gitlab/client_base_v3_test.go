@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
@@ -18,12 +19,12 @@ func TestGitLabClient_V3_ProjectList(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	projectList, err := client.GetProjectList()
+	projectList, err := client.GetProjectList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -58,12 +59,12 @@ func TestGitLabClient_V3_ProjectListPagination(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	projectList, err := client.GetProjectList()
+	projectList, err := client.GetProjectList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,12 +88,12 @@ func TestGitLabClient_V3_GetProjectById(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	project, err := client.GetProjectById(4)
+	project, err := client.GetProjectById(context.Background(), 4)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,12 +114,12 @@ func TestGitLabClient_V3_GetProjectById_Error(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	project, err := client.GetProjectById(4)
+	project, err := client.GetProjectById(context.Background(), 4)
 
 	assert.Error(t, err)
 	assert.Nil(t, project)
@@ -136,12 +137,12 @@ func TestGitLabClient_V3_ProjectList_Error(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	projectList, err := client.GetProjectList()
+	projectList, err := client.GetProjectList(context.Background())
 
 	assert.Error(t, err)
 	assert.Nil(t, projectList)
@@ -160,12 +161,12 @@ func TestGitLabClient_V3_ProjectList_Redirect(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	projectList, err := client.GetProjectList()
+	projectList, err := client.GetProjectList(context.Background())
 
 	assert.Error(t, err)
 	assert.Nil(t, projectList)
@@ -183,7 +184,7 @@ func TestGitLabClient_V3_GetTagList(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,7 +193,7 @@ func TestGitLabClient_V3_GetTagList(t *testing.T) {
 		ID: 4,
 	}
 
-	tagList, err := client.GetTagList(project)
+	tagList, err := client.GetTagList(context.Background(), project)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -213,7 +214,7 @@ func TestGitLabClient_V3_GetTagList_Error(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -222,7 +223,7 @@ func TestGitLabClient_V3_GetTagList_Error(t *testing.T) {
 		ID: 4,
 	}
 
-	tagList, err := client.GetTagList(project)
+	tagList, err := client.GetTagList(context.Background(), project)
 
 	assert.Error(t, err)
 	assert.Nil(t, tagList)
@@ -237,7 +238,7 @@ func TestGitLabClient_V3_GetFile(t *testing.T) {
 	})
 	defer ts.Close()
 
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -246,7 +247,61 @@ func TestGitLabClient_V3_GetFile(t *testing.T) {
 		ID: 4,
 	}
 
-	fileContent, err := client.GetFile(project, "README.md", "master")
+	fileContent, err := client.GetFile(context.Background(), project, "README.md", "master")
 	assert.Nil(t, err)
 	assert.Equal(t, []byte("Hello world"), fileContent)
 }
+
+func TestGitLabClient_V3_GetCurrentUser(t *testing.T) {
+	ts := createTestGitLabAPIV3(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/api/v3/user" {
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/user/item_v3.json"))
+		}
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := client.GetCurrentUser(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, "john_smith", user.Username)
+	assert.Equal(t, "john@example.com", user.Email)
+}
+
+func TestGitLabClient_V3_GetGroupList(t *testing.T) {
+	ts := createTestGitLabAPIV3(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/groups" {
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/group/list_v3.json"))
+		}
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groupList, err := client.GetGroupList(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, groupList, 1)
+	assert.Equal(t, "foo-bar", groupList[0].Path)
+	assert.Equal(t, "", groupList[0].FullPath)
+}
@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"testing"
@@ -18,12 +19,12 @@ func TestGitLabClient_V4_ProjectList(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	projectList, err := client.GetProjectList()
+	projectList, err := client.GetProjectList(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,12 +48,12 @@ func TestGitLabClient_V4_GetProjectById(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	project, err := client.GetProjectById(4)
+	project, err := client.GetProjectById(context.Background(), 4)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -73,7 +74,7 @@ func TestGitLabClient_V4_GetTagList(t *testing.T) {
 	//
 	// test start
 	//
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,7 +83,7 @@ func TestGitLabClient_V4_GetTagList(t *testing.T) {
 		ID: 4,
 	}
 
-	tagList, err := client.GetTagList(project)
+	tagList, err := client.GetTagList(context.Background(), project)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -90,3 +91,107 @@ func TestGitLabClient_V4_GetTagList(t *testing.T) {
 	assert.Len(t, tagList, 1)
 	assert.Equal(t, "v1.0.0", tagList[0].Name)
 }
+
+func TestGitLabClient_V4_GetProjectByPath(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/api/v4/projects/diaspora%2Fdiaspora-client" {
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/project/item_v4.json"))
+		}
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := client.GetProjectByPath(context.Background(), "diaspora/diaspora-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 4, project.ID)
+	assert.Equal(t, "diaspora/diaspora-client", project.PathWithNamespace)
+}
+
+func TestGitLabClient_V4_GetProjectByPath_Error(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"404 Project Not Found"}`))
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := client.GetProjectByPath(context.Background(), "diaspora/diaspora-client")
+
+	assert.Error(t, err)
+	assert.Nil(t, project)
+}
+
+func TestGitLabClient_V4_GetCurrentUser(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/api/v4/user" {
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/user/item_v4.json"))
+		}
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := client.GetCurrentUser(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, "john_smith", user.Username)
+	assert.Equal(t, "john@example.com", user.Email)
+}
+
+func TestGitLabClient_V4_GetGroupList(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/groups" {
+			assert.Equal(t, "10", r.URL.Query().Get("min_access_level"))
+
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/group/list_v4.json"))
+		}
+	})
+	defer ts.Close()
+
+	//
+	// test start
+	//
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groupList, err := client.GetGroupList(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, groupList, 2)
+	assert.Equal(t, "foo-bar", groupList[0].FullPath)
+	assert.Equal(t, "backend", groupList[1].Path)
+	assert.Equal(t, "foo-bar/backend", groupList[1].FullPath)
+}
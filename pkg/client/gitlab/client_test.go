@@ -1,13 +1,17 @@
 package gitlab
 
 import (
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -15,6 +19,12 @@ var (
 	testClientTokenInvalid = "invalid-token"
 )
 
+func TestMain(m *testing.M) {
+	// keep retries of failing requests fast
+	RetryBaseDelay = time.Millisecond
+	os.Exit(m.Run())
+}
+
 func TestNewClient_InvalidEndpoint(t *testing.T) {
 	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
@@ -23,7 +33,7 @@ func TestNewClient_InvalidEndpoint(t *testing.T) {
 	defer ts.Close()
 
 	// run test
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 
 	assert.Error(t, err)
 	assert.Nil(t, client)
@@ -34,7 +44,7 @@ func TestNewClient_V3_InvalidToken(t *testing.T) {
 	defer ts.Close()
 
 	// run test
-	client, err := NewClient(ts.URL, testClientTokenInvalid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenInvalid)
 
 	assert.Error(t, err)
 	assert.Nil(t, client)
@@ -45,7 +55,7 @@ func TestNewClient_V3(t *testing.T) {
 	defer ts.Close()
 
 	// run test
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, client)
@@ -59,7 +69,7 @@ func TestNewClient_V4_InvalidToken(t *testing.T) {
 	defer ts.Close()
 
 	// run test
-	client, err := NewClient(ts.URL, testClientTokenInvalid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenInvalid)
 
 	assert.Error(t, err)
 	assert.Nil(t, client)
@@ -70,7 +80,7 @@ func TestNewClient_V4(t *testing.T) {
 	defer ts.Close()
 
 	// run test
-	client, err := NewClient(ts.URL, testClientTokenValid)
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, client)
@@ -79,6 +89,221 @@ func TestNewClient_V4(t *testing.T) {
 	assert.Equal(t, "/api/v4", client.APIPrefix)
 }
 
+func TestPing(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, nil)
+	defer ts.Close()
+
+	assert.Nil(t, Ping(context.Background(), ts.URL))
+}
+
+func TestPing_Error(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer ts.Close()
+
+	assert.Error(t, Ping(context.Background(), ts.URL))
+}
+
+func TestClient_ContextCancelled(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		// simulate hung GitLab
+		<-r.Context().Done()
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	projectList, err := client.GetProjectList(ctx)
+
+	assert.Error(t, err)
+	assert.Nil(t, projectList)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestClient_RequestTimeout(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		// simulate hung GitLab
+		<-r.Context().Done()
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaultTimeout, defaultRetries := RequestTimeout, MaxRetries
+	RequestTimeout, MaxRetries = 50*time.Millisecond, 0
+	defer func() {
+		RequestTimeout, MaxRetries = defaultTimeout, defaultRetries
+	}()
+
+	start := time.Now()
+	projectList, err := client.GetProjectList(context.Background())
+
+	assert.Error(t, err)
+	assert.Nil(t, projectList)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestNewClientWithTokenType_OAuth(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testClientTokenValid || r.Header.Get("PRIVATE-TOKEN") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	// run test
+	client, err := NewClientWithTokenType(context.Background(), ts.URL, testClientTokenValid, TokenTypeOAuth)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+	assert.Equal(t, "/api/v4", client.APIPrefix)
+}
+
+func TestNewClientWithTokenType_OAuthFallback(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testClientTokenValid || r.Header.Get("PRIVATE-TOKEN") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == "GET" && r.URL.Path == "/api/v4/user" {
+			w.Write(getTestRawDataFromFile(t, "./test-data/user/item_v4.json"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	// OAuth token sent by client as bearer token is rejected as PRIVATE-TOKEN
+	client, err := NewClientWithTokenType(context.Background(), ts.URL, testClientTokenValid, TokenTypePersonal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, TokenTypeOAuth, client.TokenType)
+	assert.Equal(t, "/api/v4", client.APIPrefix)
+
+	user, err := client.GetCurrentUser(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, user)
+
+	// invalid token is rejected with both headers
+	client, err = NewClientWithTokenType(context.Background(), ts.URL, testClientTokenInvalid, TokenTypePersonal)
+	assert.Equal(t, ErrGitLabInvalidToken, err)
+	assert.Nil(t, client)
+}
+
+func TestNewClientWithTokenType_Job(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("JOB-TOKEN") != testClientTokenValid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// job token is not allowed to access anything except job
+		if r.Method != "GET" || r.URL.Path != "/api/v4/job" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(getTestRawDataFromFile(t, "./test-data/job/item_v4.json"))
+	})
+	defer ts.Close()
+
+	// run test
+	client, err := NewClientWithTokenType(context.Background(), ts.URL, testClientTokenInvalid, TokenTypeJob)
+
+	assert.Equal(t, ErrGitLabInvalidToken, err)
+	assert.Nil(t, client)
+
+	client, err = NewClientWithTokenType(context.Background(), ts.URL, testClientTokenValid, TokenTypeJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := client.GetCurrentJob(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 8, job.ID)
+	assert.Equal(t, "john_smith", job.User.Username)
+}
+
+func TestNewClientWithSudo(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != testClientTokenValid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// only admin token is allowed to act on behalf of known user
+		if r.Header.Get("Sudo") != "john_smith" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	// run test
+	client, err := NewClientWithSudo(context.Background(), ts.URL, testClientTokenValid, "jane_doe")
+
+	assert.Equal(t, ErrGitLabSudoDenied, err)
+	assert.Nil(t, client)
+
+	client, err = NewClientWithSudo(context.Background(), ts.URL, testClientTokenValid, "john_smith")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/v4", client.APIPrefix)
+	assert.Contains(t, client.String(), "john_smith")
+}
+
+func TestCheckRepositoryAccess(t *testing.T) {
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "gitlab+deploy-token-1" || password != testClientTokenValid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/devops/packages.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	// run test
+	err := CheckRepositoryAccess(context.Background(), ts.URL, "devops/packages", "gitlab+deploy-token-1", testClientTokenValid)
+	assert.Nil(t, err)
+
+	err = CheckRepositoryAccess(context.Background(), ts.URL, "devops/packages", "gitlab+deploy-token-1", testClientTokenInvalid)
+	assert.Equal(t, ErrGitLabInvalidToken, err)
+
+	err = CheckRepositoryAccess(context.Background(), ts.URL, "devops/secret", "gitlab+deploy-token-1", testClientTokenValid)
+	assert.Equal(t, ErrGitLabInvalidToken, err)
+}
+
 func createTestGitLabAPIV3(t *testing.T, fn http.HandlerFunc) *httptest.Server {
 	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("PRIVATE-TOKEN")
@@ -183,3 +408,17 @@ func getTestRawDataFromFile(t *testing.T, filename string) []byte {
 
 	return data
 }
+
+func TestClient_String(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, nil)
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// token should never be dumped
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v", client, client, client), testClientTokenValid)
+	assert.Contains(t, client.String(), ts.URL)
+}
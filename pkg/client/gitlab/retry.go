@@ -0,0 +1,224 @@
+package gitlab
+
+// Retries and rate limiting for GitLab API calls
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"gopkg.in/resty.v0"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// shared between all clients, so whole Pavlik instance
+	// slows down instead of tripping GitLab rate limiter
+	rateLimiter struct {
+		lock        *sync.Mutex
+		next        time.Time // earliest time for next request
+		pausedUntil time.Time // GitLab asked to back off
+	}
+)
+
+var (
+	// MaxRetries - number of retries for failed idempotent requests
+	MaxRetries = 3
+
+	// RetryBaseDelay - initial backoff delay, doubled on each retry
+	RetryBaseDelay = 200 * time.Millisecond
+
+	// RetryMaxDelay - backoff delay limit
+	RetryMaxDelay = 10 * time.Second
+
+	// RateLimit - maximum number of requests per second to GitLab, 0 - unlimited
+	RateLimit = 0.0
+
+	// RateLimitLowWatermark - when GitLab reports less remaining requests,
+	// requests are spread evenly until rate limit window is reset
+	RateLimitLowWatermark = 50
+
+	limiter = &rateLimiter{
+		lock: new(sync.Mutex),
+	}
+)
+
+//
+// Execute idempotent request, retry on network errors and
+// on responses which may succeed later (429, 502, 503, 504).
+// Response is never returned along with error, so callers
+// should always check error before reading response.
+//
+func (c *Client) execute(ctx context.Context, method, httpMethod, requestURL string) (*resty.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.executeOnce(ctx, method, httpMethod, requestURL)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		limiter.update(resp)
+		if attempt >= MaxRetries || !shouldRetry(resp, err) {
+			if err != nil {
+				return nil, err
+			}
+
+			return resp, nil
+		}
+
+		delay := getRetryDelay(attempt, resp)
+		log.Printf("==> Notice: GitLab %s failed (attempt %d), retrying in %s", method, attempt+1, delay)
+		metrics.GitLabRetriesTotal.Inc(method)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// request may succeed if repeated later
+func shouldRetry(resp *resty.Response, err error) bool {
+	if err != nil || resp == nil {
+		return true
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// exponential backoff with full jitter, Retry-After header takes precedence
+func getRetryDelay(attempt int, resp *resty.Response) time.Duration {
+	if retryAfter := getRetryAfter(resp); retryAfter > 0 {
+		return retryAfter
+	}
+
+	delay := RetryBaseDelay << uint(attempt)
+	if delay <= 0 || delay > RetryMaxDelay {
+		delay = RetryMaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(delay))) + time.Millisecond
+}
+
+// parse Retry-After header, both delay-seconds and HTTP-date formats are supported
+func getRetryAfter(resp *resty.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	raw := resp.Header().Get("Retry-After")
+	if raw == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(raw); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// block until request is allowed by rate limiter
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.lock.Lock()
+	now := time.Now()
+	start := now
+	if l.pausedUntil.After(start) {
+		start = l.pausedUntil
+	}
+	if l.next.After(start) {
+		start = l.next
+	}
+
+	// reserve slot for current request
+	if RateLimit > 0 {
+		l.next = start.Add(time.Duration(float64(time.Second) / RateLimit))
+	}
+	l.lock.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// adjust limiter according to GitLab rate limit headers
+//
+// @see https://docs.gitlab.com/ee/user/admin_area/settings/user_and_ip_rate_limits.html#response-headers
+//
+func (l *rateLimiter) update(resp *resty.Response) {
+	if resp == nil {
+		return
+	}
+
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		pause := getRetryAfter(resp)
+		if pause <= 0 {
+			pause = RetryBaseDelay
+		}
+		if until := now.Add(pause); until.After(l.pausedUntil) {
+			l.pausedUntil = until
+		}
+		return
+	}
+
+	remaining, err := strconv.Atoi(resp.Header().Get("RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetEpoch, err := strconv.ParseInt(resp.Header().Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	reset := time.Unix(resetEpoch, 0)
+	if !reset.After(now) {
+		return
+	}
+
+	switch {
+	case remaining <= 0:
+		// budget is exhausted, wait for the next window
+		if reset.After(l.pausedUntil) {
+			l.pausedUntil = reset
+		}
+
+	case remaining < RateLimitLowWatermark:
+		// spread remaining requests until the end of the window
+		spacing := reset.Sub(now) / time.Duration(remaining+1)
+		if next := now.Add(spacing); next.After(l.next) {
+			l.next = next
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package gitlab
+
+import (
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_RetryOnServiceUnavailable(t *testing.T) {
+	attempts := 0
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects" {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/project/list_v4.json"))
+		}
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projectList, err := client.GetProjectList(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, projectList, 2)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestClient_NoRetryOnNotFound(t *testing.T) {
+	attempts := 0
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects/4" {
+			attempts++
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 Project Not Found"}`))
+		}
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := client.GetProjectById(context.Background(), 4)
+
+	assert.Equal(t, ErrGitLabNotFound, err)
+	assert.Nil(t, project)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	attempts := 0
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects" {
+			attempts++
+			if attempts == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write(getTestRawDataFromFile(t, "./test-data/project/list_v4.json"))
+		}
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	projectList, err := client.GetProjectList(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, projectList, 2)
+	assert.Equal(t, 2, attempts)
+	assert.True(t, time.Since(start) >= time.Second)
+}
+
+func TestRateLimiter_Exhausted(t *testing.T) {
+	l := &rateLimiter{
+		lock: new(sync.Mutex),
+	}
+
+	ts := createTestHttpServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))
+		w.WriteHeader(http.StatusOK)
+	})
+	defer ts.Close()
+
+	client := &Client{
+		Endpoint: ts.URL,
+	}
+
+	resp, err := client.executeOnce(context.Background(), "Test", "GET", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.update(resp)
+
+	// budget is exhausted, limiter should block until context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, l.wait(ctx))
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	l := &rateLimiter{
+		lock: new(sync.Mutex),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, l.wait(ctx))
+	}
+}
+
+func TestClient_GetFile_Cancelled(t *testing.T) {
+	started := make(chan struct{}, 1)
+	ts := createTestGitLabAPIV4(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v4/projects/1/repository/files" {
+			started <- struct{}{}
+			<-r.Context().Done()
+		}
+	})
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fetch is shared with other callers and cancelled when last caller is gone
+	g := helpers.NewFlightGroup()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err = g.Do(ctx, "file_1_master_package.json", func(ctx context.Context) (interface{}, error) {
+		content, err := client.GetFile(ctx, &Project{ID: 1}, "package.json", "master")
+		assert.Equal(t, context.Canceled, err)
+		assert.Nil(t, content)
+
+		return content, err
+	})
+
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestClient_GetFile_CancelledByRateLimiter(t *testing.T) {
+	ts := createTestGitLabAPIV4(t, nil)
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), ts.URL, testClientTokenValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GitLab asked to back off, request is waiting for rate limiter
+	limiter.lock.Lock()
+	pausedUntil := limiter.pausedUntil
+	limiter.pausedUntil = time.Now().Add(time.Hour)
+	limiter.lock.Unlock()
+	defer func() {
+		limiter.lock.Lock()
+		limiter.pausedUntil = pausedUntil
+		limiter.lock.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	content, err := client.GetFile(ctx, &Project{ID: 1}, "package.json", "master")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, content)
+}
@@ -1,5 +1,9 @@
 package gitlab
 
+import (
+	"time"
+)
+
 type (
 	Project struct {
 		ID                int      `json:"id"`
@@ -12,7 +16,8 @@ type (
 	}
 
 	commitInlined struct {
-		ID string `json:"id"`
+		ID            string    `json:"id"`
+		CommittedDate time.Time `json:"committed_date"`
 	}
 
 	Tag struct {
@@ -20,6 +25,29 @@ type (
 		Commit commitInlined `json:"commit"`
 	}
 
+	User struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		State    string `json:"state"`
+	}
+
+	// CI job owning job token
+	Job struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+		Ref  string `json:"ref"`
+		User User   `json:"user"`
+	}
+
+	Group struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Path     string `json:"path"`
+		FullPath string `json:"full_path"` // v4 only, includes parent groups
+	}
+
 	File struct {
 		Content  string `json:"content"`
 		Encoding string `json:"encoding"`
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestUnmarshalProjectV4(t *testing.T) {
@@ -33,4 +34,5 @@ func TestUnmarshalTagV4(t *testing.T) {
 
 	assert.Equal(t, "v1.0.0", tag.Name)
 	assert.Equal(t, "48bfe316395305d02af3f4b8bb9dec62d8e4c567", tag.Commit.ID)
+	assert.Equal(t, "2017-03-21T12:56:30Z", tag.Commit.CommittedDate.UTC().Format(time.RFC3339))
 }
@@ -0,0 +1,151 @@
+package client
+
+// Liveness and readiness checks
+
+import (
+	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type (
+	// HealthReport - result of all checks
+	HealthReport struct {
+		Status string                  `json:"status"`
+		Checks map[string]*HealthCheck `json:"checks"`
+	}
+
+	// HealthCheck - result of single check
+	HealthCheck struct {
+		Status   string `json:"status"` // "ok" or "fail"
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
+	}
+)
+
+var (
+	healthStatusOk   = "ok"
+	healthStatusFail = "fail"
+
+	errServiceTokenNotConfigured = errors.New("GITLAB_SERVICE_TOKEN is not configured")
+
+	// readiness report is reused for a short time, so frequent probes
+	// of several orchestrators don't hit GitLab on every request
+	readinessTTL    = 10 * time.Second
+	readinessLock   = new(sync.Mutex)
+	readinessReport *HealthReport
+	readinessExpire time.Time
+)
+
+// GetLivenessReport - process is alive as long as it able to respond
+func GetLivenessReport() *HealthReport {
+	return &HealthReport{
+		Status: healthStatusOk,
+		Checks: make(map[string]*HealthCheck, 0),
+	}
+}
+
+// GetReadinessReport - check everything required to serve packages:
+//
+//  * GitLab is reachable
+//  * GitLab API version can be detected with service token
+//  * repository with repoList.json is accessible with service token
+//  * cache directory is writable
+//
+// Checks requiring service token fail when it's not configured, as packages
+// can't be proven reachable. Report is cached for readinessTTL.
+func GetReadinessReport(ctx context.Context) *HealthReport {
+	readinessLock.Lock()
+	defer readinessLock.Unlock()
+
+	if readinessReport != nil && readinessExpire.After(time.Now()) {
+		return readinessReport
+	}
+
+	report := checkReadiness(ctx)
+
+	// report of cancelled probe is not reused
+	if ctx.Err() == nil {
+		readinessReport = report
+		readinessExpire = time.Now().Add(readinessTTL)
+	}
+
+	return report
+}
+
+// IsOk - all checks are passed
+func (r *HealthReport) IsOk() bool {
+	return r.Status == healthStatusOk
+}
+
+//
+// Private API
+//
+
+// run all readiness checks
+func checkReadiness(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Status: healthStatusOk,
+		Checks: make(map[string]*HealthCheck, 0),
+	}
+
+	var driver *gitlab.Client
+
+	report.run("gitlab", func() error {
+		return gitlab.Ping(ctx, baseURL)
+	})
+
+	report.run("api_version", func() error {
+		if serviceToken == "" {
+			return errServiceTokenNotConfigured
+		}
+
+		var err error
+		driver, err = gitlab.NewClient(ctx, baseURL, serviceToken)
+		return err
+	})
+
+	report.run("container_repo", func() error {
+		if serviceToken == "" {
+			return errServiceTokenNotConfigured
+		}
+		if driver == nil {
+			return errors.New("GitLab API is not available")
+		}
+
+		project, err := driver.GetProjectByPath(ctx, repoPathWithNamespace)
+		if err != nil {
+			return err
+		}
+
+		_, err = driver.GetFile(ctx, project, repoListJsonFile, "master")
+		return err
+	})
+
+	report.run("cache_dir", helpers.CheckCacheDir)
+	report.run("snapshot_dir", helpers.CheckSnapshotDir)
+
+	return report
+}
+
+// execute check and store result in report
+func (r *HealthReport) run(name string, fn func() error) {
+	start := time.Now()
+	err := fn()
+
+	check := &HealthCheck{
+		Status:   healthStatusOk,
+		Duration: time.Since(start).String(),
+	}
+
+	if err != nil {
+		check.Status = healthStatusFail
+		check.Error = err.Error()
+		r.Status = healthStatusFail
+	}
+
+	r.Checks[name] = check
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/tokens"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type (
+	// owner of verified job or deploy token
+	cachedTokenOwner struct {
+		Expire time.Time
+		User   *gitlab.User
+	}
+)
+
+var (
+	// ErrServiceTokenRequired - GITLAB_SERVICE_TOKEN is not configured
+	ErrServiceTokenRequired = errors.New("GITLAB_SERVICE_TOKEN is required")
+
+	// usernames GitLab expects for git over HTTP, same are used to detect token type
+	jobTokenUsername          = "gitlab-ci-token"
+	oauthTokenUsername        = "oauth2"
+	deployTokenUsernamePrefix = "gitlab+deploy-token"
+	issuedTokenUsernamePrefix = "pavlik+"
+
+	// token prefixes, optional for job tokens
+	jobTokenPrefix    = "glcbt-"
+	deployTokenPrefix = "gldt-"
+)
+
+// NewConnectionFromIssuedToken - create new GitLabConnection for a token issued by Pavlik,
+// GitLab is accessed with service token, packages are limited by token scope.
+func NewConnectionFromIssuedToken(ctx context.Context, t *tokens.Token) (*GitLabConnection, error) {
+	if serviceToken == "" {
+		log.Printf("==> Notice: GITLAB_SERVICE_TOKEN is required for issued tokens")
+		return nil, gitlab.ErrGitLabInvalidToken
+	}
+
+	driver, err := gitlab.NewClient(ctx, baseURL, serviceToken)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &GitLabConnection{
+		tokenKey:   helpers.GetTokenKey(serviceToken),
+		tokenUser:  &gitlab.User{Username: issuedTokenUsernamePrefix + t.Name},
+		tokenScope: t,
+		client:     driver,
+	}
+	return c, nil
+}
+
+// NewConnectionFromServiceToken - create new GitLabConnection with service token,
+// used by admin API, which is not authorized by GitLab token.
+func NewConnectionFromServiceToken(ctx context.Context) (*GitLabConnection, error) {
+	if serviceToken == "" {
+		return nil, ErrServiceTokenRequired
+	}
+
+	return newConnection(ctx, serviceToken, gitlab.TokenTypePersonal)
+}
+
+//
+// Private API
+//
+
+// detect token type by basic authorization username or token prefix,
+// any other token is considered as personal access token.
+func getTokenType(username, token string) string {
+	switch {
+	case username == jobTokenUsername || strings.HasPrefix(token, jobTokenPrefix):
+		return gitlab.TokenTypeJob
+
+	case strings.HasPrefix(username, deployTokenUsernamePrefix) || strings.HasPrefix(token, deployTokenPrefix):
+		return gitlab.TokenTypeDeploy
+
+	case username == oauthTokenUsername:
+		return gitlab.TokenTypeOAuth
+	}
+
+	return gitlab.TokenTypePersonal
+}
+
+// create connection for job or deploy token, such tokens can't list projects
+// or read files via API, so token is verified by reading packages repository
+// over git and service token is used for everything else:
+//   * job token acts on behalf of user running the pipeline (service token
+//     should be admin token with "sudo" scope), so only packages and groups
+//     visible for that user are available
+//   * deploy token is not a GitLab user, so only deploy tokens listed in
+//     PAVLIK_DEPLOY_TOKEN_USERS are allowed, they see packages visible for service token
+func newServiceConnection(ctx context.Context, username, token, tokenType string) (*GitLabConnection, error) {
+	if serviceToken == "" {
+		log.Printf("==> Notice: GITLAB_SERVICE_TOKEN is required for %s tokens", tokenType)
+		return nil, gitlab.ErrGitLabInvalidToken
+	}
+
+	if tokenType == gitlab.TokenTypeDeploy && !hasName(deployTokenUserList, username) {
+		log.Printf("==> Notice: deploy token %s is not listed in PAVLIK_DEPLOY_TOKEN_USERS", username)
+		return nil, gitlab.ErrGitLabInvalidToken
+	}
+
+	user, err := getTokenOwner(ctx, username, token, tokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenType == gitlab.TokenTypeJob {
+		driver, err := gitlab.NewClientWithSudo(ctx, baseURL, serviceToken, user.Username)
+		if err == gitlab.ErrGitLabSudoDenied {
+			log.Printf("==> Notice: GITLAB_SERVICE_TOKEN should be admin token with sudo scope for job tokens")
+			return nil, gitlab.ErrGitLabInvalidToken
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// project list and identity are cached per user running the pipeline
+		c := &GitLabConnection{
+			tokenKey: helpers.GetTokenKey(serviceToken + ":sudo:" + user.Username),
+			client:   driver,
+		}
+		return c, nil
+	}
+
+	driver, err := gitlab.NewClient(ctx, baseURL, serviceToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// project list is shared with every connection using service token
+	c := &GitLabConnection{
+		tokenKey:  helpers.GetTokenKey(serviceToken),
+		tokenUser: user,
+		client:    driver,
+	}
+	return c, nil
+}
+
+// return cache key for owner of verified job or deploy token
+func getTokenOwnerCacheKey(token string) string {
+	return fmt.Sprintf("token_owner_%s", helpers.GetTokenKey(token))
+}
+
+// verify job or deploy token and get its owner, successful verification
+// is cached per token for a short time, job token is valid while job is running.
+func getTokenOwner(ctx context.Context, username, token, tokenType string) (*gitlab.User, error) {
+	cacheKey := getTokenOwnerCacheKey(token)
+	if item, ok := cacheGet(cacheKey); ok {
+		if owner, ok := item.(*cachedTokenOwner); ok && owner.Expire.After(time.Now()) {
+			return owner.User, nil
+		}
+
+		globalCache.Remove(cacheKey)
+	}
+
+	// deploy token is named after its username,
+	// job token is owned by user running the pipeline
+	user := &gitlab.User{Username: username}
+	if tokenType == gitlab.TokenTypeJob {
+		jobClient, err := gitlab.NewClientWithTokenType(ctx, baseURL, token, gitlab.TokenTypeJob)
+		if err != nil {
+			return nil, err
+		}
+
+		job, err := jobClient.GetCurrentJob(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		user = &job.User
+		username = jobTokenUsername
+	}
+
+	// job token access is limited by project allowlist of packages repository,
+	// deploy token should be created for packages repository
+	if err := gitlab.CheckRepositoryAccess(ctx, baseURL, repoPathWithNamespace, username, token); err != nil {
+		return nil, err
+	}
+
+	cacheAdd(cacheKey, &cachedTokenOwner{
+		Expire: time.Now().Add(5 * time.Minute),
+		User:   user,
+	})
+	return user, nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/helpers"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestGetTokenType(t *testing.T) {
+	testList := []struct {
+		name      string
+		header    string
+		tokenType string
+	}{
+		{
+			name:      "bearer personal or OAuth token, OAuth is detected by GitLab client",
+			header:    "Bearer secret",
+			tokenType: gitlab.TokenTypePersonal,
+		},
+		{
+			name:      "basic with any username",
+			header:    "Basic " + encodeTestCredentials("alice", "secret"),
+			tokenType: gitlab.TokenTypePersonal,
+		},
+		{
+			name:      "basic OAuth",
+			header:    "Basic " + encodeTestCredentials("oauth2", "secret"),
+			tokenType: gitlab.TokenTypeOAuth,
+		},
+		{
+			name:      "basic job token",
+			header:    "Basic " + encodeTestCredentials("gitlab-ci-token", "secret"),
+			tokenType: gitlab.TokenTypeJob,
+		},
+		{
+			name:      "bearer job token with prefix",
+			header:    "Bearer glcbt-secret",
+			tokenType: gitlab.TokenTypeJob,
+		},
+		{
+			name:      "basic deploy token",
+			header:    "Basic " + encodeTestCredentials("gitlab+deploy-token-1", "secret"),
+			tokenType: gitlab.TokenTypeDeploy,
+		},
+		{
+			name:      "bearer deploy token with prefix",
+			header:    "Bearer gldt-secret",
+			tokenType: gitlab.TokenTypeDeploy,
+		},
+	}
+
+	for _, test := range testList {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", test.header)
+
+		username, token := helpers.GetCredentialsFromRequest(r)
+		assert.Equal(t, test.tokenType, getTokenType(username, token), test.name)
+	}
+}
+
+//
+// Private API
+//
+
+// basic authorization credentials
+func encodeTestCredentials(username, password string) string {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth(username, password)
+
+	return r.Header.Get("Authorization")[len("Basic "):]
+}
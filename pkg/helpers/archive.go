@@ -4,10 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"comrade-pavlik2/pkg/cache"
+	"comrade-pavlik2/pkg/metrics"
+	"context"
 	"crypto/sha1"
 	"errors"
 	"fmt"
-	"github.com/hashicorp/golang-lru"
 	"github.com/jhoonb/archivex"
 	"github.com/satori/go.uuid"
 	"io"
@@ -19,19 +21,56 @@ import (
 )
 
 var (
-	globalCache, _ = lru.New(2048)
-	archiveTime    = time.Date(2016, time.October, 16, 23, 0, 0, 0, time.UTC)
+	globalCache   = cache.New("archive", 2048)
+	archiveFlight = NewFlightGroup() // in-flight repacks, keyed by cache keys
+	archiveTime   = time.Date(2016, time.October, 16, 23, 0, 0, 0, time.UTC)
+	cacheDir      = os.TempDir() // directory for temporary repack files
 )
 
+func init() {
+	if dir := os.Getenv("PAVLIK_CACHE_DIR"); dir != "" {
+		cacheDir = dir
+	}
+}
+
+// CheckCacheDir - make sure directory used for repacking archives exists and writable
+func CheckCacheDir() error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(cacheDir, "check_")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 //
-// Fetch .tgz version of npm archive stored in cache
+// Fetch .tgz version of npm archive stored in cache or frozen in snapshot
 //
 func GetNpmArchiveFromCache(repoUUID, repoRef string) ([]byte, error) {
-	cacheKey := fmt.Sprintf("archive_%s_%s", repoUUID, repoRef)
+	return getArchiveFromCache("npm", repoUUID, repoRef)
+}
+
+//
+// Fetch .zip version of composer archive stored in cache or frozen in snapshot
+//
+func GetComposerArchiveFromCache(repoUUID, repoRef string) ([]byte, error) {
+	return getArchiveFromCache("composer", repoUUID, repoRef)
+}
+
+// npm and composer archives share cache key format, kind is part of the key,
+// so zip and tgz of the same package version never collide
+func getArchiveFromCache(kind, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := getArchiveCacheKey(kind, repoUUID, repoRef)
 
 	if item, ok := globalCache.Get(cacheKey); ok {
 		if archive, ok := item.([]byte); ok {
 			log.Printf("Cache hit: archive-lru %s # %s", repoUUID, repoRef)
+			metrics.CacheHit("archive")
 			return archive, nil
 		} else {
 			globalCache.Remove(cacheKey)
@@ -39,6 +78,12 @@ func GetNpmArchiveFromCache(repoUUID, repoRef string) ([]byte, error) {
 		}
 	}
 
+	if repoRef != "master" {
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
 	return nil, fmt.Errorf("No cache found: archive-lru %s # %s", repoUUID, repoRef)
 }
 
@@ -55,7 +100,7 @@ func GetNpmArchiveFromCache(repoUUID, repoRef string) ([]byte, error) {
 // * cache final archive bytes
 // * return final archive bytes and calculated shasum
 //
-func PutNpmArchiveToCache(src []byte, repoUUID, repoRef string) ([]byte, string, error) {
+func PutNpmArchiveToCache(ctx context.Context, src []byte, repoUUID, repoRef string) ([]byte, string, error) {
 	// check in cache
 	if npmArchive, err := GetNpmArchiveFromCache(repoUUID, repoRef); err == nil {
 		log.Printf("Cache hit: archive-lru %s # %s", repoUUID, repoRef)
@@ -63,10 +108,43 @@ func PutNpmArchiveToCache(src []byte, repoUUID, repoRef string) ([]byte, string,
 	}
 
 	log.Printf("Cache miss: archive-lru %s # %s", repoUUID, repoRef)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	cacheKey := getArchiveCacheKey("npm", repoUUID, repoRef)
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		npmArchive, err := repackNpmArchive(src, repoUUID, repoRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// WARNING: *never* cache master ref
+		if repoRef != "master" {
+			if npmArchive, err = snapshotPut(cacheKey, npmArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, npmArchive)
+		}
+
+		return npmArchive, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	npmArchive := value.([]byte)
+	return npmArchive, fmt.Sprintf("%x", sha1.Sum(npmArchive)), nil
+}
+
+// repack GitLab archive into npm tgz archive
+func repackNpmArchive(src []byte, repoUUID, repoRef string) ([]byte, error) {
+	start := time.Now()
+	defer metrics.RepackDuration.ObserveSince(start, "tgz")
 
 	// define some properties
 	u := uuid.NewV4().String()
-	t := os.TempDir()
+	t := cacheDir
 
 	tarBeforeRenameDir := filepath.Join(t, fmt.Sprintf("dir_%s", u))
 	tarDestinationFile := filepath.Join(t, fmt.Sprintf("%s.tar", u))
@@ -74,64 +152,58 @@ func PutNpmArchiveToCache(src []byte, repoUUID, repoRef string) ([]byte, string,
 	tgzDestinationFile := filepath.Join(t, fmt.Sprintf("%s.tgz", u))
 
 	if err := unGzip(src, tarDestinationFile); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	tarArchive, err := getFileContents(tarDestinationFile)
 	os.Remove(tarDestinationFile)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if err := unTar(tarArchive, tarDestinationDir); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	//
 	files, err := ioutil.ReadDir(tarDestinationDir)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	if len(files) != 1 {
-		return nil, "", errors.New("Broken archive received from GitLab")
+		return nil, errors.New("Broken archive received from GitLab")
 	}
 
 	//
 	oldPath := filepath.Join(tarBeforeRenameDir, files[0].Name())
 	tarDestinationDir = filepath.Join(tarBeforeRenameDir, fmt.Sprintf("%s-%s", repoUUID, repoRef))
 	if err := os.Rename(oldPath, tarDestinationDir); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	err = makeTar(tarDestinationDir, tarDestinationFile)
 	os.RemoveAll(tarBeforeRenameDir)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	tarArchive, err = getFileContents(tarDestinationFile)
 	os.Remove(tarDestinationFile)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if err := makeGzip(tarArchive, tgzDestinationFile); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	npmArchive, err := getFileContents(tgzDestinationFile)
 	os.Remove(tgzDestinationFile)
 	if err != nil {
-		return nil, "", err
-	}
-
-	// WARNING: *never* cache master ref
-	if repoRef != "master" {
-		cacheKey := fmt.Sprintf("archive_%s_%s", repoUUID, repoRef)
-		globalCache.Add(cacheKey, npmArchive)
+		return nil, err
 	}
 
-	return npmArchive, fmt.Sprintf("%x", sha1.Sum(npmArchive)), nil
+	return npmArchive, nil
 }
 
 //
@@ -144,27 +216,64 @@ func PutNpmArchiveToCache(src []byte, repoUUID, repoRef string) ([]byte, string,
 //      * cache archive bytes
 //	* return zip archive bytes
 //
-func GetComposerArchive(src []byte, repoUUID, repoRef string) ([]byte, error) {
-	cacheKey := fmt.Sprintf("archive_%s_%s", repoUUID, repoRef)
+func GetComposerArchive(ctx context.Context, src []byte, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := getArchiveCacheKey("composer", repoUUID, repoRef)
 
 	// WARNING: *never* cache master ref
 	if repoRef != "master" {
 		if item, ok := globalCache.Get(cacheKey); ok {
 			if archive, ok := item.([]byte); ok {
 				log.Printf("Cache hit: archive-lru %s # %s", repoUUID, repoRef)
+				metrics.CacheHit("archive")
 				return archive, nil
 			} else {
 				globalCache.Remove(cacheKey)
 				return nil, fmt.Errorf("Cache broken: archive-lru %s # %s", repoUUID, repoRef)
 			}
 		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
 	}
 
 	log.Printf("Cache miss: archive-lru %s # %s", repoUUID, repoRef)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		composerArchive, err := repackComposerArchive(src, repoUUID, repoRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// WARNING: *don't even think* to put master ref into cache
+		if repoRef != "master" {
+			if composerArchive, err = snapshotPut(cacheKey, composerArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, composerArchive)
+		}
+
+		return composerArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// repack GitLab archive into composer zip archive
+func repackComposerArchive(src []byte, repoUUID, repoRef string) ([]byte, error) {
+	start := time.Now()
+	defer metrics.RepackDuration.ObserveSince(start, "zip")
 
 	// define some properties
 	u := uuid.NewV4().String()
-	t := os.TempDir()
+	t := cacheDir
 
 	tarBeforeRenameDir := filepath.Join(t, fmt.Sprintf("dir_%s", u))
 	tarDestinationFile := filepath.Join(t, fmt.Sprintf("%s.tar", u))
@@ -213,14 +322,21 @@ func GetComposerArchive(src []byte, repoUUID, repoRef string) ([]byte, error) {
 		return nil, err
 	}
 
-	// WARNING: *don't even think* to put master ref into cache
-	if repoRef != "master" {
-		globalCache.Add(cacheKey, composerArchive)
-	}
-
 	return composerArchive, nil
 }
 
+// return cache key for repacked npm or composer archive
+func getArchiveCacheKey(kind, repoUUID, repoRef string) string {
+	return fmt.Sprintf("%s-archive_%s_%s", kind, repoUUID, repoRef)
+}
+
+// put item into archive cache, keeping track of evictions
+func cacheAdd(key string, value interface{}) {
+	if evicted := globalCache.Add(key, value); evicted {
+		metrics.CacheEvictionsTotal.Inc("archive")
+	}
+}
+
 //
 func getFileContents(targetFile string) ([]byte, error) {
 	f, err := os.Open(targetFile)
@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// GetCrateName - file name of packaged crate
+func GetCrateName(name, version string) string {
+	return fmt.Sprintf("%s-%s.crate", name, version)
+}
+
+// GetCrateIndexPath - path of crate file in sparse index, which depends on name length:
+// "1/a", "2/ab", "3/a/abc" or "ab/cd/abcd" for longer names, always lowercase.
+func GetCrateIndexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return "1/" + name
+
+	case 2:
+		return "2/" + name
+
+	case 3:
+		return fmt.Sprintf("3/%s/%s", name[:1], name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", name[:2], name[2:4], name)
+}
+
+// GetCrateArchive - repack GitLab archive into packaged crate, the same way "cargo package" does:
+// all files are placed into "name-version/" directory, build output and nested packages are skipped.
+// Archive is reproducible, so checksum in sparse index is stable.
+func GetCrateArchive(ctx context.Context, src []byte, name, version, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := fmt.Sprintf("crate_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s@%s", name, version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s@%s", name, version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s@%s", name, version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		start := time.Now()
+		defer metrics.RepackDuration.ObserveSince(start, "crate")
+
+		fileList, err := readArchiveFiles(src)
+		if err != nil {
+			return nil, err
+		}
+
+		// directories with own Cargo.toml are separate packages
+		nestedPackageList := []string{"target/"}
+		for _, f := range fileList {
+			if dir := path.Dir(f.name); dir != "." && path.Base(f.name) == "Cargo.toml" {
+				nestedPackageList = append(nestedPackageList, dir+"/")
+			}
+		}
+
+		crateFileList := make([]archiveFile, 0)
+		for _, f := range fileList {
+			if !isCrateFileExcluded(f.name, nestedPackageList) {
+				crateFileList = append(crateFileList, f)
+			}
+		}
+
+		crateArchive, err := writeTarGz(crateFileList, fmt.Sprintf("%s-%s/", name, version))
+		if err != nil {
+			return nil, err
+		}
+
+		if repoRef != "master" {
+			if crateArchive, err = snapshotPut(cacheKey, crateArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, crateArchive)
+		}
+
+		return crateArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// check file should be excluded from packaged crate
+func isCrateFileExcluded(name string, nestedPackageList []string) bool {
+	for _, dir := range nestedPackageList {
+		if strings.HasPrefix(name, dir) {
+			return true
+		}
+	}
+
+	return false
+}
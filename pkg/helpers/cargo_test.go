@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetCrateIndexPath(t *testing.T) {
+	assert.Equal(t, "1/a", GetCrateIndexPath("a"))
+	assert.Equal(t, "2/ab", GetCrateIndexPath("ab"))
+	assert.Equal(t, "3/a/abc", GetCrateIndexPath("abc"))
+	assert.Equal(t, "ac/me/acme-core", GetCrateIndexPath("Acme-Core"))
+	assert.Equal(t, "acme-core-1.2.0.crate", GetCrateName("acme-core", "1.2.0"))
+}
+
+func TestGetCrateArchive(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"core-v1.2.0-48bfe31/Cargo.toml":           "[package]\nname = \"acme-core\"\n",
+		"core-v1.2.0-48bfe31/src/lib.rs":           "",
+		"core-v1.2.0-48bfe31/target/debug/libacme": "",
+		"core-v1.2.0-48bfe31/examples/Cargo.toml":  "[package]\nname = \"examples\"\n",
+		"core-v1.2.0-48bfe31/examples/src/main.rs": "",
+	})
+
+	archive, err := GetCrateArchive(context.Background(), src, "acme-core", "1.2.0", "48bfe31a", "master")
+	assert.Nil(t, err)
+
+	// archive should be reproducible
+	again, err := GetCrateArchive(context.Background(), src, "acme-core", "1.2.0", "48bfe31a", "master")
+	assert.Nil(t, err)
+	assert.Equal(t, archive, again)
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+
+	nameList := make([]string, 0)
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err != nil {
+			break
+		}
+		nameList = append(nameList, header.Name)
+	}
+
+	assert.Equal(t, []string{
+		"acme-core-1.2.0/Cargo.toml",
+		"acme-core-1.2.0/src/lib.rs",
+	}, nameList)
+}
@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetDurationFromEnv - parse duration (e.g. "30s", "5m") from environment variable,
+// default value is returned when variable is not set or malformed.
+func GetDurationFromEnv(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Printf("==> Notice: Invalid duration %s=%s, using %s", name, raw, def)
+		return def
+	}
+
+	return value
+}
+
+// GetIntFromEnv - parse non-negative integer from environment variable,
+// default value is returned when variable is not set or malformed.
+func GetIntFromEnv(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("==> Notice: Invalid number %s=%s, using %d", name, raw, def)
+		return def
+	}
+
+	return value
+}
+
+// GetListFromEnv - parse comma separated list from environment variable,
+// empty items are skipped.
+func GetListFromEnv(name string) []string {
+	return SplitList(os.Getenv(name))
+}
+
+// SplitList - split comma separated list, empty items are skipped
+func SplitList(raw string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,110 @@
+package helpers
+
+// In-flight deduplication of identical fetches
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+type (
+	// FlightGroup - concurrent calls with the same key share single execution,
+	// execution is cancelled only when every waiting caller is gone.
+	FlightGroup struct {
+		lock    *sync.Mutex
+		flights map[string]*flight
+	}
+
+	flight struct {
+		key     string
+		done    chan struct{}
+		cancel  context.CancelFunc
+		waiters int
+		value   interface{}
+		err     error
+	}
+)
+
+// NewFlightGroup - create new group
+func NewFlightGroup() *FlightGroup {
+	return &FlightGroup{
+		lock:    new(sync.Mutex),
+		flights: make(map[string]*flight, 0),
+	}
+}
+
+// Do - execute fn once for all concurrent callers with the same key.
+// fn receives context detached from any single caller, which is cancelled
+// when all callers contexts are done. Returned value is shared between callers.
+func (g *FlightGroup) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.lock.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.Background())
+		f = &flight{
+			key:    key,
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		g.flights[key] = f
+
+		go g.run(flightCtx, f, fn)
+	}
+	f.waiters++
+	g.lock.Unlock()
+
+	select {
+	case <-f.done:
+		g.leave(f)
+		return f.value, f.err
+
+	case <-ctx.Done():
+		g.leave(f)
+		return nil, ctx.Err()
+	}
+}
+
+// execute fn and wake up all waiters, fn runs outside of any request
+// handler, so panic is reported to waiters instead of crashing the server
+func (g *FlightGroup) run(ctx context.Context, f *flight, fn func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("==> WARNING: Fetch %s panicked: %v\n%s", f.key, r, debug.Stack())
+			f.value, f.err = nil, fmt.Errorf("Fetch failed: %v", r)
+		}
+
+		g.lock.Lock()
+		g.forget(f)
+		g.lock.Unlock()
+
+		f.cancel()
+		close(f.done)
+	}()
+
+	f.value, f.err = fn(ctx)
+}
+
+// caller is not waiting anymore, cancel execution if nobody else is waiting
+func (g *FlightGroup) leave(f *flight) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+
+	// cancelled flight shouldn't be joined by new callers
+	f.cancel()
+	g.forget(f)
+}
+
+// remove flight from group, lock should be held by caller
+func (g *FlightGroup) forget(f *flight) {
+	if g.flights[f.key] == f {
+		delete(g.flights, f.key)
+	}
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup_Do(t *testing.T) {
+	g := NewFlightGroup()
+	release := make(chan struct{})
+
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "archive", nil
+	}
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			value, err := g.Do(context.Background(), "archive_uuid_ref", fn)
+			assert.Nil(t, err)
+			assert.Equal(t, "archive", value)
+		}()
+	}
+
+	// let all callers join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFlightGroup_CancelledWhenAllWaitersGone(t *testing.T) {
+	g := NewFlightGroup()
+	cancelled := make(chan struct{})
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+
+	wg := new(sync.WaitGroup)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+
+			_, err := g.Do(ctx, "archive_uuid_ref", fn)
+			assert.Equal(t, context.Canceled, err)
+		}(ctx)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// one waiter is still there, fetch should continue
+	cancel1()
+	select {
+	case <-cancelled:
+		t.Fatal("Flight cancelled while waiter is still present")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// last waiter is gone
+	cancel2()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Flight is not cancelled")
+	}
+
+	wg.Wait()
+}
+
+func TestFlightGroup_Panic(t *testing.T) {
+	g := NewFlightGroup()
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		var project *struct{ ID int }
+		return project.ID, nil
+	}
+
+	value, err := g.Do(context.Background(), "file_1_master_package.json", fn)
+
+	assert.Nil(t, value)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Fetch failed")
+	}
+
+	// failed flight is forgotten, next call is executed again
+	value, err = g.Do(context.Background(), "file_1_master_package.json", func(ctx context.Context) (interface{}, error) {
+		return "{}", nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", value)
+}
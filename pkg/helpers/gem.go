@@ -0,0 +1,262 @@
+package helpers
+
+import (
+	"bytes"
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// GemSpec - gem specification, serialized into metadata.gz of .gem file
+	GemSpec struct {
+		Name                    string
+		Version                 string
+		Summary                 string
+		Description             string
+		Homepage                string
+		Authors                 []string
+		Licenses                []string
+		RequirePaths            []string
+		RequiredRubyVersion     string
+		RequiredRubygemsVersion string
+		Dependencies            []GemDependency
+		Date                    time.Time
+	}
+
+	// GemDependency - runtime or development dependency of gem
+	GemDependency struct {
+		Name         string
+		Requirements []string
+		Type         string
+	}
+)
+
+var (
+	gemRequirementRegexp = regexp.MustCompile(`^\s*(=|!=|>=|<=|>|<|~>)?\s*(\S+)\s*$`)
+)
+
+// GetGemName - file name of gem
+func GetGemName(name, version string) string {
+	return fmt.Sprintf("%s-%s.gem", name, version)
+}
+
+// NormalizeGemRequirement - convert requirement into "operator version" form,
+// version without operator means exact version
+func NormalizeGemRequirement(requirement string) string {
+	match := gemRequirementRegexp.FindStringSubmatch(requirement)
+	if match == nil {
+		return strings.TrimSpace(requirement)
+	}
+
+	if match[1] == "" {
+		match[1] = "="
+	}
+
+	return fmt.Sprintf("%s %s", match[1], match[2])
+}
+
+// GetGemArchive - repack GitLab archive into gem: plain tar with data.tar.gz containing all files,
+// metadata.gz with gem specification and checksums.yaml.gz, the same way "gem build" does.
+// Archive is reproducible, so checksum in compact index is stable.
+func GetGemArchive(ctx context.Context, src []byte, spec *GemSpec, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := fmt.Sprintf("gem_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s (%s)", spec.Name, spec.Version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s (%s)", spec.Name, spec.Version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s (%s)", spec.Name, spec.Version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		start := time.Now()
+		defer metrics.RepackDuration.ObserveSince(start, "gem")
+
+		gemArchive, err := repackGem(src, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if repoRef != "master" {
+			if gemArchive, err = snapshotPut(cacheKey, gemArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, gemArchive)
+		}
+
+		return gemArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// repack GitLab archive into gem
+func repackGem(src []byte, spec *GemSpec) ([]byte, error) {
+	fileList, err := readArchiveFiles(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// previously built gems are never packed
+	gemFileList := make([]archiveFile, 0)
+	nameList := make([]string, 0)
+	for _, f := range fileList {
+		if strings.HasSuffix(f.name, ".gem") {
+			continue
+		}
+
+		gemFileList = append(gemFileList, f)
+		nameList = append(nameList, f.name)
+	}
+
+	data, err := writeTarGz(gemFileList, "")
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := gzipData(getGemSpecYaml(spec, nameList))
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := new(bytes.Buffer)
+	fmt.Fprintf(checksums, "---\nSHA256:\n")
+	fmt.Fprintf(checksums, "  metadata.gz: %x\n", sha256.Sum256(metadata))
+	fmt.Fprintf(checksums, "  data.tar.gz: %x\n", sha256.Sum256(data))
+	fmt.Fprintf(checksums, "SHA512:\n")
+	fmt.Fprintf(checksums, "  metadata.gz: %x\n", sha512.Sum512(metadata))
+	fmt.Fprintf(checksums, "  data.tar.gz: %x\n", sha512.Sum512(data))
+
+	checksumsGz, err := gzipData(checksums.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return writeTar([]archiveFile{
+		{name: "metadata.gz", data: metadata},
+		{name: "data.tar.gz", data: data},
+		{name: "checksums.yaml.gz", data: checksumsGz},
+	}, "")
+}
+
+// serialize gem specification into yaml, in the same form as rubygems does
+func getGemSpecYaml(spec *GemSpec, fileList []string) []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "--- !ruby/object:Gem::Specification\n")
+	fmt.Fprintf(buf, "name: %s\n", strconv.Quote(spec.Name))
+	fmt.Fprintf(buf, "version: !ruby/object:Gem::Version\n  version: %s\n", strconv.Quote(spec.Version))
+	fmt.Fprintf(buf, "platform: ruby\n")
+	fmt.Fprintf(buf, "authors:%s", getGemYamlList(spec.Authors, ""))
+	fmt.Fprintf(buf, "bindir: bin\n")
+	fmt.Fprintf(buf, "cert_chain: []\n")
+	fmt.Fprintf(buf, "date: %s\n", spec.Date.UTC().Format("2006-01-02 00:00:00.000000000 Z"))
+
+	if len(spec.Dependencies) == 0 {
+		fmt.Fprintf(buf, "dependencies: []\n")
+	} else {
+		fmt.Fprintf(buf, "dependencies:\n")
+	}
+	for _, dep := range spec.Dependencies {
+		fmt.Fprintf(buf, "- !ruby/object:Gem::Dependency\n")
+		fmt.Fprintf(buf, "  name: %s\n", strconv.Quote(dep.Name))
+		fmt.Fprintf(buf, "  requirement:%s", getGemYamlRequirement(dep.Requirements, "  "))
+		fmt.Fprintf(buf, "  type: :%s\n", dep.Type)
+		fmt.Fprintf(buf, "  prerelease: false\n")
+		fmt.Fprintf(buf, "  version_requirements:%s", getGemYamlRequirement(dep.Requirements, "  "))
+	}
+
+	fmt.Fprintf(buf, "description: %s\n", strconv.Quote(spec.Description))
+	fmt.Fprintf(buf, "executables: []\n")
+	fmt.Fprintf(buf, "extensions: []\n")
+	fmt.Fprintf(buf, "extra_rdoc_files: []\n")
+	fmt.Fprintf(buf, "files:%s", getGemYamlList(fileList, ""))
+	fmt.Fprintf(buf, "homepage: %s\n", strconv.Quote(spec.Homepage))
+	fmt.Fprintf(buf, "licenses:%s", getGemYamlList(spec.Licenses, ""))
+	fmt.Fprintf(buf, "metadata: {}\n")
+	fmt.Fprintf(buf, "rdoc_options: []\n")
+	fmt.Fprintf(buf, "require_paths:%s", getGemYamlList(spec.RequirePaths, ""))
+	fmt.Fprintf(buf, "required_ruby_version:%s", getGemYamlRequirement(splitGemRequirement(spec.RequiredRubyVersion), ""))
+	fmt.Fprintf(buf, "required_rubygems_version:%s", getGemYamlRequirement(splitGemRequirement(spec.RequiredRubygemsVersion), ""))
+	fmt.Fprintf(buf, "requirements: []\n")
+	fmt.Fprintf(buf, "specification_version: 4\n")
+	fmt.Fprintf(buf, "summary: %s\n", strconv.Quote(spec.Summary))
+	fmt.Fprintf(buf, "test_files: []\n")
+
+	return buf.Bytes()
+}
+
+// serialize list of strings, empty list is written inline
+func getGemYamlList(valueList []string, indent string) string {
+	if len(valueList) == 0 {
+		return " []\n"
+	}
+
+	result := "\n"
+	for _, value := range valueList {
+		result += fmt.Sprintf("%s- %s\n", indent, strconv.Quote(value))
+	}
+
+	return result
+}
+
+// serialize Gem::Requirement, no requirements means any version
+func getGemYamlRequirement(requirementList []string, indent string) string {
+	if len(requirementList) == 0 {
+		requirementList = []string{">= 0"}
+	}
+
+	result := fmt.Sprintf(" !ruby/object:Gem::Requirement\n%s  requirements:\n", indent)
+	for _, requirement := range requirementList {
+		partList := strings.SplitN(NormalizeGemRequirement(requirement), " ", 2)
+		if len(partList) != 2 {
+			continue
+		}
+
+		result += fmt.Sprintf("%s  - - %s\n", indent, strconv.Quote(partList[0]))
+		result += fmt.Sprintf("%s    - !ruby/object:Gem::Version\n", indent)
+		result += fmt.Sprintf("%s      version: %s\n", indent, strconv.Quote(partList[1]))
+	}
+
+	return result
+}
+
+// split comma separated requirement, e.g. ">= 2.7, < 4"
+func splitGemRequirement(requirement string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(requirement, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
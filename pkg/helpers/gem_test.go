@@ -0,0 +1,73 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestNormalizeGemRequirement(t *testing.T) {
+	assert.Equal(t, "= 1.0", NormalizeGemRequirement("1.0"))
+	assert.Equal(t, "~> 2.2", NormalizeGemRequirement("~>2.2"))
+	assert.Equal(t, ">= 2.0", NormalizeGemRequirement(" >= 2.0 "))
+	assert.Equal(t, "acme-auth-1.2.0.gem", GetGemName("acme-auth", "1.2.0"))
+}
+
+func TestGetGemArchive(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"auth-v1.2.0-48bfe31/acme-auth.gemspec":       "",
+		"auth-v1.2.0-48bfe31/lib/acme/auth.rb":        "",
+		"auth-v1.2.0-48bfe31/pkg/acme-auth-1.1.0.gem": "",
+	})
+
+	spec := &GemSpec{
+		Name:         "acme-auth",
+		Version:      "1.2.0",
+		Summary:      "Internal auth",
+		RequirePaths: []string{"lib"},
+		Dependencies: []GemDependency{{Name: "rack", Requirements: []string{">= 2.0", "< 3"}, Type: "runtime"}},
+		Date:         time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	archive, err := GetGemArchive(context.Background(), src, spec, "48bfe31a", "master")
+	assert.Nil(t, err)
+
+	// archive should be reproducible
+	again, err := GetGemArchive(context.Background(), src, spec, "48bfe31a", "master")
+	assert.Nil(t, err)
+	assert.Equal(t, archive, again)
+
+	contentList := make(map[string][]byte, 0)
+	nameList := make([]string, 0)
+	r := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := r.Next()
+		if err != nil {
+			break
+		}
+
+		data, _ := ioutil.ReadAll(r)
+		contentList[header.Name] = data
+		nameList = append(nameList, header.Name)
+	}
+	assert.Equal(t, []string{"metadata.gz", "data.tar.gz", "checksums.yaml.gz"}, nameList)
+
+	gz, err := gzip.NewReader(bytes.NewReader(contentList["metadata.gz"]))
+	assert.Nil(t, err)
+	metadata, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+
+	parsed := make(map[string]interface{}, 0)
+	assert.Nil(t, yaml.Unmarshal(metadata, &parsed))
+	assert.Equal(t, "acme-auth", parsed["name"])
+	assert.Equal(t, map[interface{}]interface{}{"version": "1.2.0"}, parsed["version"])
+	assert.Equal(t, []interface{}{"acme-auth.gemspec", "lib/acme/auth.rb"}, parsed["files"])
+	assert.Equal(t, "2024-01-02 00:00:00.000000000 Z", parsed["date"])
+	assert.Len(t, parsed["dependencies"], 1)
+}
@@ -0,0 +1,213 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// limits are the same as enforced by go command for module zip files
+	goMaxZipFile = 500 << 20
+	goMaxGoMod   = 16 << 20
+	goMaxLicense = 16 << 20
+)
+
+// EscapeModulePath - escape module path or version the way go command does:
+// each upper-case letter is replaced by exclamation mark followed by lower-case letter
+func EscapeModulePath(value string) string {
+	buf := new(bytes.Buffer)
+	for _, r := range value {
+		if r >= 'A' && r <= 'Z' {
+			buf.WriteByte('!')
+			buf.WriteRune(r + ('a' - 'A'))
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String()
+}
+
+// UnescapeModulePath - reverse EscapeModulePath, escaped value
+// should never contain upper-case letters.
+func UnescapeModulePath(escaped string) (string, error) {
+	buf := new(bytes.Buffer)
+	bang := false
+	for _, r := range escaped {
+		switch {
+		case bang && r >= 'a' && r <= 'z':
+			buf.WriteRune(r - ('a' - 'A'))
+			bang = false
+
+		case bang, r >= 'A' && r <= 'Z':
+			return "", fmt.Errorf("Invalid escaped module path: %s", escaped)
+
+		case r == '!':
+			bang = true
+
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	if bang {
+		return "", fmt.Errorf("Invalid escaped module path: %s", escaped)
+	}
+
+	return buf.String(), nil
+}
+
+// GetGoModuleArchive - repack GitLab archive into module zip archive and cache it.
+func GetGoModuleArchive(ctx context.Context, src []byte, modulePath, version, repoUUID, repoRef string) ([]byte, error) {
+	// GitLab serves repository archive as tar.gz archive, so, for go modules:
+	//  * repack gitlab archive: ungzip -> untar -> zip, in memory
+	//  * every file is prefixed with "module@version/" instead of GitLab directory
+	//  * skip vcs directories, vendored packages and nested modules
+	//  * enforce size limits of go command
+	//  * cache archive bytes, except master
+
+	cacheKey := fmt.Sprintf("gozip_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s @ %s", modulePath, version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s @ %s", modulePath, version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s @ %s", modulePath, version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		moduleArchive, err := repackGoModule(src, modulePath, version)
+		if err != nil {
+			return nil, err
+		}
+
+		if repoRef != "master" {
+			if moduleArchive, err = snapshotPut(cacheKey, moduleArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, moduleArchive)
+		}
+
+		return moduleArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// repack GitLab archive into go module zip archive
+func repackGoModule(src []byte, modulePath, version string) ([]byte, error) {
+	fileList, err := readArchiveFiles(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// directories with own go.mod are separate modules
+	nestedModuleList := make([]string, 0)
+	for _, f := range fileList {
+		if dir := path.Dir(f.name); dir != "." && path.Base(f.name) == "go.mod" {
+			nestedModuleList = append(nestedModuleList, dir+"/")
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	prefix := fmt.Sprintf("%s@%s/", modulePath, version)
+	totalSize := int64(0)
+	seenList := make(map[string]string, 0)
+
+	for _, f := range fileList {
+		if isGoModuleFileExcluded(f.name, nestedModuleList) {
+			continue
+		}
+
+		if !utf8.ValidString(f.name) || strings.Contains(f.name, "..") {
+			return nil, fmt.Errorf("Invalid file name in module: %s", f.name)
+		}
+
+		// module zip should be extractable on case-insensitive file systems
+		folded := strings.ToLower(f.name)
+		if other, ok := seenList[folded]; ok {
+			return nil, fmt.Errorf("Case-insensitive file name collision: %s and %s", other, f.name)
+		}
+		seenList[folded] = f.name
+
+		size := int64(len(f.data))
+		if f.name == "go.mod" && size > goMaxGoMod {
+			return nil, fmt.Errorf("go.mod file too large: %d bytes", size)
+		}
+		if f.name == "LICENSE" && size > goMaxLicense {
+			return nil, fmt.Errorf("LICENSE file too large: %d bytes", size)
+		}
+
+		totalSize += size
+		if totalSize > goMaxZipFile {
+			return nil, fmt.Errorf("Module is too large, limit is %d bytes", goMaxZipFile)
+		}
+
+		if err := writeZipFile(w, prefix+f.name, f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// check file should be excluded from module zip
+func isGoModuleFileExcluded(name string, nestedModuleList []string) bool {
+	for _, dir := range nestedModuleList {
+		if strings.HasPrefix(name, dir) {
+			return true
+		}
+	}
+
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		switch part {
+		case ".git", ".hg", ".svn", ".bzr":
+			return true
+		}
+	}
+
+	// files of vendored packages are excluded, but vendor/modules.txt is kept
+	vendorPos := 0
+	if strings.HasPrefix(name, "vendor/") {
+		vendorPos = len("vendor/")
+	} else if pos := strings.Index(name, "/vendor/"); pos >= 0 {
+		vendorPos = pos + len("/vendor/")
+	} else {
+		return false
+	}
+
+	return strings.Contains(name[vendorPos:], "/")
+}
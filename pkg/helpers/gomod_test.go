@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestEscapeModulePath(t *testing.T) {
+	assert.Equal(t, "gitlab.example.com/!acme/!tools", EscapeModulePath("gitlab.example.com/Acme/Tools"))
+
+	path, err := UnescapeModulePath("gitlab.example.com/!acme/!tools")
+	assert.Nil(t, err)
+	assert.Equal(t, "gitlab.example.com/Acme/Tools", path)
+
+	_, err = UnescapeModulePath("gitlab.example.com/Acme")
+	assert.NotNil(t, err)
+
+	_, err = UnescapeModulePath("gitlab.example.com/acme!")
+	assert.NotNil(t, err)
+}
+
+func TestRepackGoModule(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"tools-v1.0.0-48bfe31/go.mod":                          "module gitlab.example.com/acme/tools\n",
+		"tools-v1.0.0-48bfe31/main.go":                         "package main\n",
+		"tools-v1.0.0-48bfe31/vendor/modules.txt":              "# github.com/pkg/errors v0.9.1\n",
+		"tools-v1.0.0-48bfe31/vendor/github.com/pkg/errors.go": "package errors\n",
+		"tools-v1.0.0-48bfe31/sub/go.mod":                      "module gitlab.example.com/acme/tools/sub\n",
+		"tools-v1.0.0-48bfe31/sub/sub.go":                      "package sub\n",
+		"tools-v1.0.0-48bfe31/.git/config":                     "[core]\n",
+	})
+
+	archive, err := repackGoModule(src, "gitlab.example.com/acme/tools", "v1.0.0")
+	assert.Nil(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.Nil(t, err)
+
+	nameList := make([]string, 0)
+	for _, f := range r.File {
+		nameList = append(nameList, f.Name)
+	}
+
+	assert.Equal(t, []string{
+		"gitlab.example.com/acme/tools@v1.0.0/go.mod",
+		"gitlab.example.com/acme/tools@v1.0.0/main.go",
+		"gitlab.example.com/acme/tools@v1.0.0/vendor/modules.txt",
+	}, nameList)
+}
+
+func TestRepackGoModule_CaseCollision(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"tools-v1.0.0-48bfe31/go.mod":    "module gitlab.example.com/acme/tools\n",
+		"tools-v1.0.0-48bfe31/README":    "readme\n",
+		"tools-v1.0.0-48bfe31/ReadMe":    "readme\n",
+		"tools-v1.0.0-48bfe31/README.md": "readme\n",
+	})
+
+	_, err := repackGoModule(src, "gitlab.example.com/acme/tools", "v1.0.0")
+	assert.NotNil(t, err)
+}
+
+// create tar.gz archive, files are written in sorted order
+func createTestGitLabArchive(t *testing.T, files map[string]string) []byte {
+	nameList := make([]string, 0)
+	for name := range files {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	w := tar.NewWriter(gz)
+
+	for _, name := range nameList {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w.Close()
+	gz.Close()
+
+	return buf.Bytes()
+}
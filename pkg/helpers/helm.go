@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// GetHelmChartName - file name of packaged chart
+func GetHelmChartName(name, version string) string {
+	return fmt.Sprintf("%s-%s.tgz", name, version)
+}
+
+// GetHelmChartArchive - repack GitLab archive into packaged chart, the same way "helm package" does:
+// all files are placed into "name/" directory, files matching .helmignore are skipped.
+// Archive is reproducible, so digest in index.yaml is stable.
+func GetHelmChartArchive(ctx context.Context, src []byte, name, version, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := fmt.Sprintf("chart_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s : %s", name, version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s : %s", name, version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s : %s", name, version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		start := time.Now()
+		defer metrics.RepackDuration.ObserveSince(start, "chart")
+
+		fileList, err := readArchiveFiles(src)
+		if err != nil {
+			return nil, err
+		}
+
+		ignoreList := make([]string, 0)
+		for _, f := range fileList {
+			if f.name == ".helmignore" {
+				ignoreList = parseHelmIgnore(string(f.data))
+			}
+		}
+
+		chartFileList := make([]archiveFile, 0)
+		for _, f := range fileList {
+			if !isHelmFileIgnored(f.name, ignoreList) {
+				chartFileList = append(chartFileList, f)
+			}
+		}
+
+		chartArchive, err := writeTarGz(chartFileList, name+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		if repoRef != "master" {
+			if chartArchive, err = snapshotPut(cacheKey, chartArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, chartArchive)
+		}
+
+		return chartArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// parse .helmignore, only simple glob patterns and directories are supported
+func parseHelmIgnore(data string) []string {
+	ignoreList := []string{".git/", ".helmignore"}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		ignoreList = append(ignoreList, line)
+	}
+
+	return ignoreList
+}
+
+// check file matches any of .helmignore patterns, pattern is matched
+// against every path component and against whole path
+func isHelmFileIgnored(name string, ignoreList []string) bool {
+	for _, pattern := range ignoreList {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.Trim(pattern, "/")
+
+		if matched, _ := path.Match(pattern, name); matched && !dirOnly {
+			return true
+		}
+
+		partList := strings.Split(name, "/")
+		for i, part := range partList {
+			// directory pattern should not match file itself
+			if dirOnly && i == len(partList)-1 {
+				break
+			}
+
+			if matched, _ := path.Match(pattern, part); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetHelmChartArchive(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"chart-v1.2.0-48bfe31/Chart.yaml":             "name: acme-api\nversion: 1.2.0\n",
+		"chart-v1.2.0-48bfe31/.helmignore":            "# comment\n*.swp\nci/\n",
+		"chart-v1.2.0-48bfe31/templates/service.yaml": "kind: Service\n",
+		"chart-v1.2.0-48bfe31/templates/.service.swp": "",
+		"chart-v1.2.0-48bfe31/ci/values.yaml":         "replicas: 1\n",
+	})
+
+	archive, err := GetHelmChartArchive(context.Background(), src, "acme-api", "1.2.0", "48bfe31a", "master")
+	assert.Nil(t, err)
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+
+	nameList := make([]string, 0)
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err != nil {
+			break
+		}
+		nameList = append(nameList, header.Name)
+	}
+
+	assert.Equal(t, []string{
+		"acme-api/Chart.yaml",
+		"acme-api/templates/service.yaml",
+	}, nameList)
+}
+
+func TestGetHelmChartArchive_SameName(t *testing.T) {
+	first := createTestGitLabArchive(t, map[string]string{
+		"chart-v1.2.0-48bfe31/Chart.yaml": "name: acme-shared\nversion: 1.2.0\n",
+	})
+	second := createTestGitLabArchive(t, map[string]string{
+		"chart-v1.2.0-6104942/Chart.yaml":  "name: acme-shared\nversion: 1.2.0\n",
+		"chart-v1.2.0-6104942/values.yaml": "replicas: 1\n",
+	})
+
+	// charts of different repositories never share cache entry
+	firstArchive, err := GetHelmChartArchive(context.Background(), first, "acme-shared", "1.2.0", "48bfe31a", "48bfe31")
+	assert.Nil(t, err)
+
+	secondArchive, err := GetHelmChartArchive(context.Background(), second, "acme-shared", "1.2.0", "61049420", "6104942")
+	assert.Nil(t, err)
+	assert.NotEqual(t, firstArchive, secondArchive)
+}
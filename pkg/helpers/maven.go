@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	// standard maven and gradle source directories, packed into root of sources jar
+	mavenSourceDirList = []string{
+		"src/main/java/",
+		"src/main/kotlin/",
+		"src/main/resources/",
+	}
+)
+
+// GetMavenSourcesJar - repack GitLab archive into sources jar: content of standard
+// source directories is placed into jar root, along with META-INF/MANIFEST.MF.
+func GetMavenSourcesJar(ctx context.Context, src []byte, groupID, artifactID, version, repoUUID, repoRef string) ([]byte, error) {
+	cacheKey := fmt.Sprintf("jar_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s:%s:%s", groupID, artifactID, version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s:%s:%s", groupID, artifactID, version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s:%s:%s", groupID, artifactID, version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		start := time.Now()
+		defer metrics.RepackDuration.ObserveSince(start, "jar")
+
+		fileList, err := readArchiveFiles(src)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := new(bytes.Buffer)
+		w := zip.NewWriter(buf)
+
+		manifest := "Manifest-Version: 1.0\r\nCreated-By: Comrade Pavlik\r\n\r\n"
+		if err := writeZipFile(w, "META-INF/MANIFEST.MF", []byte(manifest)); err != nil {
+			return nil, err
+		}
+
+		seenList := make(map[string]bool, 0)
+		for _, f := range fileList {
+			for _, dir := range mavenSourceDirList {
+				name := strings.TrimPrefix(f.name, dir)
+				if name == f.name || seenList[name] {
+					continue
+				}
+
+				seenList[name] = true
+				if err := writeZipFile(w, name, f.data); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		jarArchive := buf.Bytes()
+		if repoRef != "master" {
+			if jarArchive, err = snapshotPut(cacheKey, jarArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, jarArchive)
+		}
+
+		return jarArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// add single file to zip archive with constant mtime
+func writeZipFile(w *zip.Writer, name string, data []byte) error {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	header.SetModTime(archiveTime)
+
+	fw, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = fw.Write(data)
+	return err
+}
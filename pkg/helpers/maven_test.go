@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetMavenSourcesJar(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"client-v1.2.0-48bfe31/pom.xml":                                   "<project/>",
+		"client-v1.2.0-48bfe31/src/main/java/com/example/Client.java":     "package com.example;\n",
+		"client-v1.2.0-48bfe31/src/main/resources/client.properties":      "timeout=1\n",
+		"client-v1.2.0-48bfe31/src/test/java/com/example/ClientTest.java": "package com.example;\n",
+	})
+
+	archive, err := GetMavenSourcesJar(context.Background(), src, "com.example", "client", "1.2.0", "48bfe31a", "master")
+	assert.Nil(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.Nil(t, err)
+
+	nameList := make([]string, 0)
+	for _, f := range r.File {
+		nameList = append(nameList, f.Name)
+	}
+
+	assert.Equal(t, []string{
+		"META-INF/MANIFEST.MF",
+		"com/example/Client.java",
+		"client.properties",
+	}, nameList)
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	pythonNameSeparator = regexp.MustCompile("[-_.]+")
+)
+
+// NormalizePythonName - normalize project name according to PEP 503
+func NormalizePythonName(name string) string {
+	return strings.ToLower(pythonNameSeparator.ReplaceAllString(name, "-"))
+}
+
+// GetPythonSdistName - file name of source distribution according to PEP 625
+func GetPythonSdistName(name, version string) string {
+	return fmt.Sprintf("%s-%s.tar.gz", strings.Replace(NormalizePythonName(name), "-", "_", -1), version)
+}
+
+// GetPythonSdistArchive - repack GitLab archive into source distribution:
+// all files are placed into "name-version/" directory and PKG-INFO is added.
+func GetPythonSdistArchive(ctx context.Context, src []byte, name, version, repoUUID, repoRef string, pkgInfo []byte) ([]byte, error) {
+	cacheKey := fmt.Sprintf("sdist_%s_%s", repoUUID, repoRef)
+
+	// WARNING: *never* cache master ref
+	if repoRef != "master" {
+		if item, ok := globalCache.Get(cacheKey); ok {
+			if archive, ok := item.([]byte); ok {
+				log.Printf("Cache hit: archive-lru %s == %s", name, version)
+				metrics.CacheHit("archive")
+				return archive, nil
+			}
+
+			globalCache.Remove(cacheKey)
+			return nil, fmt.Errorf("Cache broken: archive-lru %s == %s", name, version)
+		}
+
+		// frozen artifact is never rebuilt
+		if archive, ok, err := snapshotGet(cacheKey); ok || err != nil {
+			return archive, err
+		}
+	}
+
+	log.Printf("Cache miss: archive-lru %s == %s", name, version)
+	metrics.CacheMiss("archive")
+
+	// concurrent requests for the same archive share single repack
+	value, err := archiveFlight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		start := time.Now()
+		defer metrics.RepackDuration.ObserveSince(start, "sdist")
+
+		fileList, err := readArchiveFiles(src)
+		if err != nil {
+			return nil, err
+		}
+
+		// PKG-INFO generated from metadata takes precedence
+		sdistFileList := []archiveFile{{name: "PKG-INFO", data: pkgInfo}}
+		for _, f := range fileList {
+			if f.name != "PKG-INFO" {
+				sdistFileList = append(sdistFileList, f)
+			}
+		}
+
+		prefix := strings.TrimSuffix(GetPythonSdistName(name, version), ".tar.gz") + "/"
+		sdistArchive, err := writeTarGz(sdistFileList, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		if repoRef != "master" {
+			if sdistArchive, err = snapshotPut(cacheKey, sdistArchive); err != nil {
+				return nil, err
+			}
+
+			cacheAdd(cacheKey, sdistArchive)
+		}
+
+		return sdistArchive, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
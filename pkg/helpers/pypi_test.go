@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalizePythonName(t *testing.T) {
+	assert.Equal(t, "acme-tools", NormalizePythonName("Acme_Tools"))
+	assert.Equal(t, "acme-tools", NormalizePythonName("acme.-tools"))
+	assert.Equal(t, "acme_tools-1.2.0.tar.gz", GetPythonSdistName("Acme.Tools", "1.2.0"))
+}
+
+func TestGetPythonSdistArchive(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"tools-v1.2.0-48bfe31/pyproject.toml":         "[project]\nname = \"acme-tools\"\n",
+		"tools-v1.2.0-48bfe31/acme_tools/__init__.py": "",
+	})
+
+	pkgInfo := []byte("Metadata-Version: 2.1\nName: acme-tools\nVersion: 1.2.0\n")
+	archive, err := GetPythonSdistArchive(context.Background(), src, "acme-tools", "1.2.0", "48bfe31a", "master", pkgInfo)
+	assert.Nil(t, err)
+
+	// archive should be reproducible
+	again, err := GetPythonSdistArchive(context.Background(), src, "acme-tools", "1.2.0", "48bfe31a", "master", pkgInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, archive, again)
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+
+	nameList := make([]string, 0)
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err != nil {
+			break
+		}
+		nameList = append(nameList, header.Name)
+	}
+
+	assert.Equal(t, []string{
+		"acme_tools-1.2.0/PKG-INFO",
+		"acme_tools-1.2.0/acme_tools/__init__.py",
+		"acme_tools-1.2.0/pyproject.toml",
+	}, nameList)
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrReadmeNotFound - archive has no README in root directory
+	ErrReadmeNotFound = errors.New("README not found")
+
+	// preferred README extensions, first match wins
+	readmeExtList = []string{".md", ".markdown", "", ".txt", ".rst"}
+)
+
+// GetReadme - find README in root directory of GitLab archive,
+// file name is matched case-insensitive, markdown is preferred.
+func GetReadme(src []byte) (string, []byte, error) {
+	fileList, err := readArchiveFiles(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, ext := range readmeExtList {
+		for _, f := range fileList {
+			if strings.Contains(f.name, "/") {
+				continue
+			}
+
+			name := strings.ToLower(f.name)
+			if strings.TrimSuffix(name, path.Ext(name)) == "readme" && path.Ext(name) == ext {
+				return f.name, f.data, nil
+			}
+		}
+	}
+
+	return "", nil, ErrReadmeNotFound
+}
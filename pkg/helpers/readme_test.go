@@ -0,0 +1,30 @@
+package helpers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetReadme(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"auth-v1.0.0-48bfe31/README.rst":     "Auth\n====\n",
+		"auth-v1.0.0-48bfe31/Readme.md":      "# Auth\n",
+		"auth-v1.0.0-48bfe31/docs/README.md": "# Docs\n",
+		"auth-v1.0.0-48bfe31/package.json":   "{}",
+	})
+
+	name, data, err := GetReadme(src)
+	assert.Nil(t, err)
+	assert.Equal(t, "Readme.md", name)
+	assert.Equal(t, "# Auth\n", string(data))
+}
+
+func TestGetReadme_NotFound(t *testing.T) {
+	src := createTestGitLabArchive(t, map[string]string{
+		"auth-v1.0.0-48bfe31/docs/README.md": "# Docs\n",
+		"auth-v1.0.0-48bfe31/package.json":   "{}",
+	})
+
+	_, _, err := GetReadme(src)
+	assert.Equal(t, ErrReadmeNotFound, err)
+}
@@ -0,0 +1,172 @@
+package helpers
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"comrade-pavlik2/pkg/snapshots"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	snapshotStore *snapshots.Store // durable artifacts, disabled when nil
+)
+
+func init() {
+	snapshotStore = snapshots.NewStore(os.Getenv("PAVLIK_SNAPSHOT_DIR"))
+}
+
+// IsSnapshotEnabled - artifacts are frozen the first time they are built
+func IsSnapshotEnabled() bool {
+	return snapshotStore != nil
+}
+
+// CheckSnapshotDir - make sure directory for frozen artifacts exists and writable,
+// check is skipped when snapshots are disabled
+func CheckSnapshotDir() error {
+	if snapshotStore == nil {
+		return nil
+	}
+
+	return snapshotStore.Check()
+}
+
+// FreezeVersionMetadata - freeze metadata of npm or composer package version the first time
+// it is generated, metadata frozen earlier is returned instead of provided one.
+// Master branch is never frozen.
+func FreezeVersionMetadata(kind, repoUUID, repoRef string, data []byte) ([]byte, error) {
+	if snapshotStore == nil || repoRef == "master" {
+		return data, nil
+	}
+
+	cacheKey := getVersionMetadataCacheKey(kind, repoUUID, repoRef)
+	if item, ok := globalCache.Get(cacheKey); ok {
+		if frozen, ok := item.([]byte); ok {
+			return frozen, nil
+		}
+
+		globalCache.Remove(cacheKey)
+	}
+
+	if frozen, ok, err := snapshotGet(cacheKey); ok || err != nil {
+		return frozen, err
+	}
+
+	frozen, err := snapshotPut(cacheKey, data)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheAdd(cacheKey, frozen)
+	return frozen, nil
+}
+
+// GetFrozenVersionMetadataList - metadata of all frozen versions of npm or composer package,
+// keyed by reference, versions are served even when GitLab no longer lists the tag.
+func GetFrozenVersionMetadataList(kind, repoUUID string) (map[string][]byte, error) {
+	metadataList := make(map[string][]byte, 0)
+	if snapshotStore == nil {
+		return metadataList, nil
+	}
+
+	prefix := getVersionMetadataCacheKey(kind, repoUUID, "")
+	keyList, err := snapshotStore.List(kind+"-version", repoUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cacheKey := range keyList {
+		var data []byte
+		if item, ok := globalCache.Get(cacheKey); ok {
+			data, _ = item.([]byte)
+		}
+
+		if data == nil {
+			frozen, ok, err := snapshotGet(cacheKey)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+
+			data = frozen
+		}
+
+		metadataList[strings.TrimPrefix(cacheKey, prefix)] = data
+	}
+
+	return metadataList, nil
+}
+
+// IsArchiveFrozen - check npm or composer archive of package version is frozen,
+// frozen archive is served as is, so it is never rebuilt.
+func IsArchiveFrozen(kind, repoUUID, repoRef string) (bool, error) {
+	if snapshotStore == nil {
+		return false, nil
+	}
+
+	_, _, err := snapshotStore.Get(getArchiveCacheKey(kind, repoUUID, repoRef))
+	if err == snapshots.ErrSnapshotNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//
+// Private API
+//
+
+// return cache key for metadata of npm or composer package version
+func getVersionMetadataCacheKey(kind, repoUUID, repoRef string) string {
+	return fmt.Sprintf("%s-version_%s_%s", kind, repoUUID, repoRef)
+}
+
+// get frozen artifact by cache key, artifact found is put into archive cache
+func snapshotGet(cacheKey string) ([]byte, bool, error) {
+	if snapshotStore == nil {
+		return nil, false, nil
+	}
+
+	data, _, err := snapshotStore.Get(cacheKey)
+	if err == snapshots.ErrSnapshotNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("Snapshot broken: %s: %s", cacheKey, err)
+	}
+
+	log.Printf("Cache hit: snapshot %s", cacheKey)
+	metrics.CacheHit("snapshot")
+	cacheAdd(cacheKey, data)
+	return data, true, nil
+}
+
+// freeze artifact built first time, artifact frozen earlier
+// (by another instance sharing directory) wins over built one
+func snapshotPut(cacheKey string, data []byte) ([]byte, error) {
+	if snapshotStore == nil {
+		return data, nil
+	}
+
+	info, err := snapshotStore.Put(cacheKey, data)
+	if err == snapshots.ErrSnapshotExists {
+		frozen, _, err := snapshotStore.Get(cacheKey)
+		if err != nil {
+			return nil, fmt.Errorf("Snapshot broken: %s: %s", cacheKey, err)
+		}
+
+		return frozen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Snapshot: frozen %s, sha256 %s", cacheKey, info.SHA256)
+	return data, nil
+}
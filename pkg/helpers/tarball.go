@@ -0,0 +1,128 @@
+package helpers
+
+// In-memory repacking of GitLab archives
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type (
+	// single regular file extracted from GitLab archive
+	archiveFile struct {
+		name string
+		mode int64
+		data []byte
+	}
+)
+
+// extract all regular files from GitLab tar.gz archive,
+// top level directory created by GitLab is stripped from file names
+func readArchiveFiles(src []byte) ([]archiveFile, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	fileList := make([]archiveFile, 0)
+	r := tar.NewReader(gz)
+	for {
+		entryItem, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// symlinks and other special files are skipped
+		if entryItem.Typeflag != tar.TypeReg && entryItem.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		nameList := strings.SplitN(entryItem.Name, "/", 2)
+		if len(nameList) != 2 || nameList[1] == "" {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		fileList = append(fileList, archiveFile{
+			name: nameList[1],
+			mode: entryItem.Mode,
+			data: data,
+		})
+	}
+
+	return fileList, nil
+}
+
+// write files into tar.gz archive under given directory prefix,
+// owner and mtime are constant, so result is the same for the same files
+func writeTarGz(fileList []archiveFile, prefix string) ([]byte, error) {
+	data, err := writeTar(fileList, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return gzipData(data)
+}
+
+// write files into tar archive under given directory prefix
+func writeTar(fileList []archiveFile, prefix string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	w := tar.NewWriter(buf)
+	for _, f := range fileList {
+		mode := int64(0644)
+		if f.mode&0111 != 0 {
+			mode = 0755
+		}
+
+		header := &tar.Header{
+			Name:     prefix + f.name,
+			Mode:     mode,
+			Size:     int64(len(f.data)),
+			ModTime:  archiveTime,
+			Typeflag: tar.TypeReg,
+		}
+
+		if err := w.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compress data with constant gzip header
+func gzipData(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	gz := gzip.NewWriter(buf)
+	gz.ModTime = archiveTime
+
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -1,16 +1,38 @@
 package helpers
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 )
 
+var (
+	// per-instance secret for token keys, PAVLIK_SECRET or random one
+	tokenSecret     []byte
+	tokenSecretOnce sync.Once
+)
+
+// GetTokenFromRequest - extract token from basic (password) or bearer authorization
 func GetTokenFromRequest(r *http.Request) string {
+	_, token := GetCredentialsFromRequest(r)
+	return token
+}
+
+// GetCredentialsFromRequest - extract username and token from authorization header,
+// username is empty for bearer authorization.
+func GetCredentialsFromRequest(r *http.Request) (string, string) {
 	authHeader := r.Header.Get("Authorization")
 	authList := strings.SplitN(authHeader, " ", 2)
 	if len(authList) != 2 {
-		return ""
+		return "", ""
 	}
 
 	switch strings.ToLower(authList[0]) {
@@ -18,14 +40,50 @@ func GetTokenFromRequest(r *http.Request) string {
 		upRaw, _ := base64.StdEncoding.DecodeString(authList[1])
 		upList := strings.SplitN(string(upRaw), ":", 2)
 		if len(upList) != 2 {
-			return ""
+			return "", ""
 		}
-		return string(upList[1])
+		return upList[0], upList[1]
 
 	case "bearer":
-		return authList[1]
+		return "", authList[1]
 
 	default:
-		return ""
+		return "", ""
+	}
+}
+
+// GetTokenKey - derive key from token with HMAC-SHA256 and per-instance secret,
+// raw token should never be used as cache key, map key or logged.
+func GetTokenKey(token string) string {
+	tokenSecretOnce.Do(initTokenSecret)
+
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RedactURL - hide credentials in url before it is logged or displayed,
+// urls which can't be parsed (e.g. scp-like git urls) are returned as is.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	u.User = url.User("xxxxx")
+	return u.String()
+}
+
+// random secret is enough while all token keys are kept in memory,
+// PAVLIK_SECRET keeps keys stable between restarts and instances
+func initTokenSecret() {
+	if secret := os.Getenv("PAVLIK_SECRET"); secret != "" {
+		tokenSecret = []byte(secret)
+		return
+	}
+
+	tokenSecret = make([]byte, 32)
+	if _, err := rand.Read(tokenSecret); err != nil {
+		log.Fatalf("ERROR: Failed to generate token secret: %s", err)
 	}
 }
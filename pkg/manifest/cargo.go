@@ -0,0 +1,152 @@
+package manifest
+
+import (
+	"github.com/BurntSushi/toml"
+	"sort"
+)
+
+type (
+	// package section and dependency tables of Cargo.toml
+	cargoManifest struct {
+		Package struct {
+			Name        string `toml:"name"`
+			Version     string `toml:"version"`
+			Description string `toml:"description"`
+			Links       string `toml:"links"`
+			RustVersion string `toml:"rust-version"`
+		} `toml:"package"`
+
+		Features          map[string][]string    `toml:"features"`
+		Dependencies      map[string]interface{} `toml:"dependencies"`
+		DevDependencies   map[string]interface{} `toml:"dev-dependencies"`
+		BuildDependencies map[string]interface{} `toml:"build-dependencies"`
+		Target            map[string]struct {
+			Dependencies      map[string]interface{} `toml:"dependencies"`
+			DevDependencies   map[string]interface{} `toml:"dev-dependencies"`
+			BuildDependencies map[string]interface{} `toml:"build-dependencies"`
+		} `toml:"target"`
+	}
+)
+
+// ParseCargoToml - parse Cargo.toml, dependencies of every kind and target
+// are flattened into single list in the form of sparse index entry.
+func ParseCargoToml(data []byte) (map[string]interface{}, error) {
+	m := cargoManifest{}
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return nil, newParseError("Cargo.toml", 0, "%s", err)
+	}
+
+	if m.Package.Name == "" {
+		return nil, newParseError("Cargo.toml", 0, "package name is not defined")
+	}
+
+	dependencyList := make([]interface{}, 0)
+	dependencyList = appendCargoDependencies(dependencyList, m.Dependencies, "normal", "")
+	dependencyList = appendCargoDependencies(dependencyList, m.DevDependencies, "dev", "")
+	dependencyList = appendCargoDependencies(dependencyList, m.BuildDependencies, "build", "")
+
+	targetList := make([]string, 0)
+	for target := range m.Target {
+		targetList = append(targetList, target)
+	}
+	sort.Strings(targetList)
+
+	for _, target := range targetList {
+		t := m.Target[target]
+		dependencyList = appendCargoDependencies(dependencyList, t.Dependencies, "normal", target)
+		dependencyList = appendCargoDependencies(dependencyList, t.DevDependencies, "dev", target)
+		dependencyList = appendCargoDependencies(dependencyList, t.BuildDependencies, "build", target)
+	}
+
+	featureMap := make(map[string]interface{}, 0)
+	for feature, valueList := range m.Features {
+		featureMap[feature] = toInterfaceList(valueList)
+	}
+
+	return map[string]interface{}{
+		"name":         m.Package.Name,
+		"version":      m.Package.Version,
+		"description":  m.Package.Description,
+		"links":        m.Package.Links,
+		"rust_version": m.Package.RustVersion,
+		"features":     featureMap,
+		"dependencies": dependencyList,
+	}, nil
+}
+
+//
+// Private API
+//
+
+// convert dependency table into index entries, short form (name = "1.0")
+// and detailed form (name = { version = "1.0", ... }) are supported
+func appendCargoDependencies(dependencyList []interface{}, table map[string]interface{}, kind, target string) []interface{} {
+	nameList := make([]string, 0)
+	for name := range table {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+
+	for _, name := range nameList {
+		dep := map[string]interface{}{
+			"name":             name,
+			"req":              "*",
+			"features":         make([]interface{}, 0),
+			"optional":         false,
+			"default_features": true,
+			"target":           nil,
+			"kind":             kind,
+			"registry":         "",
+		}
+
+		if target != "" {
+			dep["target"] = target
+		}
+
+		switch value := table[name].(type) {
+		case string:
+			dep["req"] = value
+
+		case map[string]interface{}:
+			// dev dependencies without version (path or git only) are stripped by cargo on publish
+			if _, ok := value["version"]; !ok && kind == "dev" {
+				continue
+			}
+
+			if req, ok := value["version"].(string); ok {
+				dep["req"] = req
+			}
+			if featureList, ok := value["features"].([]interface{}); ok {
+				dep["features"] = featureList
+			}
+			if optional, ok := value["optional"].(bool); ok {
+				dep["optional"] = optional
+			}
+			if defaultFeatures, ok := value["default-features"].(bool); ok {
+				dep["default_features"] = defaultFeatures
+			}
+			if registry, ok := value["registry"].(string); ok {
+				dep["registry"] = registry
+			}
+
+			// renamed dependency: name is the local name, package is the real crate name
+			if pkg, ok := value["package"].(string); ok && pkg != name {
+				dep["package"] = pkg
+			}
+		}
+
+		dependencyList = append(dependencyList, dep)
+	}
+
+	return dependencyList
+}
+
+// convert typed list into generic one, compatible with client.JsonMap
+func toInterfaceList(valueList []string) []interface{} {
+	result := make([]interface{}, 0)
+	for _, value := range valueList {
+		result = append(result, value)
+	}
+
+	return result
+}
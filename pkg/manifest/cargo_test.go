@@ -0,0 +1,79 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseCargoToml(t *testing.T) {
+	data := []byte(`
+[package]
+name = "acme-core"
+version = "1.2.0"
+description = "Internal core"
+rust-version = "1.70"
+
+[features]
+default = ["std"]
+std = []
+
+[dependencies]
+serde = "1.0"
+acme-log = { version = "0.3", registry = "pavlik", optional = true }
+json = { version = "1.0", package = "serde_json", default-features = false, features = ["std"] }
+
+[dev-dependencies]
+acme-testing = { path = "../testing" }
+
+[target.'cfg(unix)'.dependencies]
+libc = "0.2"
+`)
+
+	c, err := ParseCargoToml(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-core", c["name"])
+	assert.Equal(t, "1.2.0", c["version"])
+	assert.Equal(t, "Internal core", c["description"])
+	assert.Equal(t, "1.70", c["rust_version"])
+	assert.Equal(t, map[string]interface{}{
+		"default": []interface{}{"std"},
+		"std":     []interface{}{},
+	}, c["features"])
+
+	dependencyList := c["dependencies"].([]interface{})
+	assert.Len(t, dependencyList, 4)
+
+	dep := dependencyList[0].(map[string]interface{})
+	assert.Equal(t, "acme-log", dep["name"])
+	assert.Equal(t, "0.3", dep["req"])
+	assert.Equal(t, "pavlik", dep["registry"])
+	assert.Equal(t, true, dep["optional"])
+
+	dep = dependencyList[1].(map[string]interface{})
+	assert.Equal(t, "json", dep["name"])
+	assert.Equal(t, "serde_json", dep["package"])
+	assert.Equal(t, false, dep["default_features"])
+	assert.Equal(t, []interface{}{"std"}, dep["features"])
+
+	dep = dependencyList[2].(map[string]interface{})
+	assert.Equal(t, "serde", dep["name"])
+	assert.Equal(t, "1.0", dep["req"])
+	assert.Equal(t, "normal", dep["kind"])
+	assert.Nil(t, dep["target"])
+
+	dep = dependencyList[3].(map[string]interface{})
+	assert.Equal(t, "libc", dep["name"])
+	assert.Equal(t, "cfg(unix)", dep["target"])
+}
+
+func TestParseCargoToml_Error(t *testing.T) {
+	_, err := ParseCargoToml([]byte("[workspace]\nmembers = [\"core\"]\n"))
+	assert.IsType(t, &ParseError{}, err)
+
+	// fields inherited from workspace are not supported
+	_, err = ParseCargoToml([]byte("[package]\nname = \"acme-core\"\nversion = { workspace = true }\n"))
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParseCargoToml([]byte("[package\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// string attribute assignment: spec.name = "acme-auth"
+	gemspecStringRegexp = regexp.MustCompile(`\.(name|version|summary|description|homepage|license|required_ruby_version|required_rubygems_version)\s*=\s*(?:Gem::Requirement\.new\(\s*)?["']([^"']*)["']`)
+
+	// list attribute assignment: spec.authors = ["Acme", "Ops"]
+	gemspecListRegexp = regexp.MustCompile(`\.(authors|licenses|require_paths)\s*=\s*\[([^\]]*)\]`)
+
+	// dependency declaration: spec.add_dependency "rack", ">= 2.0", "< 3"
+	gemspecDependencyRegexp = regexp.MustCompile(`\.add_(runtime_|development_)?dependency[\s(]+["']([^"']+)["']((?:\s*,\s*["'][^"']*["'])*)`)
+
+	// any quoted string
+	gemspecQuotedRegexp = regexp.MustCompile(`["']([^"']*)["']`)
+)
+
+// ParseGemspec - extract static attributes from gemspec, gemspec is ruby code
+// and is never evaluated, so only string literals are recognized, e.g. version
+// defined as Acme::VERSION is left empty.
+func ParseGemspec(data []byte) (map[string]interface{}, error) {
+	content := string(data)
+	result := map[string]interface{}{
+		"name":                      "",
+		"version":                   "",
+		"summary":                   "",
+		"description":               "",
+		"homepage":                  "",
+		"required_ruby_version":     "",
+		"required_rubygems_version": "",
+		"authors":                   make([]interface{}, 0),
+		"licenses":                  make([]interface{}, 0),
+		"require_paths":             []interface{}{"lib"},
+	}
+
+	for _, match := range gemspecStringRegexp.FindAllStringSubmatch(content, -1) {
+		if match[1] == "license" {
+			result["licenses"] = []interface{}{match[2]}
+			continue
+		}
+
+		result[match[1]] = match[2]
+	}
+
+	for _, match := range gemspecListRegexp.FindAllStringSubmatch(content, -1) {
+		result[match[1]] = getQuotedList(match[2])
+	}
+
+	dependencyList := make([]interface{}, 0)
+	for _, match := range gemspecDependencyRegexp.FindAllStringSubmatch(content, -1) {
+		kind := "runtime"
+		if match[1] == "development_" {
+			kind = "development"
+		}
+
+		dependencyList = append(dependencyList, map[string]interface{}{
+			"name":         match[2],
+			"requirements": getQuotedList(match[3]),
+			"type":         kind,
+		})
+	}
+	result["dependencies"] = dependencyList
+
+	if result["name"] == "" {
+		return nil, newParseError("gemspec", 0, "gem name is not defined")
+	}
+
+	return result, nil
+}
+
+//
+// Private API
+//
+
+// extract all quoted strings from ruby list
+func getQuotedList(value string) []interface{} {
+	result := make([]interface{}, 0)
+	for _, match := range gemspecQuotedRegexp.FindAllStringSubmatch(value, -1) {
+		if item := strings.TrimSpace(match[1]); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
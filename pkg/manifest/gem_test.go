@@ -0,0 +1,55 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseGemspec(t *testing.T) {
+	data := []byte(`
+require_relative "lib/acme/auth/version"
+
+Gem::Specification.new do |spec|
+  spec.name          = "acme-auth"
+  spec.version       = "1.2.0"
+  spec.authors       = ["Acme", 'Ops']
+  spec.summary       = %q{ignored}
+  spec.summary       = "Internal auth"
+  spec.license       = "MIT"
+  spec.required_ruby_version = Gem::Requirement.new(">= 2.7")
+
+  spec.files         = Dir["lib/**/*.rb"]
+
+  spec.add_dependency "rack", ">= 2.0", "< 3"
+  spec.add_runtime_dependency("jwt", "~> 2.2")
+  spec.add_development_dependency "rspec"
+end
+`)
+
+	g, err := ParseGemspec(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-auth", g["name"])
+	assert.Equal(t, "1.2.0", g["version"])
+	assert.Equal(t, "Internal auth", g["summary"])
+	assert.Equal(t, ">= 2.7", g["required_ruby_version"])
+	assert.Equal(t, []interface{}{"Acme", "Ops"}, g["authors"])
+	assert.Equal(t, []interface{}{"MIT"}, g["licenses"])
+	assert.Equal(t, []interface{}{"lib"}, g["require_paths"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "rack", "requirements": []interface{}{">= 2.0", "< 3"}, "type": "runtime"},
+		map[string]interface{}{"name": "jwt", "requirements": []interface{}{"~> 2.2"}, "type": "runtime"},
+		map[string]interface{}{"name": "rspec", "requirements": []interface{}{}, "type": "development"},
+	}, g["dependencies"])
+}
+
+func TestParseGemspec_Constant(t *testing.T) {
+	g, err := ParseGemspec([]byte("Gem::Specification.new do |s|\n  s.name = 'acme-auth'\n  s.version = Acme::Auth::VERSION\nend\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-auth", g["name"])
+	assert.Equal(t, "", g["version"])
+}
+
+func TestParseGemspec_Error(t *testing.T) {
+	_, err := ParseGemspec([]byte("Gem::Specification.new do |s|\n  s.name = NAME\nend\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
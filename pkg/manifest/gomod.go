@@ -0,0 +1,113 @@
+package manifest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseGoMod - parse go.mod file, only module, go and require directives are
+// extracted, everything else (replace, exclude, retract) is not relevant for registry.
+func ParseGoMod(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, 0)
+	requireList := make([]interface{}, 0)
+
+	block := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNum := i + 1
+
+		if pos := strings.Index(line, "//"); pos >= 0 {
+			line = line[:pos]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// inside of "require (...)" like block
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+
+			if block == "require" {
+				req, err := parseGoModRequire(fields, lineNum)
+				if err != nil {
+					return nil, err
+				}
+				requireList = append(requireList, req)
+			}
+			continue
+		}
+
+		// beginning of the block
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, newParseError("go.mod", lineNum, "usage: module module/path")
+			}
+
+			path, err := unquoteGoModToken(fields[1])
+			if err != nil || path == "" {
+				return nil, newParseError("go.mod", lineNum, "invalid module path: %s", fields[1])
+			}
+			result["module"] = path
+
+		case "go":
+			if len(fields) != 2 {
+				return nil, newParseError("go.mod", lineNum, "usage: go 1.23")
+			}
+			result["go"] = fields[1]
+
+		case "require":
+			req, err := parseGoModRequire(fields[1:], lineNum)
+			if err != nil {
+				return nil, err
+			}
+			requireList = append(requireList, req)
+		}
+	}
+
+	if block != "" {
+		return nil, newParseError("go.mod", 0, "unterminated %s block", block)
+	}
+
+	if _, ok := result["module"]; !ok {
+		return nil, newParseError("go.mod", 0, "no module directive found")
+	}
+
+	result["require"] = requireList
+	return result, nil
+}
+
+// parse single "path version" require entry
+func parseGoModRequire(fields []string, lineNum int) (map[string]interface{}, error) {
+	if len(fields) != 2 {
+		return nil, newParseError("go.mod", lineNum, "usage: require module/path v1.2.3")
+	}
+
+	path, err := unquoteGoModToken(fields[0])
+	if err != nil {
+		return nil, newParseError("go.mod", lineNum, "invalid module path: %s", fields[0])
+	}
+
+	return map[string]interface{}{
+		"path":    path,
+		"version": fields[1],
+	}, nil
+}
+
+// module paths are allowed to be quoted
+func unquoteGoModToken(token string) (string, error) {
+	if strings.HasPrefix(token, "\"") || strings.HasPrefix(token, "`") {
+		return strconv.Unquote(token)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,46 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseGoMod(t *testing.T) {
+	data := []byte(`// example module
+module "gitlab.example.com/acme/tools/v2"
+
+go 1.21
+
+require github.com/pkg/errors v0.9.1 // indirect
+
+require (
+	golang.org/x/mod v0.14.0
+	gitlab.example.com/acme/base v1.2.3
+)
+
+replace gitlab.example.com/acme/base => ../base
+`)
+
+	mod, err := ParseGoMod(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "gitlab.example.com/acme/tools/v2", mod["module"])
+	assert.Equal(t, "1.21", mod["go"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"path": "github.com/pkg/errors", "version": "v0.9.1"},
+		map[string]interface{}{"path": "golang.org/x/mod", "version": "v0.14.0"},
+		map[string]interface{}{"path": "gitlab.example.com/acme/base", "version": "v1.2.3"},
+	}, mod["require"])
+}
+
+func TestParseGoMod_Error(t *testing.T) {
+	_, err := ParseGoMod([]byte("go 1.21\n"))
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "go.mod: no module directive found", err.Error())
+
+	_, err = ParseGoMod([]byte("module a/b\nrequire (\n\tc/d\n)\n"))
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "go.mod:3: usage: require module/path v1.2.3", err.Error())
+
+	_, err = ParseGoMod([]byte("module a/b\nrequire (\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,51 @@
+package manifest
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+// ParseChart - parse Chart.yaml, whole file is returned since
+// every field is copied to repository index.yaml
+func ParseChart(data []byte) (map[string]interface{}, error) {
+	raw := make(map[interface{}]interface{}, 0)
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, newParseError("Chart.yaml", 0, "%s", err)
+	}
+
+	chart := convertYamlMap(raw)
+	for _, key := range []string{"name", "version"} {
+		if value, ok := chart[key].(string); !ok || value == "" {
+			return nil, newParseError("Chart.yaml", 0, "%s is not defined", key)
+		}
+	}
+
+	return chart, nil
+}
+
+// yaml maps are decoded with interface{} keys, which are not supported by json
+func convertYamlMap(raw map[interface{}]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, 0)
+	for key, value := range raw {
+		result[fmt.Sprintf("%v", key)] = convertYamlValue(value)
+	}
+
+	return result
+}
+
+// convert nested yaml value
+func convertYamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		return convertYamlMap(v)
+
+	case []interface{}:
+		list := make([]interface{}, 0)
+		for _, item := range v {
+			list = append(list, convertYamlValue(item))
+		}
+		return list
+	}
+
+	return value
+}
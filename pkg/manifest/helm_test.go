@@ -0,0 +1,37 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseChart(t *testing.T) {
+	data := []byte(`
+apiVersion: v2
+name: acme-api
+version: 1.2.0
+appVersion: "3.1"
+description: Acme API
+maintainers:
+  - name: platform
+    email: platform@example.com
+`)
+
+	chart, err := ParseChart(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-api", chart["name"])
+	assert.Equal(t, "1.2.0", chart["version"])
+	assert.Equal(t, "3.1", chart["appVersion"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "platform", "email": "platform@example.com"},
+	}, chart["maintainers"])
+}
+
+func TestParseChart_Error(t *testing.T) {
+	_, err := ParseChart([]byte("apiVersion: v2\nname: acme-api\n"))
+	assert.IsType(t, &ParseError{}, err)
+	assert.Equal(t, "Chart.yaml: version is not defined", err.Error())
+
+	_, err = ParseChart([]byte("name: [acme-api\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
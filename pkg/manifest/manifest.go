@@ -0,0 +1,39 @@
+package manifest
+
+// Parsers for package metadata files which are not json,
+// every parser returns generic map, compatible with client.JsonMap
+
+import (
+	"fmt"
+)
+
+type (
+	// ParseError - metadata file is malformed
+	ParseError struct {
+		File string
+		Line int
+		Msg  string
+	}
+)
+
+// Error - implement error interface
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+//
+// Private API
+//
+
+// create new parse error
+func newParseError(file string, line int, format string, args ...interface{}) error {
+	return &ParseError{
+		File: file,
+		Line: line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,53 @@
+package manifest
+
+import (
+	"encoding/xml"
+)
+
+type (
+	// coordinates and description from pom.xml
+	pomProject struct {
+		GroupID     string `xml:"groupId"`
+		ArtifactID  string `xml:"artifactId"`
+		Version     string `xml:"version"`
+		Packaging   string `xml:"packaging"`
+		Name        string `xml:"name"`
+		Description string `xml:"description"`
+		Parent      struct {
+			GroupID string `xml:"groupId"`
+			Version string `xml:"version"`
+		} `xml:"parent"`
+	}
+)
+
+// ParsePom - parse pom.xml, groupId and version are inherited from parent
+// when not defined, property references (e.g. ${revision}) are not resolved.
+func ParsePom(data []byte) (map[string]interface{}, error) {
+	p := pomProject{}
+	if err := xml.Unmarshal(data, &p); err != nil {
+		return nil, newParseError("pom.xml", 0, "%s", err)
+	}
+
+	if p.GroupID == "" {
+		p.GroupID = p.Parent.GroupID
+	}
+	if p.Version == "" {
+		p.Version = p.Parent.Version
+	}
+	if p.Packaging == "" {
+		p.Packaging = "jar"
+	}
+
+	if p.GroupID == "" || p.ArtifactID == "" {
+		return nil, newParseError("pom.xml", 0, "groupId and artifactId should be defined")
+	}
+
+	return map[string]interface{}{
+		"groupId":     p.GroupID,
+		"artifactId":  p.ArtifactID,
+		"version":     p.Version,
+		"packaging":   p.Packaging,
+		"name":        p.Name,
+		"description": p.Description,
+	}, nil
+}
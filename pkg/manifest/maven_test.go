@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePom(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <modelVersion>4.0.0</modelVersion>
+  <parent>
+    <groupId>com.example.acme</groupId>
+    <artifactId>acme-parent</artifactId>
+    <version>1.0.0</version>
+  </parent>
+  <artifactId>acme-client</artifactId>
+  <version>1.2.0</version>
+  <name>Acme client</name>
+  <dependencies>
+    <dependency>
+      <groupId>com.squareup.okhttp3</groupId>
+      <artifactId>okhttp</artifactId>
+      <version>4.12.0</version>
+    </dependency>
+  </dependencies>
+</project>
+`)
+
+	pom, err := ParsePom(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "com.example.acme", pom["groupId"])
+	assert.Equal(t, "acme-client", pom["artifactId"])
+	assert.Equal(t, "1.2.0", pom["version"])
+	assert.Equal(t, "jar", pom["packaging"])
+	assert.Equal(t, "Acme client", pom["name"])
+}
+
+func TestParsePom_Error(t *testing.T) {
+	_, err := ParsePom([]byte("<project><artifactId>acme-client</artifactId></project>"))
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParsePom([]byte("<project>"))
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,155 @@
+package manifest
+
+import (
+	"github.com/BurntSushi/toml"
+	"strings"
+)
+
+type (
+	// PEP 621 and poetry flavours of pyproject.toml
+	pyProject struct {
+		Project struct {
+			Name           string   `toml:"name"`
+			Version        string   `toml:"version"`
+			Description    string   `toml:"description"`
+			RequiresPython string   `toml:"requires-python"`
+			Dependencies   []string `toml:"dependencies"`
+		} `toml:"project"`
+
+		Tool struct {
+			Poetry struct {
+				Name         string                 `toml:"name"`
+				Version      string                 `toml:"version"`
+				Description  string                 `toml:"description"`
+				Dependencies map[string]interface{} `toml:"dependencies"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+)
+
+// ParsePyProject - parse pyproject.toml, both [project] and [tool.poetry] tables are supported
+func ParsePyProject(data []byte) (map[string]interface{}, error) {
+	p := pyProject{}
+	if err := toml.Unmarshal(data, &p); err != nil {
+		return nil, newParseError("pyproject.toml", 0, "%s", err)
+	}
+
+	result := make(map[string]interface{}, 0)
+	dependencyList := make([]interface{}, 0)
+
+	switch {
+	case p.Project.Name != "":
+		result["name"] = p.Project.Name
+		result["version"] = p.Project.Version
+		result["summary"] = p.Project.Description
+		result["requires_python"] = p.Project.RequiresPython
+
+		for _, dep := range p.Project.Dependencies {
+			dependencyList = append(dependencyList, dep)
+		}
+
+	case p.Tool.Poetry.Name != "":
+		result["name"] = p.Tool.Poetry.Name
+		result["version"] = p.Tool.Poetry.Version
+		result["summary"] = p.Tool.Poetry.Description
+
+		// poetry keeps interpreter constraint among dependencies,
+		// caret and tilde constraints are not valid PEP 440 specifiers
+		python, _ := p.Tool.Poetry.Dependencies["python"].(string)
+		if strings.Contains(python, "^") || strings.Contains(strings.Replace(python, "~=", "", -1), "~") {
+			python = ""
+		}
+		result["requires_python"] = python
+
+	default:
+		return nil, newParseError("pyproject.toml", 0, "project name is not defined")
+	}
+
+	result["dependencies"] = dependencyList
+	return result, nil
+}
+
+// ParseSetupCfg - parse setup.cfg, [metadata] and [options] sections are used
+func ParseSetupCfg(data []byte) (map[string]interface{}, error) {
+	sectionList, err := parseIni("setup.cfg", data)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := sectionList["metadata"]
+	options := sectionList["options"]
+
+	name := metadata["name"]
+	if name == "" {
+		return nil, newParseError("setup.cfg", 0, "project name is not defined")
+	}
+
+	dependencyList := make([]interface{}, 0)
+	for _, dep := range strings.Split(options["install_requires"], "\n") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			dependencyList = append(dependencyList, dep)
+		}
+	}
+
+	// "attr:" and "file:" directives require code execution, version is taken from tag then
+	version := metadata["version"]
+	if strings.Contains(version, ":") {
+		version = ""
+	}
+
+	summary := metadata["description"]
+	if summary == "" {
+		summary = metadata["summary"]
+	}
+
+	return map[string]interface{}{
+		"name":            name,
+		"version":         version,
+		"summary":         summary,
+		"requires_python": options["python_requires"],
+		"dependencies":    dependencyList,
+	}, nil
+}
+
+// parse ini file, indented lines are continuation of previous value
+func parseIni(file string, data []byte) (map[string]map[string]string, error) {
+	sectionList := make(map[string]map[string]string, 0)
+	section := ""
+	key := ""
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		// continuation of multi-line value
+		if key != "" && (line[0] == ' ' || line[0] == '\t') {
+			value := sectionList[section][key]
+			if value != "" {
+				value += "\n"
+			}
+			sectionList[section][key] = value + trimmed
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			key = ""
+			if sectionList[section] == nil {
+				sectionList[section] = make(map[string]string, 0)
+			}
+			continue
+		}
+
+		pos := strings.IndexAny(trimmed, "=:")
+		if pos < 0 || section == "" {
+			return nil, newParseError(file, i+1, "unexpected line: %s", trimmed)
+		}
+
+		key = strings.TrimSpace(trimmed[:pos])
+		sectionList[section][key] = strings.TrimSpace(trimmed[pos+1:])
+	}
+
+	return sectionList, nil
+}
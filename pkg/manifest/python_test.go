@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePyProject(t *testing.T) {
+	data := []byte(`
+[build-system]
+requires = ["setuptools>=61"]
+
+[project]
+name = "acme-tools"
+version = "1.2.0"
+description = "Internal tools"
+requires-python = ">=3.8"
+dependencies = ["requests>=2.0", "click"]
+`)
+
+	p, err := ParsePyProject(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-tools", p["name"])
+	assert.Equal(t, "1.2.0", p["version"])
+	assert.Equal(t, "Internal tools", p["summary"])
+	assert.Equal(t, ">=3.8", p["requires_python"])
+	assert.Equal(t, []interface{}{"requests>=2.0", "click"}, p["dependencies"])
+}
+
+func TestParsePyProject_Poetry(t *testing.T) {
+	data := []byte(`
+[tool.poetry]
+name = "acme-tools"
+version = "1.2.0"
+description = "Internal tools"
+
+[tool.poetry.dependencies]
+python = ">=3.8,<4.0"
+requests = "^2.0"
+`)
+
+	p, err := ParsePyProject(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-tools", p["name"])
+	assert.Equal(t, ">=3.8,<4.0", p["requires_python"])
+
+	p, err = ParsePyProject([]byte("[tool.poetry]\nname = \"acme-tools\"\n[tool.poetry.dependencies]\npython = \"^3.8\"\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", p["requires_python"])
+}
+
+func TestParsePyProject_Error(t *testing.T) {
+	_, err := ParsePyProject([]byte("[build-system]\nrequires = [\"setuptools\"]\n"))
+	assert.IsType(t, &ParseError{}, err)
+
+	_, err = ParsePyProject([]byte("[project\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestParseSetupCfg(t *testing.T) {
+	data := []byte(`
+[metadata]
+name = acme-tools
+version = attr: acme_tools.__version__
+description = Internal tools
+
+[options]
+python_requires = >=3.8
+install_requires =
+    requests>=2.0
+    click
+`)
+
+	p, err := ParseSetupCfg(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "acme-tools", p["name"])
+	assert.Equal(t, "", p["version"])
+	assert.Equal(t, "Internal tools", p["summary"])
+	assert.Equal(t, ">=3.8", p["requires_python"])
+	assert.Equal(t, []interface{}{"requests>=2.0", "click"}, p["dependencies"])
+}
+
+func TestParseSetupCfg_Error(t *testing.T) {
+	_, err := ParseSetupCfg([]byte("[options]\nzip_safe = False\n"))
+	assert.IsType(t, &ParseError{}, err)
+}
@@ -0,0 +1,328 @@
+package metrics
+
+//
+// Minimal Prometheus text exposition format implementation.
+// Only counters, gauges and histograms required by Pavlik are supported.
+//
+// @see https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Collector - anything which can write itself in exposition format
+	Collector interface {
+		Write(w io.Writer)
+	}
+
+	// CounterVec - monotonic counter partitioned by labels
+	CounterVec struct {
+		name       string
+		help       string
+		labelNames []string
+		values     map[string]float64
+		lock       *sync.Mutex
+	}
+
+	// GaugeFunc - gauge which value is calculated on each scrape
+	GaugeFunc struct {
+		name string
+		help string
+		fn   func() float64
+	}
+
+	// GaugeVec - gauge partitioned by labels
+	GaugeVec struct {
+		name       string
+		help       string
+		labelNames []string
+		values     map[string]float64
+		lock       *sync.Mutex
+	}
+
+	// HistogramVec - histogram partitioned by labels
+	HistogramVec struct {
+		name       string
+		help       string
+		labelNames []string
+		buckets    []float64
+		values     map[string]*histogramValue
+		lock       *sync.Mutex
+	}
+
+	histogramValue struct {
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+)
+
+var (
+	// DefaultBuckets - latency buckets, in seconds
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+	collectorList []Collector
+	collectorLock = new(sync.Mutex)
+)
+
+// Register - add collector to the global list of exposed metrics
+func Register(c Collector) {
+	collectorLock.Lock()
+	collectorList = append(collectorList, c)
+	collectorLock.Unlock()
+}
+
+// WriteAll - write every registered metric in exposition format
+func WriteAll(w io.Writer) {
+	collectorLock.Lock()
+	list := make([]Collector, len(collectorList))
+	copy(list, collectorList)
+	collectorLock.Unlock()
+
+	for _, c := range list {
+		c.Write(w)
+	}
+}
+
+// NewCounterVec - create and register new counter
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]float64, 0),
+		lock:       new(sync.Mutex),
+	}
+
+	Register(c)
+	return c
+}
+
+// Inc - increment counter for provided label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add - add value to counter for provided label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := formatLabels(c.labelNames, labelValues)
+
+	c.lock.Lock()
+	c.values[key] += v
+	c.lock.Unlock()
+}
+
+// Write - implements Collector
+func (c *CounterVec) Write(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+// NewGaugeFunc - create and register new gauge with calculated value
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		name: name,
+		help: help,
+		fn:   fn,
+	}
+
+	Register(g)
+	return g
+}
+
+// Write - implements Collector
+func (g *GaugeFunc) Write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+// NewGaugeVec - create and register new gauge
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]float64, 0),
+		lock:       new(sync.Mutex),
+	}
+
+	Register(g)
+	return g
+}
+
+// Add - add (possibly negative) value to gauge for provided label values
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	key := formatLabels(g.labelNames, labelValues)
+
+	g.lock.Lock()
+	g.values[key] += v
+	g.lock.Unlock()
+}
+
+// Set - set gauge value for provided label values
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := formatLabels(g.labelNames, labelValues)
+
+	g.lock.Lock()
+	g.values[key] = v
+	g.lock.Unlock()
+}
+
+// Write - implements Collector
+func (g *GaugeVec) Write(w io.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, key, formatFloat(g.values[key]))
+	}
+}
+
+// NewHistogramVec - create and register new histogram
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     make(map[string]*histogramValue, 0),
+		lock:       new(sync.Mutex),
+	}
+
+	Register(h)
+	return h
+}
+
+// Observe - record single observation for provided label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := formatLabels(h.labelNames, labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = value
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+// ObserveSince - record duration elapsed since start, in seconds
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Write - implements Collector
+func (h *HistogramVec) Write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+
+	keyList := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keyList = append(keyList, key)
+	}
+	sort.Strings(keyList)
+
+	for _, key := range keyList {
+		value := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, appendLabel(key, "le", formatFloat(upper)), value.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, appendLabel(key, "le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatFloat(value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, value.count)
+	}
+}
+
+//
+// Private API
+//
+
+// write HELP and TYPE lines
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// format label set as {name="value",...}, missing values are rendered as empty strings
+func formatLabels(labelNames, labelValues []string) string {
+	if len(labelNames) == 0 {
+		return ""
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("{")
+	for i, name := range labelNames {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(buf, "%s=\"%s\"", name, escapeLabelValue(value))
+	}
+	buf.WriteString("}")
+
+	return buf.String()
+}
+
+// append one more label to already formatted label set
+func appendLabel(labels, name, value string) string {
+	label := fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(value))
+	if labels == "" {
+		return fmt.Sprintf("{%s}", label)
+	}
+
+	return fmt.Sprintf("%s,%s}", strings.TrimSuffix(labels, "}"), label)
+}
+
+// escape backslash, double-quote and line feed in label value
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+// format sample value
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
+
+// return map keys in stable order
+func sortedKeys(values map[string]float64) []string {
+	keyList := make([]string, 0, len(values))
+	for key := range values {
+		keyList = append(keyList, key)
+	}
+	sort.Strings(keyList)
+
+	return keyList
+}
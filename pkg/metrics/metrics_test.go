@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestCounterVec_Write(t *testing.T) {
+	c := &CounterVec{
+		name:       "test_total",
+		help:       "Test counter.",
+		labelNames: []string{"route", "code"},
+		values:     make(map[string]float64, 0),
+		lock:       new(sync.Mutex),
+	}
+
+	c.Inc("npm_tgz", "200")
+	c.Inc("npm_tgz", "200")
+	c.Inc("composer_zip", "500")
+
+	buf := new(bytes.Buffer)
+	c.Write(buf)
+
+	expected := "# HELP test_total Test counter.\n" +
+		"# TYPE test_total counter\n" +
+		"test_total{route=\"composer_zip\",code=\"500\"} 1\n" +
+		"test_total{route=\"npm_tgz\",code=\"200\"} 2\n"
+
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestHistogramVec_Write(t *testing.T) {
+	h := &HistogramVec{
+		name:       "test_seconds",
+		help:       "Test histogram.",
+		labelNames: []string{"method"},
+		buckets:    []float64{0.1, 1},
+		values:     make(map[string]*histogramValue, 0),
+		lock:       new(sync.Mutex),
+	}
+
+	h.Observe(0.05, "GetFile")
+	h.Observe(0.5, "GetFile")
+	h.Observe(5, "GetFile")
+
+	buf := new(bytes.Buffer)
+	h.Write(buf)
+
+	expected := "# HELP test_seconds Test histogram.\n" +
+		"# TYPE test_seconds histogram\n" +
+		"test_seconds_bucket{method=\"GetFile\",le=\"0.1\"} 1\n" +
+		"test_seconds_bucket{method=\"GetFile\",le=\"1\"} 2\n" +
+		"test_seconds_bucket{method=\"GetFile\",le=\"+Inf\"} 3\n" +
+		"test_seconds_sum{method=\"GetFile\"} 5.55\n" +
+		"test_seconds_count{method=\"GetFile\"} 3\n"
+
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFormatLabels_Escape(t *testing.T) {
+	labels := formatLabels([]string{"name"}, []string{"a\"b\\c\nd"})
+	assert.Equal(t, `{name="a\"b\\c\nd"}`, labels)
+}
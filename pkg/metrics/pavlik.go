@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"runtime"
+)
+
+//
+// All metrics exposed by Pavlik.
+//
+var (
+	// HTTPRequestsTotal - requests served, per route and response code
+	HTTPRequestsTotal = NewCounterVec(
+		"pavlik_http_requests_total",
+		"Total number of HTTP requests served.",
+		"route", "code",
+	)
+
+	// HTTPRequestDuration - request latency, per route
+	HTTPRequestDuration = NewHistogramVec(
+		"pavlik_http_request_duration_seconds",
+		"HTTP request latency in seconds.",
+		DefaultBuckets,
+		"route",
+	)
+
+	// HTTPRequestsInFlight - requests currently being served, per route
+	HTTPRequestsInFlight = NewGaugeVec(
+		"pavlik_http_requests_in_flight",
+		"Number of HTTP requests currently being served.",
+		"route",
+	)
+
+	// GitLabRequestsTotal - calls made to GitLab API, per client method and response code
+	GitLabRequestsTotal = NewCounterVec(
+		"pavlik_gitlab_requests_total",
+		"Total number of GitLab API calls.",
+		"method", "code",
+	)
+
+	// GitLabRequestDuration - GitLab API latency, per client method
+	GitLabRequestDuration = NewHistogramVec(
+		"pavlik_gitlab_request_duration_seconds",
+		"GitLab API call latency in seconds.",
+		DefaultBuckets,
+		"method",
+	)
+
+	// GitLabRetriesTotal - failed GitLab API calls scheduled for retry, per client method
+	GitLabRetriesTotal = NewCounterVec(
+		"pavlik_gitlab_retries_total",
+		"Total number of retried GitLab API calls.",
+		"method",
+	)
+
+	// CacheRequestsTotal - cache lookups, per cache and result (hit/miss)
+	CacheRequestsTotal = NewCounterVec(
+		"pavlik_cache_requests_total",
+		"Total number of cache lookups.",
+		"cache", "result",
+	)
+
+	// CacheEvictionsTotal - entries evicted from cache due size limit
+	CacheEvictionsTotal = NewCounterVec(
+		"pavlik_cache_evictions_total",
+		"Total number of entries evicted from cache.",
+		"cache",
+	)
+
+	// MovedTagsTotal - tags moved to another commit since first seen, per policy applied
+	MovedTagsTotal = NewCounterVec(
+		"pavlik_moved_tags_total",
+		"Total number of moved (force-pushed) tags detected.",
+		"policy",
+	)
+
+	// RepackDuration - time spent for repacking GitLab archive, per format
+	RepackDuration = NewHistogramVec(
+		"pavlik_repack_duration_seconds",
+		"GitLab archive repack duration in seconds.",
+		DefaultBuckets,
+		"format",
+	)
+
+	// Goroutines - number of goroutines currently running
+	Goroutines = NewGaugeFunc(
+		"pavlik_goroutines",
+		"Number of goroutines that currently exist.",
+		func() float64 {
+			return float64(runtime.NumGoroutine())
+		},
+	)
+)
+
+// CacheHit - record cache hit
+func CacheHit(cache string) {
+	CacheRequestsTotal.Inc(cache, "hit")
+}
+
+// CacheMiss - record cache miss
+func CacheMiss(cache string) {
+	CacheRequestsTotal.Inc(cache, "miss")
+}
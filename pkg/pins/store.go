@@ -0,0 +1,270 @@
+package pins
+
+// First-seen commits of package tags, moved (force-pushed) tags are detected
+// by comparing commit reported by GitLab with pinned one.
+
+import (
+	"comrade-pavlik2/pkg/metrics"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Pin - first-seen commit of package tag
+	Pin struct {
+		UUID      string    `json:"package"`
+		Tag       string    `json:"tag"`
+		Reference string    `json:"reference"`
+		Created   time.Time `json:"created"`
+		Moved     string    `json:"moved,omitempty"` // last reported commit, event is recorded once per commit
+	}
+
+	// Event - tag reported by GitLab on another commit than pinned
+	Event struct {
+		Time     time.Time `json:"time"`
+		UUID     string    `json:"package"`
+		Project  string    `json:"project"`
+		Tag      string    `json:"tag"`
+		Pinned   string    `json:"pinned"`
+		Reported string    `json:"reported"`
+		Policy   string    `json:"policy"`
+	}
+
+	// Store - pins and events, persisted as json file when data directory is provided
+	Store struct {
+		path      string
+		policy    string
+		lock      *sync.Mutex
+		pinList   map[string]*Pin
+		eventList []Event
+		dirty     bool
+	}
+
+	// persisted store
+	storeData struct {
+		PinList   []*Pin  `json:"pins"`
+		EventList []Event `json:"events"`
+	}
+)
+
+var (
+	// PolicyKeep - keep serving pinned commit
+	PolicyKeep = "keep"
+
+	// PolicyRefuse - stop serving moved tag
+	PolicyRefuse = "refuse"
+
+	// PolicyAccept - serve and pin reported commit
+	PolicyAccept = "accept"
+
+	// ErrUnknownPolicy - policy is not one of keep, refuse or accept
+	ErrUnknownPolicy = errors.New("Unknown moved tag policy")
+
+	storeFile    = "tags.json"
+	maxEventList = 1000
+)
+
+// NewStore - load pins from data directory, pins are kept in memory only
+// when directory is not provided, policy is "keep" by default.
+func NewStore(dataDir, policy string) (*Store, error) {
+	if policy == "" {
+		policy = PolicyKeep
+	}
+
+	if policy != PolicyKeep && policy != PolicyRefuse && policy != PolicyAccept {
+		return nil, ErrUnknownPolicy
+	}
+
+	s := &Store{
+		policy:    policy,
+		lock:      new(sync.Mutex),
+		pinList:   make(map[string]*Pin),
+		eventList: make([]Event, 0),
+	}
+
+	if dataDir == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	s.path = filepath.Join(dataDir, storeFile)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &storeData{}
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil, err
+	}
+
+	for _, p := range stored.PinList {
+		s.pinList[getPinKey(p.UUID, p.Tag)] = p
+	}
+	if stored.EventList != nil {
+		s.eventList = stored.EventList
+	}
+
+	return s, nil
+}
+
+// Check - pin commit of tag seen first time, or compare it with pinned one,
+// moved tag is recorded as event. Commit to serve is returned, tag should
+// not be served at all when false is returned.
+func (s *Store) Check(uuid, project, tag, reference string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := getPinKey(uuid, tag)
+	p, ok := s.pinList[key]
+	if !ok {
+		s.pinList[key] = &Pin{
+			UUID:      uuid,
+			Tag:       tag,
+			Reference: reference,
+			Created:   time.Now().UTC(),
+		}
+		s.dirty = true
+		return reference, true
+	}
+
+	// tag is moved back, next move is recorded again
+	if p.Reference == reference {
+		if p.Moved != "" {
+			p.Moved = ""
+			s.dirty = true
+		}
+
+		return reference, true
+	}
+
+	if p.Moved != reference {
+		log.Printf("==> WARNING: Tag %s of %s moved from %s to %s, policy: %s", tag, project, p.Reference, reference, s.policy)
+		metrics.MovedTagsTotal.Inc(s.policy)
+
+		p.Moved = reference
+		s.addEvent(Event{
+			Time:     time.Now().UTC(),
+			UUID:     uuid,
+			Project:  project,
+			Tag:      tag,
+			Pinned:   p.Reference,
+			Reported: reference,
+			Policy:   s.policy,
+		})
+	}
+
+	switch s.policy {
+	case PolicyRefuse:
+		return "", false
+
+	case PolicyAccept:
+		p.Reference = reference
+		return reference, true
+	}
+
+	return p.Reference, true
+}
+
+// EventList - get recorded events, newest first
+func (s *Store) EventList() []Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	list := make([]Event, 0, len(s.eventList))
+	for i := len(s.eventList) - 1; i >= 0; i-- {
+		list = append(list, s.eventList[i])
+	}
+
+	return list
+}
+
+// Policy - get moved tag policy
+func (s *Store) Policy() string {
+	return s.policy
+}
+
+// Save - write pins to disk if anything is changed since last save
+func (s *Store) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.dirty || s.path == "" {
+		return nil
+	}
+
+	stored := &storeData{
+		PinList:   make([]*Pin, 0, len(s.pinList)),
+		EventList: s.eventList,
+	}
+
+	for _, p := range s.pinList {
+		stored.PinList = append(stored.PinList, p)
+	}
+
+	sort.Slice(stored.PinList, func(i, j int) bool {
+		return getPinKey(stored.PinList[i].UUID, stored.PinList[i].Tag) < getPinKey(stored.PinList[j].UUID, stored.PinList[j].Tag)
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// store is never left half-written
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// AutoSave - save pins in background, pins and events collected
+// since last save are lost if process is killed.
+func (s *Store) AutoSave(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.Save(); err != nil {
+				log.Printf("==> Pins: failed to save pins: %s", err)
+			}
+		}
+	}()
+}
+
+//
+// Private API
+//
+
+// oldest events are dropped
+func (s *Store) addEvent(e Event) {
+	s.eventList = append(s.eventList, e)
+	if len(s.eventList) > maxEventList {
+		s.eventList = s.eventList[len(s.eventList)-maxEventList:]
+	}
+
+	s.dirty = true
+}
+
+// uuid and tag can't contain new line
+func getPinKey(uuid, tag string) string {
+	return uuid + "\n" + tag
+}
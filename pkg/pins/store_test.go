@@ -0,0 +1,86 @@
+package pins
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestNewStore_UnknownPolicy(t *testing.T) {
+	s, err := NewStore("", "ignore")
+
+	assert.Equal(t, ErrUnknownPolicy, err)
+	assert.Nil(t, s)
+}
+
+func TestStore_Check_Keep(t *testing.T) {
+	s, err := NewStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reference, ok := s.Check("48bfe31a", "acme/auth", "v1.0.0", "aaa")
+	assert.True(t, ok)
+	assert.Equal(t, "aaa", reference)
+
+	reference, ok = s.Check("48bfe31a", "acme/auth", "v1.0.0", "bbb")
+	assert.True(t, ok)
+	assert.Equal(t, "aaa", reference)
+
+	// event is recorded once per reported commit
+	reference, ok = s.Check("48bfe31a", "acme/auth", "v1.0.0", "bbb")
+	assert.True(t, ok)
+	assert.Equal(t, "aaa", reference)
+
+	eventList := s.EventList()
+	assert.Len(t, eventList, 1)
+	assert.Equal(t, "aaa", eventList[0].Pinned)
+	assert.Equal(t, "bbb", eventList[0].Reported)
+	assert.Equal(t, PolicyKeep, eventList[0].Policy)
+}
+
+func TestStore_Check_Refuse(t *testing.T) {
+	s, err := NewStore("", PolicyRefuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Check("48bfe31a", "acme/auth", "v1.0.0", "aaa")
+	_, ok := s.Check("48bfe31a", "acme/auth", "v1.0.0", "bbb")
+	assert.False(t, ok)
+
+	// other tags are not affected
+	_, ok = s.Check("48bfe31a", "acme/auth", "v1.1.0", "ccc")
+	assert.True(t, ok)
+}
+
+func TestStore_Check_Accept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir, PolicyAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Check("48bfe31a", "acme/auth", "v1.0.0", "aaa")
+	reference, ok := s.Check("48bfe31a", "acme/auth", "v1.0.0", "bbb")
+	assert.True(t, ok)
+	assert.Equal(t, "bbb", reference)
+	assert.Nil(t, s.Save())
+
+	// accepted commit is pinned after restart
+	s, err = NewStore(dir, PolicyAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reference, ok = s.Check("48bfe31a", "acme/auth", "v1.0.0", "bbb")
+	assert.True(t, ok)
+	assert.Equal(t, "bbb", reference)
+	assert.Len(t, s.EventList(), 1)
+}
@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"bytes"
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type (
+	CargoRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// CargoConfig - sparse index config.json
+	CargoConfig struct {
+		DL           string `json:"dl"`
+		AuthRequired bool   `json:"auth-required"`
+	}
+
+	// single line of sparse index file
+	cargoIndexEntry struct {
+		Name        string                   `json:"name"`
+		Vers        string                   `json:"vers"`
+		Deps        []map[string]interface{} `json:"deps"`
+		Cksum       string                   `json:"cksum"`
+		Features    map[string]interface{}   `json:"features"`
+		Features2   map[string]interface{}   `json:"features2,omitempty"`
+		Yanked      bool                     `json:"yanked"`
+		Links       string                   `json:"links,omitempty"`
+		V           int                      `json:"v,omitempty"`
+		RustVersion string                   `json:"rust_version,omitempty"`
+	}
+)
+
+var (
+	// ErrCargoCrateNotFound - crate or version is not served by registry
+	ErrCargoCrateNotFound = errors.New("Crate not found")
+
+	// dependencies without explicit registry are expected to be published on crates.io
+	cratesIoIndex = "https://github.com/rust-lang/crates.io-index"
+)
+
+// NewCargoRegistry - construct cargo sparse index emulator for GitLab
+func NewCargoRegistry(conn *client.GitLabConnection) *CargoRegistry {
+	return &CargoRegistry{
+		conn: conn,
+	}
+}
+
+// GetIndexFile - get sparse index file of a crate, one json entry per valid tag,
+// every archive is repacked in order to calculate checksum.
+func (c *CargoRegistry) GetIndexFile(ctx context.Context, name string) ([]byte, error) {
+	repo, err := c.findCrateByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entryChan := make(chan *cargoIndexEntry)
+	guardChan := make(chan bool, runtime.NumCPU())
+
+	log.Println("==> Processing tags:", repo.Project.Name)
+	for _, tag := range repo.TagList {
+		go func(tag client.Tag) {
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				entryChan <- nil
+				return
+			}
+			defer func() {
+				<-guardChan
+			}()
+
+			entry, err := c.getIndexEntry(ctx, repo, tag)
+			if err != nil {
+				entryChan <- nil
+				return
+			}
+
+			entryChan <- entry
+		}(tag)
+	}
+
+	entryList := make([]*cargoIndexEntry, 0)
+	for i := 0; i < len(repo.TagList); i++ {
+		if entry := <-entryChan; entry != nil {
+			entryList = append(entryList, entry)
+		}
+	}
+
+	// request is cancelled, index file is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entryList) == 0 {
+		return nil, ErrCargoCrateNotFound
+	}
+
+	// oldest version first, as cargo publish does
+	sort.Slice(entryList, func(i, j int) bool {
+		vi, _ := semver.Parse(entryList[i].Vers)
+		vj, _ := semver.Parse(entryList[j].Vers)
+		return vi.LT(vj)
+	})
+
+	buf := new(bytes.Buffer)
+	for _, entry := range entryList {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GetCrateArchive - get packaged crate of a given version
+func (c *CargoRegistry) GetCrateArchive(ctx context.Context, name, version string) ([]byte, error) {
+	repo, err := c.findCrateByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range repo.TagList {
+		crateName, crateVersion, err := getCrateVersion(tag)
+		if err != nil || crateVersion != version {
+			continue
+		}
+
+		c.conn.SetDownload(client.KindCargo, repo.UUID, tag.Reference)
+		return c.getCrateArchive(ctx, repo, tag, crateName, crateVersion)
+	}
+
+	return nil, ErrCargoCrateNotFound
+}
+
+//
+// Private API
+//
+
+// build index entry: dependencies and features of Cargo.toml, and checksum
+func (c *CargoRegistry) getIndexEntry(ctx context.Context, repo *client.GitLabRepo, tag client.Tag) (*cargoIndexEntry, error) {
+	name, version, err := getCrateVersion(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	crate, err := c.getCrateArchive(ctx, repo, tag, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cargoIndexEntry{
+		Name:      name,
+		Vers:      version,
+		Deps:      make([]map[string]interface{}, 0),
+		Cksum:     fmt.Sprintf("%x", sha256.Sum256(crate)),
+		Features:  make(map[string]interface{}, 0),
+		Features2: make(map[string]interface{}, 0),
+	}
+
+	tag.MetadataLock.RLock()
+	defer tag.MetadataLock.RUnlock()
+
+	entry.Links, _ = tag.Metadata.GetString("links")
+	entry.RustVersion, _ = tag.Metadata.GetString("rust_version")
+
+	if dependencyList, err := tag.Metadata.GetListInterface("dependencies", nil); err == nil {
+		for _, item := range *dependencyList {
+			dep, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			// dependency with registry alias is expected to be served by Pavlik,
+			// null registry in index means the same registry
+			indexDep := make(map[string]interface{}, 0)
+			for key, value := range dep {
+				indexDep[key] = value
+			}
+			indexDep["registry"] = cratesIoIndex
+			if registry, _ := dep["registry"].(string); registry != "" {
+				indexDep["registry"] = nil
+			}
+
+			entry.Deps = append(entry.Deps, indexDep)
+		}
+	}
+
+	// features using "dep:" or "?/" syntax are only understood by newer cargo versions
+	if featureMap, err := tag.Metadata.GetMapInterface("features", nil); err == nil {
+		for feature, value := range *featureMap {
+			if isCargoFeature2(value) {
+				entry.Features2[feature] = value
+				entry.V = 2
+			} else {
+				entry.Features[feature] = value
+			}
+		}
+	}
+
+	return entry, nil
+}
+
+// download GitLab archive and repack it into packaged crate
+func (c *CargoRegistry) getCrateArchive(ctx context.Context, repo *client.GitLabRepo, tag client.Tag, name, version string) ([]byte, error) {
+	archive, err := c.conn.GetArchive(ctx, client.KindCargo, repo.UUID, tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.GetCrateArchive(ctx, archive, name, version, repo.UUID, tag.Reference)
+}
+
+// find crate by name in Cargo.toml in each master branch of package repository,
+// crate names are case-insensitive
+func (c *CargoRegistry) findCrateByName(ctx context.Context, name string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindCargo)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range projectList {
+
+		p.MetadataLock.RLock()
+		crateName, _ := p.Metadata.GetString("name")
+		p.MetadataLock.RUnlock()
+
+		if strings.ToLower(crateName) == strings.ToLower(name) {
+			return p, nil
+		}
+	}
+
+	return nil, ErrCargoCrateNotFound
+}
+
+// crate name and version are taken from Cargo.toml, version should
+// be valid semver and match the tag ("v" prefix is allowed).
+func getCrateVersion(tag client.Tag) (string, string, error) {
+	tag.MetadataLock.RLock()
+	name, _ := tag.Metadata.GetString("name")
+	version, _ := tag.Metadata.GetString("version")
+	tag.MetadataLock.RUnlock()
+
+	if _, err := semver.Parse(version); err != nil {
+		return "", "", err
+	}
+
+	if strings.TrimPrefix(tag.Name, "v") != version {
+		return "", "", fmt.Errorf("Tag %s doesn't match crate version %s", tag.Name, version)
+	}
+
+	return name, version, nil
+}
+
+// check feature uses namespaced ("dep:name") or weak ("name?/feature") dependency syntax
+func isCargoFeature2(value interface{}) bool {
+	valueList, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, item := range valueList {
+		if s, ok := item.(string); ok && (strings.HasPrefix(s, "dep:") || strings.Contains(s, "?/")) {
+			return true
+		}
+	}
+
+	return false
+}
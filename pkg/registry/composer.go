@@ -3,11 +3,14 @@ package registry
 import (
 	"comrade-pavlik2/pkg/client"
 	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/blang/semver"
 	"log"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -19,9 +22,26 @@ type (
 
 	ComposerPackage struct {
 		Packages     map[string]map[string]composerVersion `json:"packages"`
+		MetadataURL  string                                `json:"metadata-url,omitempty"` // set when uplink is enabled
+		Search       string                                `json:"search,omitempty"`
 		PackagesLock *sync.RWMutex                         `json:"-"`
 	}
 
+	// ComposerSearchResult - search response, /search.json
+	ComposerSearchResult struct {
+		Results []composerSearchItem `json:"results"`
+		Total   int                  `json:"total"`
+	}
+
+	composerSearchItem struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		URL         string `json:"url"`
+		Repository  string `json:"repository"`
+		Downloads   int    `json:"downloads"`
+		Favers      int    `json:"favers"`
+	}
+
 	composerVersion struct {
 		Name       string                  `json:"name"`
 		Type       string                  `json:"type,omitempty"`
@@ -50,8 +70,8 @@ func NewComposerRegistry(conn *client.GitLabConnection) *ComposerRegistry {
 }
 
 // GetPackageInfo - get single package info, debug method.
-func (c *ComposerRegistry) GetPackageInfo(uuid string, endpoint string) (*ComposerPackage, error) {
-	repo, err := c.conn.GetRepo(client.KindComposer, uuid)
+func (c *ComposerRegistry) GetPackageInfo(ctx context.Context, uuid string, endpoint string) (*ComposerPackage, error) {
+	repo, err := c.conn.GetRepo(ctx, client.KindComposer, uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -69,8 +89,8 @@ func (c *ComposerRegistry) GetPackageInfo(uuid string, endpoint string) (*Compos
 }
 
 // GetPackageInfoList - get whole list of packages visible for current token
-func (c *ComposerRegistry) GetPackageInfoList(endpoint string) (*ComposerPackage, error) {
-	repoList, err := c.conn.GetRepoList(client.KindComposer)
+func (c *ComposerRegistry) GetPackageInfoList(ctx context.Context, endpoint string) (*ComposerPackage, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindComposer)
 	if err != nil {
 		return nil, err
 	}
@@ -114,15 +134,87 @@ func (c *ComposerRegistry) GetPackageInfoList(endpoint string) (*ComposerPackage
 	return nil, errors.New("Error while fetchig packages")
 }
 
+// Search - find packages visible for current token by name, keywords and description
+// of composer.json in master branch, optionally filtered by package type.
+func (c *ComposerRegistry) Search(ctx context.Context, query, packageType string) (*ComposerSearchResult, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindComposer)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchComposerRepoList(repoList, query, packageType), nil
+}
+
+// rank packages of given repositories against search query, repositories
+// are expected to be filtered for token already.
+func searchComposerRepoList(repoList []*client.GitLabRepo, query, packageType string) *ComposerSearchResult {
+	termList := getSearchTermList(query)
+	scoreList := make(map[string]float64, 0)
+	result := &ComposerSearchResult{
+		Results: make([]composerSearchItem, 0),
+	}
+
+	for _, repo := range repoList {
+		repo.MetadataLock.RLock()
+		name, _ := repo.Metadata.GetString("name")
+		description, _ := repo.Metadata.GetString("description")
+		repoType, _ := repo.Metadata.GetString("type")
+		keywordList := getStringList(repo.Metadata, "keywords")
+		repo.MetadataLock.RUnlock()
+
+		if repoType == "" {
+			repoType = "library"
+		}
+		if packageType != "" && packageType != repoType {
+			continue
+		}
+
+		score := getSearchScore(termList, name, description, keywordList)
+		if name == "" || score == 0 {
+			continue
+		}
+
+		scoreList[name] = score
+		result.Results = append(result.Results, composerSearchItem{
+			Name:        name,
+			Description: description,
+			URL:         repo.Project.WWWURL,
+			Repository:  repo.Project.WWWURL,
+		})
+	}
+
+	sort.Slice(result.Results, func(i, j int) bool {
+		nameI, nameJ := result.Results[i].Name, result.Results[j].Name
+		if scoreList[nameI] != scoreList[nameJ] {
+			return scoreList[nameI] > scoreList[nameJ]
+		}
+
+		return nameI < nameJ
+	})
+
+	result.Total = len(result.Results)
+	return result
+}
+
 // GetPackageArchive - get package as archive
-func (c *ComposerRegistry) GetPackageArchive(uuid string, ref string) ([]byte, error) {
-	// TODO: it's better to reorder here, first of all, check cache
-	archive, err := c.conn.GetArchive(client.KindComposer, uuid, ref)
+func (c *ComposerRegistry) GetPackageArchive(ctx context.Context, uuid string, ref string) ([]byte, error) {
+	// cached and frozen archives are not checked against GitLab
+	if err := c.conn.CheckAccess(ctx, client.KindComposer, uuid); err != nil {
+		return nil, err
+	}
+	c.conn.SetDownload(client.KindComposer, uuid, ref)
+
+	// frozen archive is served even when tag is moved or deleted
+	if pkg, err := helpers.GetComposerArchiveFromCache(uuid, ref); err == nil {
+		return pkg, nil
+	}
+
+	archive, err := c.conn.GetArchive(ctx, client.KindComposer, uuid, ref)
 	if err != nil {
 		return nil, err
 	}
 
-	pkg, err := helpers.GetComposerArchive(archive, uuid, ref)
+	pkg, err := helpers.GetComposerArchive(ctx, archive, uuid, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +226,7 @@ func (c *ComposerRegistry) GetPackageArchive(uuid string, ref string) ([]byte, e
 func (p *ComposerPackage) fillVersions(c *client.GitLabConnection, src *client.GitLabRepo, endpoint string) error {
 	versionList := make([]composerVersion, 0)
 	versionList = append(versionList, p.versionListFromTags(src, endpoint)...)
+	versionList = append(versionList, p.versionListFromSnapshots(src, versionList, endpoint)...)
 
 	for _, v := range versionList {
 		p.PackagesLock.Lock()
@@ -206,6 +299,12 @@ func (p *ComposerPackage) versionListFromTags(src *client.GitLabRepo, endpoint s
 			}
 
 			p.fillMetadata(v, src.UUID, tag, endpoint)
+
+			// metadata frozen earlier is served instead of generated one
+			if err := freezeComposerVersion(v, src.UUID, tag.Reference, endpoint); err != nil {
+				log.Printf("==> Notice: %s: %s", src.Project.Name, err)
+			}
+
 			versionChan <- v
 		}(tag)
 	}
@@ -220,3 +319,74 @@ func (p *ComposerPackage) versionListFromTags(src *client.GitLabRepo, endpoint s
 
 	return list
 }
+
+// fill versions frozen earlier, which tags are no longer listed by GitLab
+func (p *ComposerPackage) versionListFromSnapshots(src *client.GitLabRepo, tagVersionList []composerVersion, endpoint string) []composerVersion {
+	list := make([]composerVersion, 0)
+
+	metadataList, err := helpers.GetFrozenVersionMetadataList(client.KindComposer, src.UUID)
+	if err != nil {
+		log.Printf("==> Notice: %s: %s", src.Project.Name, err)
+		return list
+	}
+
+	for ref, data := range metadataList {
+		if hasTagReference(src, ref) {
+			continue
+		}
+
+		v := composerVersion{}
+		if err := json.Unmarshal(data, &v); err != nil || v.Name == "" {
+			continue
+		}
+
+		listed := false
+		for _, tagVersion := range tagVersionList {
+			if tagVersion.Name == v.Name && tagVersion.Version == v.Version {
+				listed = true
+				break
+			}
+		}
+
+		if !listed {
+			v.Dist.Url = fmt.Sprintf(endpoint, src.UUID, ref)
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// freeze version metadata the first time it is generated, download url
+// is always generated for current request
+func freezeComposerVersion(v *composerVersion, uuid, ref, endpoint string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	frozen, err := helpers.FreezeVersionMetadata(client.KindComposer, uuid, ref, data)
+	if err != nil {
+		return err
+	}
+
+	frozenVersion := composerVersion{}
+	if err := json.Unmarshal(frozen, &frozenVersion); err != nil {
+		return err
+	}
+
+	*v = frozenVersion
+	v.Dist.Url = fmt.Sprintf(endpoint, uuid, ref)
+	return nil
+}
+
+// check reference is listed by any tag of repository
+func hasTagReference(src *client.GitLabRepo, ref string) bool {
+	for _, tag := range src.TagList {
+		if tag.Reference == ref {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,379 @@
+package registry
+
+import (
+	"bytes"
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	GemRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// single gem version, line of compact index info file
+	gemVersion struct {
+		version  string
+		checksum string
+		spec     *helpers.GemSpec
+		tag      client.Tag
+	}
+)
+
+var (
+	// ErrGemNotFound - gem or version is not served by registry
+	ErrGemNotFound = errors.New("Gem not found")
+
+	// rubygems version, e.g. 1.2.0, 1.2.0.rc1 or 1.2.0-beta
+	gemVersionRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9a-zA-Z]+)*(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+)
+
+// NewGemRegistry - construct rubygems compact index emulator for GitLab
+func NewGemRegistry(conn *client.GitLabConnection) *GemRegistry {
+	return &GemRegistry{
+		conn: conn,
+	}
+}
+
+// GetNames - compact index list of all gems visible for current token
+func (c *GemRegistry) GetNames(ctx context.Context) ([]byte, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindGem)
+	if err != nil {
+		return nil, err
+	}
+
+	nameList := make([]string, 0)
+	for _, repo := range repoList {
+		repo.MetadataLock.RLock()
+		name, _ := repo.Metadata.GetString("name")
+		repo.MetadataLock.RUnlock()
+
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("---\n")
+	for _, name := range nameList {
+		buf.WriteString(name + "\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GetVersions - compact index list of versions of all gems, along with
+// md5 of each info file, so every archive is repacked in order to calculate checksums.
+func (c *GemRegistry) GetVersions(ctx context.Context) ([]byte, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindGem)
+	if err != nil {
+		return nil, err
+	}
+
+	lineList := make([]string, 0)
+	for _, repo := range repoList {
+		versionList, err := c.getGemVersionList(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(versionList) == 0 {
+			continue
+		}
+
+		numberList := make([]string, 0)
+		for _, v := range versionList {
+			numberList = append(numberList, v.version)
+		}
+
+		info := getGemInfo(versionList)
+		lineList = append(lineList, fmt.Sprintf("%s %s %x", versionList[0].spec.Name, strings.Join(numberList, ","), md5.Sum(info)))
+	}
+	sort.Strings(lineList)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "created_at: %s\n---\n", time.Now().UTC().Format(time.RFC3339))
+	for _, line := range lineList {
+		buf.WriteString(line + "\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GetInfo - compact index info file of a gem: dependencies and checksum of each version
+func (c *GemRegistry) GetInfo(ctx context.Context, name string) ([]byte, error) {
+	repo, err := c.findGemByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	versionList, err := c.getGemVersionList(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versionList) == 0 {
+		return nil, ErrGemNotFound
+	}
+
+	return getGemInfo(versionList), nil
+}
+
+// GetGemArchive - get gem by file name, e.g. acme-auth-1.2.0.gem
+func (c *GemRegistry) GetGemArchive(ctx context.Context, file string) ([]byte, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindGem)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repoList {
+		repo.MetadataLock.RLock()
+		name, _ := repo.Metadata.GetString("name")
+		repo.MetadataLock.RUnlock()
+
+		if !strings.HasPrefix(file, name+"-") {
+			continue
+		}
+
+		for _, tag := range repo.TagList {
+			spec, err := getGemSpec(name, tag)
+			if err != nil || helpers.GetGemName(spec.Name, spec.Version) != file {
+				continue
+			}
+
+			c.conn.SetDownload(client.KindGem, repo.UUID, tag.Reference)
+			return c.getGemArchive(ctx, repo, tag, spec)
+		}
+	}
+
+	return nil, ErrGemNotFound
+}
+
+//
+// Private API
+//
+
+// collect all valid versions of gem, ordered by tag date, as compact index expects
+func (c *GemRegistry) getGemVersionList(ctx context.Context, repo *client.GitLabRepo) ([]*gemVersion, error) {
+	repo.MetadataLock.RLock()
+	name, _ := repo.Metadata.GetString("name")
+	repo.MetadataLock.RUnlock()
+
+	versionChan := make(chan *gemVersion)
+	guardChan := make(chan bool, runtime.NumCPU())
+
+	log.Println("==> Processing tags:", repo.Project.Name)
+	for _, tag := range repo.TagList {
+		go func(tag client.Tag) {
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				versionChan <- nil
+				return
+			}
+			defer func() {
+				<-guardChan
+			}()
+
+			spec, err := getGemSpec(name, tag)
+			if err != nil {
+				versionChan <- nil
+				return
+			}
+
+			gem, err := c.getGemArchive(ctx, repo, tag, spec)
+			if err != nil {
+				versionChan <- nil
+				return
+			}
+
+			versionChan <- &gemVersion{
+				version:  spec.Version,
+				checksum: fmt.Sprintf("%x", sha256.Sum256(gem)),
+				spec:     spec,
+				tag:      tag,
+			}
+		}(tag)
+	}
+
+	versionList := make([]*gemVersion, 0)
+	for i := 0; i < len(repo.TagList); i++ {
+		if v := <-versionChan; v != nil {
+			versionList = append(versionList, v)
+		}
+	}
+
+	// request is cancelled, version list is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(versionList, func(i, j int) bool {
+		return versionList[i].tag.Time.Before(versionList[j].tag.Time)
+	})
+
+	return versionList, nil
+}
+
+// download GitLab archive and repack it into gem
+func (c *GemRegistry) getGemArchive(ctx context.Context, repo *client.GitLabRepo, tag client.Tag, spec *helpers.GemSpec) ([]byte, error) {
+	archive, err := c.conn.GetArchive(ctx, client.KindGem, repo.UUID, tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.GetGemArchive(ctx, archive, spec, repo.UUID, tag.Reference)
+}
+
+// find gem by name in gemspec in each master branch of package repository
+func (c *GemRegistry) findGemByName(ctx context.Context, name string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindGem)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range projectList {
+
+		p.MetadataLock.RLock()
+		gemName, _ := p.Metadata.GetString("name")
+		p.MetadataLock.RUnlock()
+
+		if gemName == name {
+			return p, nil
+		}
+	}
+
+	return nil, ErrGemNotFound
+}
+
+// format compact index info file, runtime dependencies only
+func getGemInfo(versionList []*gemVersion) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("---\n")
+
+	for _, v := range versionList {
+		depList := make([]string, 0)
+		for _, dep := range v.spec.Dependencies {
+			if dep.Type != "runtime" {
+				continue
+			}
+
+			requirementList := make([]string, 0)
+			for _, requirement := range dep.Requirements {
+				requirementList = append(requirementList, helpers.NormalizeGemRequirement(requirement))
+			}
+			if len(requirementList) == 0 {
+				requirementList = append(requirementList, ">= 0")
+			}
+
+			depList = append(depList, fmt.Sprintf("%s:%s", dep.Name, strings.Join(requirementList, "&")))
+		}
+
+		requirementList := []string{"checksum:" + v.checksum}
+		if v.spec.RequiredRubyVersion != "" {
+			requirementList = append(requirementList, "ruby:"+getGemInfoRequirement(v.spec.RequiredRubyVersion))
+		}
+		if v.spec.RequiredRubygemsVersion != "" {
+			requirementList = append(requirementList, "rubygems:"+getGemInfoRequirement(v.spec.RequiredRubygemsVersion))
+		}
+
+		fmt.Fprintf(buf, "%s %s|%s\n", v.version, strings.Join(depList, ","), strings.Join(requirementList, ","))
+	}
+
+	return buf.Bytes()
+}
+
+// convert comma separated requirement into compact index form, e.g. ">= 2.7&< 4"
+func getGemInfoRequirement(requirement string) string {
+	requirementList := make([]string, 0)
+	for _, item := range strings.Split(requirement, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			requirementList = append(requirementList, helpers.NormalizeGemRequirement(item))
+		}
+	}
+
+	return strings.Join(requirementList, "&")
+}
+
+// version is taken from tag name, static version in gemspec, if any, should match tag
+func getGemSpec(name string, tag client.Tag) (*helpers.GemSpec, error) {
+	version := strings.TrimPrefix(tag.Name, "v")
+	if !gemVersionRegexp.MatchString(version) {
+		return nil, fmt.Errorf("Tag %s is not a valid version", tag.Name)
+	}
+
+	tag.MetadataLock.RLock()
+	defer tag.MetadataLock.RUnlock()
+
+	metadata := tag.Metadata
+	gemName, _ := metadata.GetString("name")
+	metadataVersion, _ := metadata.GetString("version")
+
+	if gemName != name {
+		return nil, fmt.Errorf("Tag %s belongs to gem %s", tag.Name, gemName)
+	}
+
+	if metadataVersion != "" && metadataVersion != version {
+		return nil, fmt.Errorf("Tag %s doesn't match version %s", tag.Name, metadataVersion)
+	}
+
+	spec := &helpers.GemSpec{
+		Name:         gemName,
+		Version:      version,
+		Authors:      getStringList(metadata, "authors"),
+		Licenses:     getStringList(metadata, "licenses"),
+		RequirePaths: getStringList(metadata, "require_paths"),
+		Dependencies: make([]helpers.GemDependency, 0),
+		Date:         tag.Time,
+	}
+	spec.Summary, _ = metadata.GetString("summary")
+	spec.Description, _ = metadata.GetString("description")
+	spec.Homepage, _ = metadata.GetString("homepage")
+	spec.RequiredRubyVersion, _ = metadata.GetString("required_ruby_version")
+	spec.RequiredRubygemsVersion, _ = metadata.GetString("required_rubygems_version")
+
+	if dependencyList, err := metadata.GetListInterface("dependencies", nil); err == nil {
+		for _, item := range *dependencyList {
+			dep, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			depName, _ := dep["name"].(string)
+			depType, _ := dep["type"].(string)
+			depMap := client.JsonMap(dep)
+
+			spec.Dependencies = append(spec.Dependencies, helpers.GemDependency{
+				Name:         depName,
+				Requirements: getStringList(&depMap, "requirements"),
+				Type:         depType,
+			})
+		}
+	}
+
+	return spec, nil
+}
+
+// get list of strings from metadata, non-string items are skipped
+func getStringList(metadata *client.JsonMap, key string) []string {
+	result := make([]string, 0)
+	if valueList, err := metadata.GetListInterface(key, nil); err == nil {
+		for _, value := range *valueList {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,247 @@
+package registry
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	GoRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// GoVersionInfo - response for .info and @latest requests
+	GoVersionInfo struct {
+		Version string    `json:"Version"`
+		Time    time.Time `json:"Time"`
+	}
+
+	// single valid module version
+	goVersion struct {
+		info    GoVersionInfo
+		semver  semver.Version
+		tag     client.Tag
+		modFile string
+	}
+)
+
+var (
+	// ErrGoModuleNotFound - module is not served by registry,
+	// go command will try next proxy from GOPROXY list
+	ErrGoModuleNotFound = errors.New("Module not found")
+
+	// ErrGoVersionNotFound - module doesn't have such version
+	ErrGoVersionNotFound = errors.New("Version not found")
+)
+
+// NewGoRegistry - construct go module proxy emulator for GitLab
+func NewGoRegistry(conn *client.GitLabConnection) *GoRegistry {
+	return &GoRegistry{
+		conn: conn,
+	}
+}
+
+// GetVersionList - list of all valid module versions
+func (c *GoRegistry) GetVersionList(ctx context.Context, modulePath string) ([]string, error) {
+	versionList, _, err := c.findModuleVersionList(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0)
+	for _, v := range versionList {
+		list = append(list, v.info.Version)
+	}
+
+	return list, nil
+}
+
+// GetVersionInfo - get version and commit time of a given module version
+func (c *GoRegistry) GetVersionInfo(ctx context.Context, modulePath, version string) (*GoVersionInfo, error) {
+	v, _, err := c.findModuleVersion(ctx, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v.info, nil
+}
+
+// GetLatest - get latest release version, or latest pre-release
+// when module doesn't have any release.
+func (c *GoRegistry) GetLatest(ctx context.Context, modulePath string) (*GoVersionInfo, error) {
+	versionList, _, err := c.findModuleVersionList(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *goVersion
+	for i, v := range versionList {
+		isRelease := len(v.semver.Pre) == 0
+		switch {
+		case latest == nil:
+			latest = &versionList[i]
+
+		case isRelease && len(latest.semver.Pre) > 0:
+			latest = &versionList[i]
+
+		case isRelease == (len(latest.semver.Pre) == 0) && v.semver.GT(latest.semver):
+			latest = &versionList[i]
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrGoVersionNotFound
+	}
+
+	return &latest.info, nil
+}
+
+// GetModFile - get go.mod file of a given module version
+func (c *GoRegistry) GetModFile(ctx context.Context, modulePath, version string) ([]byte, error) {
+	v, _, err := c.findModuleVersion(ctx, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(v.modFile), nil
+}
+
+// GetModuleArchive - get module zip archive of a given module version
+func (c *GoRegistry) GetModuleArchive(ctx context.Context, modulePath, version string) ([]byte, error) {
+	v, repo, err := c.findModuleVersion(ctx, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	c.conn.SetDownload(client.KindGo, repo.UUID, v.tag.Reference)
+
+	archive, err := c.conn.GetArchive(ctx, client.KindGo, repo.UUID, v.tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.GetGoModuleArchive(ctx, archive, modulePath, version, repo.UUID, v.tag.Reference)
+}
+
+//
+// Private API
+//
+
+// find single version of module
+func (c *GoRegistry) findModuleVersion(ctx context.Context, modulePath, version string) (*goVersion, *client.GitLabRepo, error) {
+	versionList, repo, err := c.findModuleVersionList(ctx, modulePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, v := range versionList {
+		if v.info.Version == version {
+			return &versionList[i], repo, nil
+		}
+	}
+
+	return nil, nil, ErrGoVersionNotFound
+}
+
+// find project by module path in go.mod of master branch, and collect all
+// tags which are valid module versions.
+func (c *GoRegistry) findModuleVersionList(ctx context.Context, modulePath string) ([]goVersion, *client.GitLabRepo, error) {
+	repo, err := c.findModuleByPath(ctx, modulePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versionList := make([]goVersion, 0)
+	for _, tag := range repo.TagList {
+		v, err := newGoVersion(modulePath, tag)
+		if err != nil {
+			continue
+		}
+
+		versionList = append(versionList, *v)
+	}
+
+	return versionList, repo, nil
+}
+
+// find project by name in go.mod in each master branch of package repository
+func (c *GoRegistry) findModuleByPath(ctx context.Context, modulePath string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindGo)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range projectList {
+
+		p.MetadataLock.RLock()
+		module, _ := p.Metadata.GetString("module")
+		p.MetadataLock.RUnlock()
+
+		if module == modulePath {
+			return p, nil
+		}
+	}
+
+	return nil, ErrGoModuleNotFound
+}
+
+// convert tag into module version, tag should be canonical semver
+// version with "v" prefix, matching major version suffix of module path.
+func newGoVersion(modulePath string, tag client.Tag) (*goVersion, error) {
+	if !strings.HasPrefix(tag.Name, "v") {
+		return nil, fmt.Errorf("Tag %s is not a module version", tag.Name)
+	}
+
+	releaseInfo, err := semver.Parse(strings.TrimPrefix(tag.Name, "v"))
+	if err != nil {
+		return nil, err
+	}
+
+	// build metadata is not allowed, "v1.0" is not canonical
+	if len(releaseInfo.Build) > 0 || fmt.Sprintf("v%s", releaseInfo.String()) != tag.Name {
+		return nil, fmt.Errorf("Tag %s is not a canonical module version", tag.Name)
+	}
+
+	if !isGoMajorVersionCompatible(modulePath, releaseInfo) {
+		return nil, fmt.Errorf("Tag %s doesn't match major version of %s", tag.Name, modulePath)
+	}
+
+	tag.MetadataLock.RLock()
+	module, _ := tag.Metadata.GetString("module")
+	modFile, _ := tag.Metadata.GetString("mod")
+	tag.MetadataLock.RUnlock()
+
+	// module could be renamed at some point
+	if module != modulePath {
+		return nil, fmt.Errorf("Tag %s belongs to module %s", tag.Name, module)
+	}
+
+	return &goVersion{
+		info: GoVersionInfo{
+			Version: tag.Name,
+			Time:    tag.Time.UTC(),
+		},
+		semver:  releaseInfo,
+		tag:     tag,
+		modFile: modFile,
+	}, nil
+}
+
+// major version should match module path: "/v2" suffix is v2, no suffix is v0 or v1
+func isGoMajorVersionCompatible(modulePath string, v semver.Version) bool {
+	suffix := path.Base(modulePath)
+	if len(suffix) >= 2 && suffix[0] == 'v' {
+		if major, err := strconv.ParseUint(suffix[1:], 10, 64); err == nil && major >= 2 && suffix == fmt.Sprintf("v%d", major) {
+			return v.Major == major
+		}
+	}
+
+	return v.Major <= 1
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/blang/semver"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	HelmRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// HelmIndex - chart repository index.yaml
+	HelmIndex struct {
+		APIVersion string                              `yaml:"apiVersion"`
+		Entries    map[string][]map[string]interface{} `yaml:"entries"`
+		Generated  string                              `yaml:"generated"`
+	}
+
+	// single chart version
+	helmChartVersion struct {
+		name  string
+		entry map[string]interface{}
+	}
+)
+
+// NewHelmRegistry - construct chart repository emulator for GitLab
+func NewHelmRegistry(conn *client.GitLabConnection) *HelmRegistry {
+	return &HelmRegistry{
+		conn: conn,
+	}
+}
+
+// GetIndex - get index of all charts visible for current token,
+// every archive is repacked in order to calculate digest.
+func (c *HelmRegistry) GetIndex(ctx context.Context, endpoint string) (*HelmIndex, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindHelm)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &HelmIndex{
+		APIVersion: "v1",
+		Entries:    make(map[string][]map[string]interface{}, 0),
+		Generated:  time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	versionChan := make(chan *helmChartVersion)
+	guardChan := make(chan bool, runtime.NumCPU())
+
+	total := 0
+	for _, repo := range repoList {
+		log.Println("==> Processing tags:", repo.Project.Name)
+		for _, tag := range repo.TagList {
+			total++
+
+			go func(repo *client.GitLabRepo, tag client.Tag) {
+				select {
+				case guardChan <- true:
+				case <-ctx.Done():
+					versionChan <- nil
+					return
+				}
+				defer func() {
+					<-guardChan
+				}()
+
+				v, err := c.getChartVersion(ctx, repo, tag, endpoint)
+				if err != nil {
+					versionChan <- nil
+					return
+				}
+
+				versionChan <- v
+			}(repo, tag)
+		}
+	}
+
+	for i := 0; i < total; i++ {
+		if v := <-versionChan; v != nil {
+			index.Entries[v.name] = append(index.Entries[v.name], v.entry)
+		}
+	}
+
+	// request is cancelled, index is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// newest version first, as helm does
+	for name := range index.Entries {
+		entryList := index.Entries[name]
+		sort.Slice(entryList, func(i, j int) bool {
+			vi, _ := semver.Parse(entryList[i]["version"].(string))
+			vj, _ := semver.Parse(entryList[j]["version"].(string))
+			return vi.GT(vj)
+		})
+	}
+
+	return index, nil
+}
+
+// GetChartArchive - get packaged chart for a given tag
+func (c *HelmRegistry) GetChartArchive(ctx context.Context, uuid, ref string) ([]byte, error) {
+	repo, err := c.conn.GetRepo(ctx, client.KindHelm, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range repo.TagList {
+		if tag.Reference != ref {
+			continue
+		}
+
+		name, version, err := getChartVersion(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		c.conn.SetDownload(client.KindHelm, repo.UUID, tag.Reference)
+		return c.getChartArchive(ctx, repo, tag, name, version)
+	}
+
+	return nil, fmt.Errorf("Tag with reference %s not found", ref)
+}
+
+//
+// Private API
+//
+
+// build index entry: all fields of Chart.yaml, download url and digest
+func (c *HelmRegistry) getChartVersion(ctx context.Context, repo *client.GitLabRepo, tag client.Tag, endpoint string) (*helmChartVersion, error) {
+	name, version, err := getChartVersion(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	chart, err := c.getChartArchive(ctx, repo, tag, name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := make(map[string]interface{}, 0)
+	tag.MetadataLock.RLock()
+	for key, value := range *tag.Metadata {
+		entry[key] = value
+	}
+	tag.MetadataLock.RUnlock()
+
+	entry["urls"] = []string{fmt.Sprintf(endpoint, repo.UUID, tag.Reference, helpers.GetHelmChartName(name, version))}
+	entry["digest"] = fmt.Sprintf("%x", sha256.Sum256(chart))
+	entry["created"] = tag.Time.UTC().Format(time.RFC3339)
+
+	return &helmChartVersion{
+		name:  name,
+		entry: entry,
+	}, nil
+}
+
+// download GitLab archive and repack it into chart archive
+func (c *HelmRegistry) getChartArchive(ctx context.Context, repo *client.GitLabRepo, tag client.Tag, name, version string) ([]byte, error) {
+	archive, err := c.conn.GetArchive(ctx, client.KindHelm, repo.UUID, tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.GetHelmChartArchive(ctx, archive, name, version, repo.UUID, tag.Reference)
+}
+
+// chart name and version are taken from Chart.yaml, version should
+// be valid semver and match the tag ("v" prefix is allowed).
+func getChartVersion(tag client.Tag) (string, string, error) {
+	tag.MetadataLock.RLock()
+	name, _ := tag.Metadata.GetString("name")
+	version, _ := tag.Metadata.GetString("version")
+	tag.MetadataLock.RUnlock()
+
+	if _, err := semver.Parse(version); err != nil {
+		return "", "", err
+	}
+
+	if strings.TrimPrefix(tag.Name, "v") != version {
+		return "", "", fmt.Errorf("Tag %s doesn't match chart version %s", tag.Name, version)
+	}
+
+	return name, version, nil
+}
@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/blang/semver"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	MavenRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// MavenMetadata - artifact level maven-metadata.xml
+	MavenMetadata struct {
+		XMLName    xml.Name        `xml:"metadata"`
+		GroupID    string          `xml:"groupId"`
+		ArtifactID string          `xml:"artifactId"`
+		Versioning mavenVersioning `xml:"versioning"`
+	}
+
+	mavenVersioning struct {
+		Latest      string   `xml:"latest"`
+		Release     string   `xml:"release"`
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated"`
+	}
+
+	// single valid artifact version
+	mavenVersion struct {
+		version string
+		tag     client.Tag
+	}
+)
+
+var (
+	// ErrMavenArtifactNotFound - artifact or version is not served by registry
+	ErrMavenArtifactNotFound = errors.New("Artifact not found")
+)
+
+// NewMavenRegistry - construct maven repository emulator for GitLab
+func NewMavenRegistry(conn *client.GitLabConnection) *MavenRegistry {
+	return &MavenRegistry{
+		conn: conn,
+	}
+}
+
+// GetMetadata - get artifact maven-metadata.xml with list of all versions
+func (c *MavenRegistry) GetMetadata(ctx context.Context, groupID, artifactID string) ([]byte, error) {
+	versionList, _, err := c.findArtifactVersionList(ctx, groupID, artifactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versionList) == 0 {
+		return nil, ErrMavenArtifactNotFound
+	}
+
+	metadata := &MavenMetadata{
+		GroupID:    groupID,
+		ArtifactID: artifactID,
+		Versioning: mavenVersioning{
+			Versions: make([]string, 0),
+		},
+	}
+
+	lastUpdated := time.Time{}
+	for _, v := range versionList {
+		metadata.Versioning.Versions = append(metadata.Versioning.Versions, v.version)
+		if v.tag.Time.After(lastUpdated) {
+			lastUpdated = v.tag.Time
+		}
+	}
+
+	latest := versionList[len(versionList)-1].version
+	metadata.Versioning.Latest = latest
+	metadata.Versioning.Release = latest
+	metadata.Versioning.LastUpdated = lastUpdated.UTC().Format("20060102150405")
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// GetPom - get pom.xml of a given artifact version
+func (c *MavenRegistry) GetPom(ctx context.Context, groupID, artifactID, version string) ([]byte, error) {
+	v, _, err := c.findArtifactVersion(ctx, groupID, artifactID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	v.tag.MetadataLock.RLock()
+	pom, _ := v.tag.Metadata.GetString("pom")
+	v.tag.MetadataLock.RUnlock()
+
+	return []byte(pom), nil
+}
+
+// GetSourcesJar - get sources jar of a given artifact version
+func (c *MavenRegistry) GetSourcesJar(ctx context.Context, groupID, artifactID, version string) ([]byte, error) {
+	v, repo, err := c.findArtifactVersion(ctx, groupID, artifactID, version)
+	if err != nil {
+		return nil, err
+	}
+	c.conn.SetDownload(client.KindMaven, repo.UUID, v.tag.Reference)
+
+	archive, err := c.conn.GetArchive(ctx, client.KindMaven, repo.UUID, v.tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.GetMavenSourcesJar(ctx, archive, groupID, artifactID, version, repo.UUID, v.tag.Reference)
+}
+
+//
+// Private API
+//
+
+// find single version of artifact
+func (c *MavenRegistry) findArtifactVersion(ctx context.Context, groupID, artifactID, version string) (*mavenVersion, *client.GitLabRepo, error) {
+	versionList, repo, err := c.findArtifactVersionList(ctx, groupID, artifactID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, v := range versionList {
+		if v.version == version {
+			return &versionList[i], repo, nil
+		}
+	}
+
+	return nil, nil, ErrMavenArtifactNotFound
+}
+
+// find project by coordinates in pom.xml of master branch, and collect all tags
+// with the same coordinates, sorted from oldest to newest version.
+func (c *MavenRegistry) findArtifactVersionList(ctx context.Context, groupID, artifactID string) ([]mavenVersion, *client.GitLabRepo, error) {
+	repo, err := c.findArtifactByCoordinates(ctx, groupID, artifactID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	versionList := make([]mavenVersion, 0)
+	for _, tag := range repo.TagList {
+		tag.MetadataLock.RLock()
+		tagGroupID, _ := tag.Metadata.GetString("groupId")
+		tagArtifactID, _ := tag.Metadata.GetString("artifactId")
+		version, _ := tag.Metadata.GetString("version")
+		tag.MetadataLock.RUnlock()
+
+		// unresolved properties and snapshots are not releases
+		if tagGroupID != groupID || tagArtifactID != artifactID || version == "" ||
+			strings.Contains(version, "${") || strings.HasSuffix(version, "-SNAPSHOT") {
+			continue
+		}
+
+		if strings.TrimPrefix(tag.Name, "v") != version {
+			continue
+		}
+
+		versionList = append(versionList, mavenVersion{
+			version: version,
+			tag:     tag,
+		})
+	}
+
+	sort.Slice(versionList, func(i, j int) bool {
+		vi, errI := semver.ParseTolerant(versionList[i].version)
+		vj, errJ := semver.ParseTolerant(versionList[j].version)
+		if errI != nil || errJ != nil {
+			return versionList[i].tag.Time.Before(versionList[j].tag.Time)
+		}
+
+		return vi.LT(vj)
+	})
+
+	return versionList, repo, nil
+}
+
+// find project by groupId and artifactId in pom.xml in each master branch of package repository
+func (c *MavenRegistry) findArtifactByCoordinates(ctx context.Context, groupID, artifactID string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindMaven)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range projectList {
+
+		p.MetadataLock.RLock()
+		projectGroupID, _ := p.Metadata.GetString("groupId")
+		projectArtifactID, _ := p.Metadata.GetString("artifactId")
+		p.MetadataLock.RUnlock()
+
+		if projectGroupID == groupID && projectArtifactID == artifactID {
+			return p, nil
+		}
+	}
+
+	return nil, ErrMavenArtifactNotFound
+}
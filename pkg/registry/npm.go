@@ -3,11 +3,16 @@ package registry
 import (
 	"comrade-pavlik2/pkg/client"
 	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/blang/semver"
 	"log"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
 type (
@@ -38,6 +43,39 @@ type (
 		Sha     string `json:"shasum"`
 		Tarball string `json:"tarball"`
 	}
+
+	// NpmSearchResult - search response, /-/v1/search
+	NpmSearchResult struct {
+		Objects []npmSearchObject `json:"objects"`
+		Total   int               `json:"total"`
+		Time    string            `json:"time"`
+	}
+
+	npmSearchObject struct {
+		Package     npmSearchPackage `json:"package"`
+		Score       npmSearchScore   `json:"score"`
+		SearchScore float64          `json:"searchScore"`
+	}
+
+	npmSearchPackage struct {
+		Name        string            `json:"name"`
+		Scope       string            `json:"scope"`
+		Version     string            `json:"version"`
+		Description string            `json:"description,omitempty"`
+		Keywords    []string          `json:"keywords,omitempty"`
+		Date        string            `json:"date,omitempty"`
+		Links       map[string]string `json:"links"`
+	}
+
+	npmSearchScore struct {
+		Final  float64            `json:"final"`
+		Detail map[string]float64 `json:"detail"`
+	}
+)
+
+var (
+	// ErrNpmPackageNotFound - package is not served by registry
+	ErrNpmPackageNotFound = errors.New("Package not found")
 )
 
 //
@@ -50,18 +88,18 @@ func NewNpmRegistry(conn *client.GitLabConnection) *NpmRegistry {
 // find project by name in package.json in each master branch of package repository
 // download project archive, calculate sha1 hash and put it to LRU-cache
 // generate final NpmPackage structure
-func (c *NpmRegistry) GetPackageInfo(name string, endpoint string) (*NpmPackage, error) {
+func (c *NpmRegistry) GetPackageInfo(ctx context.Context, name string, endpoint string) (*NpmPackage, error) {
 	var project *client.GitLabRepo
 	var err error
 
 	// searching for package as it is provided
-	if project, err = c.findPackageByName(name); err != nil {
+	if project, err = c.findPackageByName(ctx, name); err != nil {
 
 		// not found, for backward compatibility try to cut-off scope
 		slashPos := strings.Index(name, "/")
 		name := name[slashPos+1:]
 
-		if project, err = c.findPackageByName(name); err != nil {
+		if project, err = c.findPackageByName(ctx, name); err != nil {
 			return nil, err
 		}
 	}
@@ -72,7 +110,7 @@ func (c *NpmRegistry) GetPackageInfo(name string, endpoint string) (*NpmPackage,
 	}
 
 	// when filling version, connection to gitlab is required for generating sha1 hash for each tag
-	if err := rootPackage.fillVersions(c.conn, project, endpoint); err != nil {
+	if err := rootPackage.fillVersions(ctx, c.conn, project, endpoint); err != nil {
 		return nil, err
 	}
 
@@ -84,21 +122,132 @@ func (c *NpmRegistry) GetPackageInfo(name string, endpoint string) (*NpmPackage,
 	return rootPackage, nil
 }
 
+// GetPackageUUID - find uuid of package by name in package.json,
+// e.g. to query download stats
+func (c *NpmRegistry) GetPackageUUID(ctx context.Context, name string) (string, error) {
+	project, err := c.findPackageByName(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return project.UUID, nil
+}
+
+// Search - find packages visible for current token by name, keywords and description
+// of package.json in master branch, result is ordered by score.
+func (c *NpmRegistry) Search(ctx context.Context, text string, from, size int) (*NpmSearchResult, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindNpm)
+	if err != nil {
+		return nil, err
+	}
+
+	return searchNpmRepoList(projectList, text, from, size), nil
+}
+
+// rank packages of given repositories against search text and return
+// requested page, repositories are expected to be filtered for token already.
+func searchNpmRepoList(projectList []*client.GitLabRepo, text string, from, size int) *NpmSearchResult {
+	termList := getSearchTermList(text)
+	objectList := make([]npmSearchObject, 0)
+
+	for _, p := range projectList {
+		p.MetadataLock.RLock()
+		name, _ := p.Metadata.GetString("name")
+		description, _ := p.Metadata.GetString("description")
+		version, _ := p.Metadata.GetString("version")
+		keywordList := getStringList(p.Metadata, "keywords")
+		p.MetadataLock.RUnlock()
+
+		score := getSearchScore(termList, name, description, keywordList)
+		if name == "" || score == 0 {
+			continue
+		}
+
+		pkg := npmSearchPackage{
+			Name:        name,
+			Scope:       "unscoped",
+			Version:     version,
+			Description: description,
+			Keywords:    keywordList,
+			Links:       map[string]string{"repository": p.Project.WWWURL},
+		}
+
+		if strings.HasPrefix(name, "@") {
+			pkg.Scope = strings.TrimPrefix(strings.SplitN(name, "/", 2)[0], "@")
+		}
+
+		// latest released version is preferred over master one
+		latest := semver.Version{}
+		for _, tag := range p.TagList {
+			v, err := semver.Make(strings.TrimLeft(tag.Name, "v"))
+			if err == nil && v.GT(latest) {
+				latest = v
+				pkg.Version = v.String()
+				pkg.Date = tag.Time.UTC().Format(time.RFC3339)
+			}
+		}
+
+		objectList = append(objectList, npmSearchObject{
+			Package: pkg,
+			Score: npmSearchScore{
+				Final: score,
+				Detail: map[string]float64{
+					"quality":     score,
+					"popularity":  score,
+					"maintenance": score,
+				},
+			},
+			SearchScore: score,
+		})
+	}
+
+	sort.Slice(objectList, func(i, j int) bool {
+		if objectList[i].SearchScore != objectList[j].SearchScore {
+			return objectList[i].SearchScore > objectList[j].SearchScore
+		}
+
+		return objectList[i].Package.Name < objectList[j].Package.Name
+	})
+
+	result := &NpmSearchResult{
+		Objects: make([]npmSearchObject, 0),
+		Total:   len(objectList),
+		Time:    time.Now().UTC().Format(time.RFC1123),
+	}
+
+	if from < len(objectList) {
+		objectList = objectList[from:]
+		if size < len(objectList) {
+			objectList = objectList[:size]
+		}
+
+		result.Objects = objectList
+	}
+
+	return result
+}
+
 // This method should always serve packages from cache
-func (c *NpmRegistry) GetPackageArchive(uuid string, ref string) ([]byte, error) {
-	// try to fetch data from cache
+func (c *NpmRegistry) GetPackageArchive(ctx context.Context, uuid string, ref string) ([]byte, error) {
+	// cached and frozen archives are not checked against GitLab
+	if err := c.conn.CheckAccess(ctx, client.KindNpm, uuid); err != nil {
+		return nil, err
+	}
+	c.conn.SetDownload(client.KindNpm, uuid, ref)
+
+	// try to fetch data from cache or snapshot, frozen archive is served even when tag is moved or deleted
 	if finalArchive, err := helpers.GetNpmArchiveFromCache(uuid, ref); err == nil {
 		return finalArchive, nil
 	}
 
 	// fetch archive from gitlab
-	rawArchive, err := c.conn.GetArchive(client.KindNpm, uuid, ref)
+	rawArchive, err := c.conn.GetArchive(ctx, client.KindNpm, uuid, ref)
 	if err != nil {
 		return nil, err
 	}
 
 	// calculate sha1 sum and put data to cache
-	npmArchive, _, err := helpers.PutNpmArchiveToCache(rawArchive, uuid, ref)
+	npmArchive, _, err := helpers.PutNpmArchiveToCache(ctx, rawArchive, uuid, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -107,8 +256,8 @@ func (c *NpmRegistry) GetPackageArchive(uuid string, ref string) ([]byte, error)
 }
 
 //
-func (c *NpmRegistry) findPackageByName(name string) (*client.GitLabRepo, error) {
-	projectList, err := c.conn.GetRepoList(client.KindNpm)
+func (c *NpmRegistry) findPackageByName(ctx context.Context, name string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindNpm)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +273,7 @@ func (c *NpmRegistry) findPackageByName(name string) (*client.GitLabRepo, error)
 		}
 	}
 
-	return nil, fmt.Errorf("Project with name: %s not found", name)
+	return nil, ErrNpmPackageNotFound
 }
 
 // fill root level fields, versions should be generated already
@@ -147,7 +296,7 @@ func (p *NpmPackage) fillBase(src *client.GitLabRepo) error {
 }
 
 // fetch version (tag) from GitLab, calculate sha1 and store archive in cache
-func (p *NpmPackage) fillVersions(c *client.GitLabConnection, src *client.GitLabRepo, endpoint string) error {
+func (p *NpmPackage) fillVersions(ctx context.Context, c *client.GitLabConnection, src *client.GitLabRepo, endpoint string) error {
 
 	versionChan := make(chan *npmVersion)
 	guardChan := make(chan bool, runtime.NumCPU())
@@ -155,7 +304,12 @@ func (p *NpmPackage) fillVersions(c *client.GitLabConnection, src *client.GitLab
 	log.Println("==> Processing tags:", src.Project.Name)
 	for _, tag := range src.TagList {
 		go func(tag client.Tag) {
-			guardChan <- true
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				versionChan <- nil
+				return
+			}
 			defer func() {
 				<-guardChan
 			}()
@@ -170,14 +324,14 @@ func (p *NpmPackage) fillVersions(c *client.GitLabConnection, src *client.GitLab
 			}
 
 			// fetch archive for this tag and generate sha1 hash
-			rawArchive, err := c.GetArchive(client.KindNpm, src.UUID, tag.Reference)
+			rawArchive, err := c.GetArchive(ctx, client.KindNpm, src.UUID, tag.Reference)
 			if err != nil {
 				versionChan <- nil
 				return
 			}
 
 			// calculate sha1 sum and put data to cache
-			_, sum, err := helpers.PutNpmArchiveToCache(rawArchive, src.UUID, tag.Reference)
+			_, sum, err := helpers.PutNpmArchiveToCache(ctx, rawArchive, src.UUID, tag.Reference)
 			if err != nil {
 				versionChan <- nil
 				return
@@ -199,6 +353,11 @@ func (p *NpmPackage) fillVersions(c *client.GitLabConnection, src *client.GitLab
 			}
 			tag.MetadataLock.RUnlock()
 
+			// metadata frozen earlier is served instead of generated one
+			if err := freezeNpmVersion(v, src.UUID, tag.Reference, endpoint); err != nil {
+				log.Printf("==> Notice: %s: %s", src.Project.Name, err)
+			}
+
 			versionChan <- v
 		}(tag)
 	}
@@ -210,5 +369,51 @@ func (p *NpmPackage) fillVersions(c *client.GitLabConnection, src *client.GitLab
 		}
 	}
 
+	// versions frozen earlier, which tags are no longer listed by GitLab
+	metadataList, err := helpers.GetFrozenVersionMetadataList(client.KindNpm, src.UUID)
+	if err != nil {
+		log.Printf("==> Notice: %s: %s", src.Project.Name, err)
+	}
+
+	for ref, data := range metadataList {
+		if hasTagReference(src, ref) {
+			continue
+		}
+
+		v := npmVersion{}
+		if err := json.Unmarshal(data, &v); err != nil || v.Version == "" {
+			continue
+		}
+
+		if _, ok := p.Versions[v.Version]; !ok {
+			v.Dist.Tarball = fmt.Sprintf(endpoint, src.UUID, ref)
+			p.Versions[v.Version] = v
+		}
+	}
+
+	// request is cancelled, version list is incomplete
+	return ctx.Err()
+}
+
+// freeze version metadata the first time it is generated, download url
+// is always generated for current request
+func freezeNpmVersion(v *npmVersion, uuid, ref, endpoint string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	frozen, err := helpers.FreezeVersionMetadata(client.KindNpm, uuid, ref, data)
+	if err != nil {
+		return err
+	}
+
+	frozenVersion := npmVersion{}
+	if err := json.Unmarshal(frozen, &frozenVersion); err != nil {
+		return err
+	}
+
+	*v = frozenVersion
+	v.Dist.Tarball = fmt.Sprintf(endpoint, uuid, ref)
 	return nil
 }
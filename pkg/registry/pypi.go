@@ -0,0 +1,293 @@
+package registry
+
+import (
+	"bytes"
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type (
+	PypiRegistry struct {
+		conn *client.GitLabConnection
+	}
+
+	// PypiIndex - list of all projects, PEP 691 JSON form
+	PypiIndex struct {
+		Meta     pypiMeta      `json:"meta"`
+		Projects []pypiProject `json:"projects"`
+	}
+
+	// PypiProject - list of project files, PEP 691 JSON form
+	PypiProject struct {
+		Meta  pypiMeta   `json:"meta"`
+		Name  string     `json:"name"`
+		Files []pypiFile `json:"files"`
+	}
+
+	pypiMeta struct {
+		APIVersion string `json:"api-version"`
+	}
+
+	pypiProject struct {
+		Name string `json:"name"`
+	}
+
+	pypiFile struct {
+		Filename       string            `json:"filename"`
+		URL            string            `json:"url"`
+		Hashes         map[string]string `json:"hashes"`
+		RequiresPython string            `json:"requires-python,omitempty"`
+	}
+)
+
+var (
+	// ErrPypiProjectNotFound - project is not served by registry
+	ErrPypiProjectNotFound = errors.New("Project not found")
+
+	// canonical PEP 440 public version
+	pythonVersionRegexp = regexp.MustCompile(`^([1-9][0-9]*!)?(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))*((a|b|rc)(0|[1-9][0-9]*))?(\.post(0|[1-9][0-9]*))?(\.dev(0|[1-9][0-9]*))?$`)
+)
+
+// NewPypiRegistry - construct PyPI simple index emulator for GitLab
+func NewPypiRegistry(conn *client.GitLabConnection) *PypiRegistry {
+	return &PypiRegistry{
+		conn: conn,
+	}
+}
+
+// GetIndex - list of all projects visible for current token
+func (c *PypiRegistry) GetIndex(ctx context.Context) (*PypiIndex, error) {
+	repoList, err := c.conn.GetRepoList(ctx, client.KindPypi)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &PypiIndex{
+		Meta:     pypiMeta{APIVersion: "1.0"},
+		Projects: make([]pypiProject, 0),
+	}
+
+	for _, repo := range repoList {
+		repo.MetadataLock.RLock()
+		name, _ := repo.Metadata.GetString("name")
+		repo.MetadataLock.RUnlock()
+
+		if name != "" {
+			index.Projects = append(index.Projects, pypiProject{Name: name})
+		}
+	}
+
+	sort.Slice(index.Projects, func(i, j int) bool {
+		return index.Projects[i].Name < index.Projects[j].Name
+	})
+
+	return index, nil
+}
+
+// GetProject - list of source distributions of a project, one per valid tag,
+// every archive is repacked in order to calculate sha256 hash.
+func (c *PypiRegistry) GetProject(ctx context.Context, name string, endpoint string) (*PypiProject, error) {
+	repo, err := c.findProjectByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.MetadataLock.RLock()
+	projectName, _ := repo.Metadata.GetString("name")
+	repo.MetadataLock.RUnlock()
+
+	project := &PypiProject{
+		Meta:  pypiMeta{APIVersion: "1.0"},
+		Name:  helpers.NormalizePythonName(projectName),
+		Files: make([]pypiFile, 0),
+	}
+
+	fileChan := make(chan *pypiFile)
+	guardChan := make(chan bool, runtime.NumCPU())
+
+	log.Println("==> Processing tags:", repo.Project.Name)
+	for _, tag := range repo.TagList {
+		go func(tag client.Tag) {
+			select {
+			case guardChan <- true:
+			case <-ctx.Done():
+				fileChan <- nil
+				return
+			}
+			defer func() {
+				<-guardChan
+			}()
+
+			version, err := getPythonVersion(projectName, tag)
+			if err != nil {
+				fileChan <- nil
+				return
+			}
+
+			sdist, err := c.getSdistArchive(ctx, repo, tag, version)
+			if err != nil {
+				fileChan <- nil
+				return
+			}
+
+			tag.MetadataLock.RLock()
+			requiresPython, _ := tag.Metadata.GetString("requires_python")
+			tag.MetadataLock.RUnlock()
+
+			filename := helpers.GetPythonSdistName(projectName, version)
+			fileChan <- &pypiFile{
+				Filename:       filename,
+				URL:            fmt.Sprintf(endpoint, repo.UUID, tag.Reference, filename),
+				Hashes:         map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256(sdist))},
+				RequiresPython: requiresPython,
+			}
+		}(tag)
+	}
+
+	for i := 0; i < len(repo.TagList); i++ {
+		if f := <-fileChan; f != nil {
+			project.Files = append(project.Files, *f)
+		}
+	}
+
+	// request is cancelled, file list is incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(project.Files, func(i, j int) bool {
+		return project.Files[i].Filename < project.Files[j].Filename
+	})
+
+	return project, nil
+}
+
+// GetSdistArchive - get source distribution of a project for a given tag
+func (c *PypiRegistry) GetSdistArchive(ctx context.Context, uuid, ref string) ([]byte, error) {
+	repo, err := c.conn.GetRepo(ctx, client.KindPypi, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.MetadataLock.RLock()
+	projectName, _ := repo.Metadata.GetString("name")
+	repo.MetadataLock.RUnlock()
+
+	for _, tag := range repo.TagList {
+		if tag.Reference != ref {
+			continue
+		}
+
+		version, err := getPythonVersion(projectName, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		c.conn.SetDownload(client.KindPypi, repo.UUID, tag.Reference)
+		return c.getSdistArchive(ctx, repo, tag, version)
+	}
+
+	return nil, fmt.Errorf("Tag with reference %s not found", ref)
+}
+
+//
+// Private API
+//
+
+// download GitLab archive and repack it into source distribution
+func (c *PypiRegistry) getSdistArchive(ctx context.Context, repo *client.GitLabRepo, tag client.Tag, version string) ([]byte, error) {
+	archive, err := c.conn.GetArchive(ctx, client.KindPypi, repo.UUID, tag.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.MetadataLock.RLock()
+	name, _ := tag.Metadata.GetString("name")
+	pkgInfo := getPythonPkgInfo(tag.Metadata, version)
+	tag.MetadataLock.RUnlock()
+
+	return helpers.GetPythonSdistArchive(ctx, archive, name, version, repo.UUID, tag.Reference, pkgInfo)
+}
+
+// find project by normalized name in pyproject.toml/setup.cfg in each master branch of package repository
+func (c *PypiRegistry) findProjectByName(ctx context.Context, name string) (*client.GitLabRepo, error) {
+	projectList, err := c.conn.GetRepoList(ctx, client.KindPypi)
+	if err != nil {
+		return nil, err
+	}
+
+	name = helpers.NormalizePythonName(name)
+	for _, p := range projectList {
+
+		p.MetadataLock.RLock()
+		projectName, _ := p.Metadata.GetString("name")
+		p.MetadataLock.RUnlock()
+
+		if helpers.NormalizePythonName(projectName) == name {
+			return p, nil
+		}
+	}
+
+	return nil, ErrPypiProjectNotFound
+}
+
+// version is taken from tag name, which should be canonical PEP 440 version,
+// static version in metadata file, if any, should match tag.
+func getPythonVersion(projectName string, tag client.Tag) (string, error) {
+	version := strings.TrimPrefix(tag.Name, "v")
+	if !pythonVersionRegexp.MatchString(version) {
+		return "", fmt.Errorf("Tag %s is not a valid version", tag.Name)
+	}
+
+	tag.MetadataLock.RLock()
+	name, _ := tag.Metadata.GetString("name")
+	metadataVersion, _ := tag.Metadata.GetString("version")
+	tag.MetadataLock.RUnlock()
+
+	if helpers.NormalizePythonName(name) != helpers.NormalizePythonName(projectName) {
+		return "", fmt.Errorf("Tag %s belongs to project %s", tag.Name, name)
+	}
+
+	if metadataVersion != "" && metadataVersion != version {
+		return "", fmt.Errorf("Tag %s doesn't match version %s", tag.Name, metadataVersion)
+	}
+
+	return version, nil
+}
+
+// generate PKG-INFO (core metadata) for source distribution
+func getPythonPkgInfo(metadata *client.JsonMap, version string) []byte {
+	name, _ := metadata.GetString("name")
+	summary, _ := metadata.GetString("summary")
+	requiresPython, _ := metadata.GetString("requires_python")
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Metadata-Version: 2.1\n")
+	fmt.Fprintf(buf, "Name: %s\n", name)
+	fmt.Fprintf(buf, "Version: %s\n", version)
+	if summary != "" {
+		fmt.Fprintf(buf, "Summary: %s\n", strings.Replace(summary, "\n", " ", -1))
+	}
+	if requiresPython != "" {
+		fmt.Fprintf(buf, "Requires-Python: %s\n", requiresPython)
+	}
+
+	if dependencyList, err := metadata.GetListInterface("dependencies", nil); err == nil {
+		for _, dep := range *dependencyList {
+			if value, ok := dep.(string); ok {
+				fmt.Fprintf(buf, "Requires-Dist: %s\n", value)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
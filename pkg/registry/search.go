@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"strings"
+)
+
+// split search text into lowercase terms
+func getSearchTermList(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+// score package against search terms, every term should match name, keywords
+// or description, name matches weigh more. Zero score means package doesn't match.
+func getSearchScore(termList []string, name, description string, keywordList []string) float64 {
+	if len(termList) == 0 {
+		return 1
+	}
+
+	name = strings.ToLower(name)
+	description = strings.ToLower(description)
+
+	total := 0.0
+	for _, term := range termList {
+		score := 0.0
+		switch {
+		case name == term || strings.HasSuffix(name, "/"+term):
+			score = 1
+
+		case strings.Contains(name, term):
+			score = 0.8
+
+		case hasKeyword(keywordList, term):
+			score = 0.6
+
+		case strings.Contains(description, term):
+			score = 0.4
+		}
+
+		if score == 0 {
+			return 0
+		}
+
+		total += score
+	}
+
+	return total / float64(len(termList))
+}
+
+// check keyword list contains term, case-insensitive
+func hasKeyword(keywordList []string, term string) bool {
+	for _, keyword := range keywordList {
+		if strings.ToLower(keyword) == term {
+			return true
+		}
+	}
+
+	return false
+}
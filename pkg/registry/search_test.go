@@ -0,0 +1,164 @@
+package registry
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/client/gitlab"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetSearchTermList(t *testing.T) {
+	assert.Equal(t, []string{"acme", "http", "client"}, getSearchTermList("  Acme HTTP\tclient "))
+	assert.Equal(t, []string{}, getSearchTermList(""))
+}
+
+func TestGetSearchScore(t *testing.T) {
+	keywordList := []string{"HTTP", "rest"}
+	description := "Client for the Acme API"
+
+	testList := []struct {
+		text  string
+		name  string
+		score float64
+	}{
+		{text: "", name: "acme/client", score: 1},
+		{text: "acme/client", name: "acme/client", score: 1},
+		{text: "client", name: "acme/client", score: 1},
+		{text: "cli", name: "acme/client", score: 0.8},
+		{text: "http", name: "acme/client", score: 0.6},
+		{text: "api", name: "acme/client", score: 0.4},
+		{text: "CLIENT http", name: "acme/client", score: 0.8},
+		{text: "client missing", name: "acme/client", score: 0},
+		{text: "logger", name: "acme/client", score: 0},
+	}
+
+	for _, test := range testList {
+		score := getSearchScore(getSearchTermList(test.text), test.name, description, keywordList)
+		assert.InDelta(t, test.score, score, 0.0001, test.text)
+	}
+}
+
+func TestSearchNpmRepoList(t *testing.T) {
+	repoList := []*client.GitLabRepo{
+		newTestSearchRepo("@acme/http-client", "HTTP client", "library", []string{"http"}, "v1.0.0", "v1.2.0"),
+		newTestSearchRepo("http", "Bare HTTP server", "library", nil),
+		newTestSearchRepo("logger", "Logger with http transport", "library", nil),
+		newTestSearchRepo("acme-api", "Acme API", "library", []string{"HTTP"}),
+		newTestSearchRepo("queue", "Job queue", "library", nil),
+	}
+
+	result := searchNpmRepoList(repoList, "http", 0, 20)
+	assert.Equal(t, 4, result.Total)
+	assert.Equal(t, []string{"http", "@acme/http-client", "acme-api", "logger"}, getTestNpmNameList(result))
+
+	// scoped package, latest released version is preferred over master one
+	pkg := result.Objects[1].Package
+	assert.Equal(t, "acme", pkg.Scope)
+	assert.Equal(t, "1.2.0", pkg.Version)
+	assert.Equal(t, "2018-01-02T00:00:00Z", pkg.Date)
+	assert.Equal(t, "unscoped", result.Objects[0].Package.Scope)
+
+	// paging keeps total of all matched packages
+	testList := []struct {
+		from     int
+		size     int
+		nameList []string
+	}{
+		{from: 0, size: 2, nameList: []string{"http", "@acme/http-client"}},
+		{from: 2, size: 2, nameList: []string{"acme-api", "logger"}},
+		{from: 3, size: 20, nameList: []string{"logger"}},
+		{from: 4, size: 20, nameList: []string{}},
+		{from: 10, size: 20, nameList: []string{}},
+	}
+
+	for _, test := range testList {
+		result := searchNpmRepoList(repoList, "http", test.from, test.size)
+		assert.Equal(t, 4, result.Total)
+		assert.Equal(t, test.nameList, getTestNpmNameList(result), "from=%d size=%d", test.from, test.size)
+	}
+}
+
+func TestSearchComposerRepoList(t *testing.T) {
+	repoList := []*client.GitLabRepo{
+		newTestSearchRepo("acme/http-client", "HTTP client", "", []string{"http"}),
+		newTestSearchRepo("acme/http", "HTTP kernel", "library", nil),
+		newTestSearchRepo("acme/http-bundle", "HTTP bundle", "symfony-bundle", nil),
+		newTestSearchRepo("", "Package without name", "library", nil),
+		newTestSearchRepo("acme/queue", "Job queue", "library", nil),
+	}
+
+	testList := []struct {
+		query       string
+		packageType string
+		nameList    []string
+	}{
+		{query: "http", nameList: []string{"acme/http", "acme/http-bundle", "acme/http-client"}},
+		{query: "http", packageType: "library", nameList: []string{"acme/http", "acme/http-client"}},
+		{query: "http", packageType: "symfony-bundle", nameList: []string{"acme/http-bundle"}},
+		{query: "queue", packageType: "symfony-bundle", nameList: []string{}},
+		{query: "", nameList: []string{"acme/http", "acme/http-bundle", "acme/http-client", "acme/queue"}},
+	}
+
+	for _, test := range testList {
+		result := searchComposerRepoList(repoList, test.query, test.packageType)
+
+		nameList := make([]string, 0)
+		for _, item := range result.Results {
+			nameList = append(nameList, item.Name)
+		}
+
+		assert.Equal(t, test.nameList, nameList, test.query+" "+test.packageType)
+		assert.Equal(t, len(test.nameList), result.Total)
+	}
+}
+
+//
+// Private API
+//
+
+// repository with master metadata and released tags
+func newTestSearchRepo(name, description, packageType string, keywordList []string, tagList ...string) *client.GitLabRepo {
+	metadata := client.JsonMap{"description": description, "version": "0.0.1"}
+	if name != "" {
+		metadata["name"] = name
+	}
+	if packageType != "" {
+		metadata["type"] = packageType
+	}
+	if keywordList != nil {
+		keywords := make([]interface{}, 0)
+		for _, keyword := range keywordList {
+			keywords = append(keywords, keyword)
+		}
+		metadata["keywords"] = keywords
+	}
+
+	repo := &client.GitLabRepo{
+		Project:      &gitlab.Project{WWWURL: "https://gitlab.local/" + name},
+		UUID:         "uuid-" + name,
+		TagList:      make([]client.Tag, 0),
+		Metadata:     &metadata,
+		MetadataLock: new(sync.RWMutex),
+	}
+
+	for i, tag := range tagList {
+		repo.TagList = append(repo.TagList, client.Tag{
+			Name: tag,
+			Time: time.Date(2018, 1, 1+i, 0, 0, 0, 0, time.UTC),
+		})
+	}
+
+	return repo
+}
+
+// package names of search result objects
+func getTestNpmNameList(result *NpmSearchResult) []string {
+	nameList := make([]string, 0)
+	for _, object := range result.Objects {
+		nameList = append(nameList, object.Package.Name)
+	}
+
+	return nameList
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/tokens"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/macaron.v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+type (
+	// issue token request, ttl is a duration (e.g. "720h"), token without ttl never expires
+	issueTokenRequest struct {
+		Name     string   `json:"name"`
+		KindList []string `json:"kinds"`
+		UUIDList []string `json:"packages"`
+		TTL      string   `json:"ttl"`
+	}
+
+	// issued token value is displayed only once
+	issueTokenResponse struct {
+		Token string       `json:"token"`
+		Info  tokens.Token `json:"info"`
+	}
+)
+
+var (
+	adminRequestSize = int64(64 * 1024)
+)
+
+// AdminAuthorizer - protect admin API and Web UI with PAVLIK_ADMIN_TOKEN,
+// endpoints are disabled when token is not configured.
+func AdminAuthorizer() macaron.Handler {
+	return func(ctx *macaron.Context) {
+		adminToken := os.Getenv("PAVLIK_ADMIN_TOKEN")
+		if adminToken == "" {
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		token := helpers.GetTokenFromRequest(ctx.Req.Request)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			writeDenied(ctx)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// TokenStore - provide issued token store,
+// endpoints are disabled when PAVLIK_DATA_DIR is not configured.
+func TokenStore(store *tokens.Store) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		if store == nil {
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ctx.Map(store)
+		ctx.Next()
+	}
+}
+
+//
+// Private API
+//
+
+// list issued tokens, json
+func serveTokenList(ctx *macaron.Context, store *tokens.Store) {
+	ctx.JSON(200, store.List())
+}
+
+// issue token, json
+func serveTokenIssue(ctx *macaron.Context, store *tokens.Store) {
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Request.Body, adminRequestSize))
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	req := &issueTokenRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid issue token request"})
+		return
+	}
+
+	response, err := issueToken(store, req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// revoke token, json
+func serveTokenRevoke(ctx *macaron.Context, store *tokens.Store) {
+	err := store.Revoke(ctx.Params(":id"))
+	if err == tokens.ErrTokenNotFound {
+		writeNotFound(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.Resp.WriteHeader(http.StatusNoContent)
+}
+
+// display issued tokens, Web UI
+func serveTokenPage(ctx *macaron.Context, store *tokens.Store) {
+	ctx.Data["TokenList"] = store.List()
+	ctx.Data["KindList"] = client.KindList
+	ctx.HTML(200, "issued_tokens")
+}
+
+// issue or revoke token, Web UI
+func serveTokenPageAction(ctx *macaron.Context, store *tokens.Store) {
+	if err := ctx.Req.ParseForm(); err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	form := ctx.Req.PostForm
+	switch form.Get("action") {
+	case "issue":
+		response, err := issueToken(store, &issueTokenRequest{
+			Name:     form.Get("name"),
+			KindList: form["kinds"],
+			UUIDList: helpers.SplitList(form.Get("packages")),
+			TTL:      form.Get("ttl"),
+		})
+		if err != nil {
+			ctx.Data["Error"] = err.Error()
+		} else {
+			ctx.Data["Issued"] = response
+		}
+
+		serveTokenPage(ctx, store)
+		return
+
+	case "revoke":
+		if err := store.Revoke(form.Get("id")); err != nil {
+			ctx.Data["Error"] = err.Error()
+			serveTokenPage(ctx, store)
+			return
+		}
+	}
+
+	ctx.Redirect("/admin/tokens", 302)
+}
+
+// validate request and issue token
+func issueToken(store *tokens.Store, req *issueTokenRequest) (*issueTokenResponse, error) {
+	var ttl time.Duration
+	var err error
+
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl < 0 {
+			return nil, fmt.Errorf("Invalid ttl: %s", req.TTL)
+		}
+	}
+
+	for _, kind := range req.KindList {
+		if !isKnownKind(kind) {
+			return nil, fmt.Errorf("Unknown kind: %s", kind)
+		}
+	}
+
+	value, t, err := store.Issue(req.Name, req.KindList, req.UUIDList, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &issueTokenResponse{
+		Token: value,
+		Info:  *t,
+	}
+	response.Info.Hash = ""
+	return response, nil
+}
+
+// kind is one of supported registries
+func isKnownKind(kind string) bool {
+	for _, known := range client.KindList {
+		if known == kind {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/audit"
+	"comrade-pavlik2/pkg/client"
+	"gopkg.in/macaron.v1"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// routes of packages served by GitLab, which are identified by uuid, file name or path
+	auditNameRouteList = []string{"composer_zip", "npm_tgz", "pypi_sdist", "helm_chart", "maven", "rubygems_gem"}
+)
+
+// Audit - record package downloads and metadata access of GitLab user behind the token,
+// request is recorded after response is written, so response status is known.
+func Audit(logger *audit.Logger) macaron.Handler {
+	return func(ctx *macaron.Context, c *client.GitLabConnection) {
+		if logger == nil {
+			return
+		}
+
+		ctx.Next()
+
+		routeName := getRouteName(ctx.Req.URL.Path)
+		kind, pkg, version, ok := getAuditPackage(ctx, routeName)
+		if !ok {
+			return
+		}
+
+		username, err := c.GetUsername(ctx.Req.Context())
+		if err != nil {
+			log.Printf("==> Audit: failed to resolve username: %s", err)
+			username = "unknown"
+		}
+
+		entry := &audit.Entry{
+			Time:      time.Now().UTC(),
+			User:      username,
+			Kind:      kind,
+			Package:   pkg,
+			Version:   version,
+			Route:     routeName,
+			IP:        ctx.RemoteAddr(),
+			UserAgent: ctx.Req.UserAgent(),
+			Status:    ctx.Resp.Status(),
+		}
+		fillAuditPackageName(ctx, c, entry)
+
+		if err := logger.Write(entry); err != nil {
+			log.Printf("==> Audit: failed to write entry: %s", err)
+		}
+	}
+}
+
+// AuditLog - provide audit log,
+// endpoints are disabled when PAVLIK_DATA_DIR is not configured.
+func AuditLog(logger *audit.Logger) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		if logger == nil {
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ctx.Map(logger)
+		ctx.Next()
+	}
+}
+
+//
+// Private API
+//
+
+// query audit log, json
+func serveAuditList(ctx *macaron.Context, logger *audit.Logger) {
+	list, err := logger.Query(getAuditFilter(ctx))
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, list)
+}
+
+// query audit log, Web UI
+func serveAuditPage(ctx *macaron.Context, logger *audit.Logger) {
+	filter := getAuditFilter(ctx)
+	list, err := logger.Query(filter)
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.Data["Filter"] = filter
+	ctx.Data["EntryList"] = list
+	ctx.Data["KindList"] = client.KindList
+	ctx.HTML(200, "audit_log")
+}
+
+// filter from query string, at most 1000 entries are returned
+func getAuditFilter(ctx *macaron.Context) audit.Filter {
+	limit := ctx.QueryInt("limit")
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	return audit.Filter{
+		User:    ctx.Query("user"),
+		Kind:    ctx.Query("kind"),
+		Package: ctx.Query("package"),
+		Limit:   limit,
+	}
+}
+
+// Extract kind, package and version of audited request, keep in sync
+// with routes and getRouteName. Packages served by GitLab are identified
+// by uuid in download urls, and by name in metadata urls.
+func getAuditPackage(ctx *macaron.Context, routeName string) (string, string, string, bool) {
+	switch routeName {
+	case "composer_packages":
+		return client.KindComposer, "*", "", true
+
+	case "composer_zip":
+		return client.KindComposer, ctx.Params(":uuid"), ctx.Params(":ref"), true
+
+	case "npm_metadata":
+		return client.KindNpm, ctx.Params("*"), "", true
+
+	case "npm_tgz":
+		return client.KindNpm, ctx.Params(":uuid"), ctx.Params(":ref"), true
+
+	case "goproxy":
+		requestPath := strings.TrimLeft(ctx.Req.URL.Path, "/")
+		if pos := strings.LastIndex(requestPath, "/@v/"); pos >= 0 {
+			return client.KindGo, requestPath[:pos], requestPath[pos+len("/@v/"):], true
+		}
+
+		return client.KindGo, strings.TrimSuffix(requestPath, "/@latest"), "", true
+
+	case "pypi_simple":
+		project := ctx.Params(":project")
+		if project == "" {
+			project = "*"
+		}
+
+		return client.KindPypi, project, "", true
+
+	case "pypi_sdist":
+		return client.KindPypi, ctx.Params(":uuid"), ctx.Params(":ref"), true
+
+	case "helm_index":
+		return client.KindHelm, "*", "", true
+
+	case "helm_chart":
+		return client.KindHelm, ctx.Params(":uuid"), ctx.Params(":ref"), true
+
+	case "maven":
+		return client.KindMaven, ctx.Params("*"), getMavenPathVersion(ctx.Params("*")), true
+
+	case "cargo_crate":
+		return client.KindCargo, ctx.Params(":crate"), ctx.Params(":version"), true
+
+	case "rubygems_gem":
+		return client.KindGem, ctx.Params(":file"), "", true
+	}
+
+	return "", "", "", false
+}
+
+// Record package served by GitLab with both uuid and name. Uuid of download addressed
+// by name is recorded by registry, name of package addressed by uuid, file or path
+// is resolved from metadata of downloaded version, so the same package is found
+// in audit log by name no matter which url was requested.
+func fillAuditPackageName(ctx *macaron.Context, c *client.GitLabConnection, e *audit.Entry) {
+	uuid, ref := ctx.Params(":uuid"), ctx.Params(":ref")
+	if d := c.GetDownload(); d != nil {
+		uuid, ref = d.UUID, d.Reference
+	}
+
+	if uuid == "" {
+		return
+	}
+	e.UUID = uuid
+
+	if !isAuditNameRoute(e.Route) {
+		return
+	}
+
+	name, err := c.GetPackageName(ctx.Req.Context(), e.Kind, uuid, ref)
+	if err != nil {
+		// e.g. access denied, uuid is recorded as package
+		log.Printf("==> Audit: failed to resolve package name of %s: %s", uuid, err)
+		return
+	}
+
+	if e.Route == "rubygems_gem" {
+		e.Version = strings.TrimSuffix(strings.TrimPrefix(e.Package, name+"-"), ".gem")
+	}
+
+	e.Package = name
+}
+
+// package is not identified by name in url of route
+func isAuditNameRoute(routeName string) bool {
+	for _, name := range auditNameRouteList {
+		if name == routeName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// version of artifact file path, e.g. com/acme/auth/1.2.0/auth-1.2.0-sources.jar,
+// empty for metadata of artifact
+func getMavenPathVersion(requestPath string) string {
+	partList := strings.Split(strings.Trim(requestPath, "/"), "/")
+	if len(partList) < 3 {
+		return ""
+	}
+
+	artifactID, version, file := partList[len(partList)-3], partList[len(partList)-2], partList[len(partList)-1]
+	if !strings.HasPrefix(file, artifactID+"-"+version) {
+		return ""
+	}
+
+	return version
+}
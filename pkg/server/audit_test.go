@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetMavenPathVersion(t *testing.T) {
+	testList := []struct {
+		path    string
+		version string
+	}{
+		{path: "com/acme/auth/1.2.0/auth-1.2.0-sources.jar", version: "1.2.0"},
+		{path: "com/acme/auth/1.2.0/auth-1.2.0.pom.sha1", version: "1.2.0"},
+		{path: "com/acme/auth/maven-metadata.xml", version: ""},
+		{path: "com/acme/auth/1.2.0/", version: ""},
+		{path: "auth", version: ""},
+	}
+
+	for _, test := range testList {
+		assert.Equal(t, test.version, getMavenPathVersion(test.path), test.path)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"crypto/sha1"
+	"fmt"
+	"gopkg.in/macaron.v1"
+	"log"
+	"sort"
+	"strings"
+)
+
+type (
+	// packages of kind visible for token
+	packageGroup struct {
+		Kind        string
+		PackageList []*client.PackageEntry
+	}
+
+	// package page of Web UI
+	packagePage struct {
+		Kind           string
+		UUID           string
+		Name           string
+		Description    string
+		WWWURL         string
+		VersionList    []client.Tag // newest first
+		Version        string       // selected version, empty for master
+		Reference      string
+		Install        string
+		DependencyList []packageDependency
+		ReadmeName     string
+		Readme         string
+		Shasum         string // sha1 of served archive, npm and composer only
+	}
+
+	// dependency and version constraint
+	packageDependency struct {
+		Name       string
+		Constraint string
+	}
+)
+
+var (
+	// metadata key of package name, "name" if not listed
+	packageNameKeyList = map[string]string{
+		client.KindGo:    "module",
+		client.KindMaven: "artifactId",
+	}
+
+	// metadata key of dependencies, dependencies of other kinds are not displayed
+	packageDependencyKeyList = map[string]string{
+		client.KindComposer: "require",
+		client.KindNpm:      "dependencies",
+	}
+
+	// install command of version
+	packageInstallFmtList = map[string]string{
+		client.KindComposer: "composer require %s:%s",
+		client.KindNpm:      "npm install %s@%s",
+		client.KindGo:       "go get %s@%s",
+		client.KindPypi:     "pip install %s==%s",
+		client.KindHelm:     "helm install %[1]s acme/%[1]s --version %[2]s",
+		client.KindCargo:    "cargo add %s@%s --registry pavlik",
+		client.KindGem:      "gem install %s -v %s",
+	}
+)
+
+//
+// Private API
+//
+
+// list packages visible for token grouped by kind, Web UI
+func servePackageList(ctx *macaron.Context, c *client.GitLabConnection) {
+	groupList := make([]packageGroup, 0)
+	for _, kind := range client.KindList {
+		packageList, err := c.GetPackageList(ctx.Req.Context(), kind)
+		if err != nil {
+			writeErr(ctx, err)
+			return
+		}
+
+		if len(packageList) == 0 {
+			continue
+		}
+
+		sort.Slice(packageList, func(i, j int) bool {
+			return strings.ToLower(packageList[i].Project.Name) < strings.ToLower(packageList[j].Project.Name)
+		})
+
+		groupList = append(groupList, packageGroup{Kind: kind, PackageList: packageList})
+	}
+
+	ctx.Data["GroupList"] = groupList
+	ctx.HTML(200, "package_list")
+}
+
+// display versions, readme, dependencies and install snippet of package version,
+// version is selected by "version" query parameter, newest version by default
+func servePackagePage(ctx *macaron.Context, c *client.GitLabConnection) {
+	kind := ctx.Params(":kind")
+	uuid := ctx.Params(":uuid")
+
+	repo, err := c.GetRepo(ctx.Req.Context(), kind, uuid)
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	page := &packagePage{
+		Kind:        kind,
+		UUID:        uuid,
+		Name:        repo.Project.Name,
+		WWWURL:      repo.Project.WWWURL,
+		VersionList: repo.TagList,
+		Reference:   "master",
+	}
+
+	sort.Slice(page.VersionList, func(i, j int) bool {
+		return page.VersionList[i].Time.After(page.VersionList[j].Time)
+	})
+
+	metadata := repo.Metadata
+	metadataLock := repo.MetadataLock
+	for _, tag := range page.VersionList {
+		if ctx.Query("version") == "" || ctx.Query("version") == tag.Name {
+			page.Version = tag.Name
+			page.Reference = tag.Reference
+			metadata = tag.Metadata
+			metadataLock = tag.MetadataLock
+			break
+		}
+	}
+
+	metadataLock.RLock()
+	page.fillMetadata(metadata)
+	metadataLock.RUnlock()
+
+	// readme is optional, page is displayed anyway
+	archive, err := c.GetArchive(ctx.Req.Context(), kind, uuid, page.Reference)
+	if err != nil {
+		log.Printf("==> Notice: Failed to fetch archive for %s # %s: %s", uuid, page.Reference, err)
+	} else {
+		page.fillArchive(ctx, archive)
+	}
+
+	ctx.Data["Page"] = page
+	ctx.Data["Title"] = page.Name
+	ctx.HTML(200, "package_page")
+}
+
+// fill name, description, dependencies and install snippet
+func (p *packagePage) fillMetadata(metadata *client.JsonMap) {
+	nameKey, ok := packageNameKeyList[p.Kind]
+	if !ok {
+		nameKey = "name"
+	}
+
+	if name, err := metadata.GetString(nameKey); err == nil && name != "" {
+		p.Name = name
+	}
+	p.Description, _ = metadata.GetString("description")
+
+	if installFmt, ok := packageInstallFmtList[p.Kind]; ok && p.Version != "" {
+		version := p.Version
+		if p.Kind != client.KindGo {
+			version = strings.TrimLeft(version, "v")
+		}
+
+		p.Install = fmt.Sprintf(installFmt, p.Name, version)
+	}
+
+	p.DependencyList = make([]packageDependency, 0)
+	if key, ok := packageDependencyKeyList[p.Kind]; ok {
+		if dependencyList, err := metadata.GetMapInterface(key, nil); err == nil {
+			for name, constraint := range *dependencyList {
+				p.DependencyList = append(p.DependencyList, packageDependency{
+					Name:       name,
+					Constraint: fmt.Sprintf("%v", constraint),
+				})
+			}
+		}
+	}
+
+	sort.Slice(p.DependencyList, func(i, j int) bool {
+		return p.DependencyList[i].Name < p.DependencyList[j].Name
+	})
+}
+
+// fill readme and shasum of archive served to package manager
+func (p *packagePage) fillArchive(ctx *macaron.Context, archive []byte) {
+	if name, data, err := helpers.GetReadme(archive); err == nil {
+		p.ReadmeName = name
+		p.Readme = string(data)
+	}
+
+	// master is never served to package managers
+	if p.Version == "" {
+		return
+	}
+
+	var served []byte
+	var err error
+
+	switch p.Kind {
+	case client.KindNpm:
+		served, _, err = helpers.PutNpmArchiveToCache(ctx.Req.Context(), archive, p.UUID, p.Reference)
+
+	case client.KindComposer:
+		served, err = helpers.GetComposerArchive(ctx.Req.Context(), archive, p.UUID, p.Reference)
+
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Printf("==> Notice: Failed to repack archive for %s # %s: %s", p.UUID, p.Reference, err)
+		return
+	}
+
+	p.Shasum = fmt.Sprintf("%x", sha1.Sum(served))
+}
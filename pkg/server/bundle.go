@@ -0,0 +1,235 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/bundle"
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/registry"
+	"comrade-pavlik2/pkg/tokens"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/macaron.v1"
+	"io"
+	"log"
+	"os"
+)
+
+// BundleAuthorizer - there is no GitLab in offline mode, so packages are served
+// for tokens issued by Pavlik when token store is enabled, and without token
+// only when anonymous access is explicitly allowed.
+func BundleAuthorizer(store *tokens.Store, anonymous bool) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		var allow bundle.AccessFunc
+		if store == nil && !anonymous {
+			writeDenied(ctx)
+			return
+		}
+
+		if store != nil {
+			issued, err := store.Verify(helpers.GetTokenFromRequest(ctx.Req.Request))
+			if err != nil {
+				writeDenied(ctx)
+				return
+			}
+
+			allow = issued.Allows
+		}
+
+		ctx.Map(allow)
+		ctx.Next()
+	}
+}
+
+// ExportBundle - write bundle of composer and npm package versions, "kind:name[@version]" each,
+// metadata is generated and archives are fetched from GitLab with service token.
+func ExportBundle(ctx context.Context, w io.Writer, specList []string) (*bundle.Manifest, error) {
+	requestList, err := bundle.ParseRequestList(specList)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.CheckConfig(); err != nil {
+		return nil, err
+	}
+
+	conn, err := client.NewConnectionFromServiceToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	composerRegistry := registry.NewComposerRegistry(conn)
+	npmRegistry := registry.NewNpmRegistry(conn)
+
+	// composer package is found by name in whole list only
+	var composerPackages *registry.ComposerPackage
+
+	bw := bundle.NewWriter(w)
+	for _, req := range requestList {
+		var metadata []byte
+
+		switch req.Kind {
+		case client.KindComposer:
+			if composerPackages == nil {
+				composerPackages, err = composerRegistry.GetPackageInfoList(ctx, bundle.BaseURL+"/composer/%s/%s.zip")
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			versionMap, ok := composerPackages.Packages[req.Name]
+			if !ok {
+				return nil, fmt.Errorf("%s: %s", req.Name, bundle.ErrPackageNotFound)
+			}
+
+			metadata, err = json.Marshal(versionMap)
+
+		case client.KindNpm:
+			var pkg *registry.NpmPackage
+			pkg, err = npmRegistry.GetPackageInfo(ctx, req.Name, bundle.BaseURL+"/npm/%s/%s.tgz")
+			if err == registry.ErrNpmPackageNotFound {
+				return nil, fmt.Errorf("%s: %s", req.Name, bundle.ErrPackageNotFound)
+			}
+			if err == nil {
+				metadata, err = json.Marshal(pkg)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		artifactList, err := bw.AddPackage(req, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range artifactList {
+			var archive []byte
+			if a.Kind == client.KindComposer {
+				archive, err = composerRegistry.GetPackageArchive(ctx, a.UUID, a.Reference)
+			} else {
+				archive, err = npmRegistry.GetPackageArchive(ctx, a.UUID, a.Reference)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err := bw.AddArtifact(a, archive); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return bw.Close()
+}
+
+//
+// Private API
+//
+
+// Offline server: composer and npm routes are served from imported bundles,
+// read-only, GitLab is not accessed at all.
+func newOfflineServer(m *macaron.Macaron, tokenStore *tokens.Store) *macaron.Macaron {
+	bundleStore, err := bundle.NewStore(os.Getenv("PAVLIK_BUNDLE_DIR"))
+	if err != nil {
+		log.Fatalf("ERROR: Failed to load imported bundles: %s", err)
+	}
+
+	// private packages are never served without token by accident
+	anonymous := os.Getenv("PAVLIK_BUNDLE_ANONYMOUS") == "true"
+	if tokenStore == nil && !anonymous {
+		log.Fatalf("ERROR: PAVLIK_DATA_DIR is required to serve bundles, set PAVLIK_BUNDLE_ANONYMOUS=true to serve bundles without token")
+	}
+
+	// readiness probe, no token required
+	m.Get("/readyz", func(ctx *macaron.Context) {
+		ctx.JSON(200, client.GetLivenessReport())
+	})
+
+	// issued tokens and imported packages, protected by own token
+	m.Group("/admin", func() {
+		m.Get("/tokens", TokenStore(tokenStore), serveTokenPage)
+		m.Post("/tokens", TokenStore(tokenStore), serveTokenPageAction)
+		m.Get("/api/tokens", TokenStore(tokenStore), serveTokenList)
+		m.Post("/api/tokens", TokenStore(tokenStore), serveTokenIssue)
+		m.Delete("/api/tokens/:id", TokenStore(tokenStore), serveTokenRevoke)
+		m.Get("/api/bundles", func(ctx *macaron.Context) {
+			ctx.JSON(200, bundleStore.PackageList())
+		})
+	}, AdminAuthorizer())
+
+	// every route below require token issued by Pavlik, unless anonymous access is allowed
+	m.Group("", func() {
+		//
+		// COMPOSER PACKAGE MANAGER
+		// ========================
+		//
+		// bundle route, display all imported packages
+		// allowed for provided token.
+		//
+		m.Get("/packages.json", func(ctx *macaron.Context, allow bundle.AccessFunc) {
+			response, err := bundleStore.GetComposerPackages(getPackageDownloadURL(ctx, ""), allow)
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/json", response)
+		})
+
+		//
+		// bundle route, serve zip archive
+		//
+		m.Get("/composer/:uuid/:ref.zip", func(ctx *macaron.Context, allow bundle.AccessFunc) {
+			file := fmt.Sprintf("%s/%s/%s.zip", client.KindComposer, ctx.Params(":uuid"), ctx.Params(":ref"))
+			writeBundleArtifact(ctx, bundleStore, file, "application/zip", allow)
+		})
+
+		//
+		// NODE.JS PACKAGE MANAGER
+		// =======================
+		//
+		// bundle route, download package archive
+		//
+		m.Get("/npm/:uuid/:ref.tgz", func(ctx *macaron.Context, allow bundle.AccessFunc) {
+			file := fmt.Sprintf("%s/%s/%s.tgz", client.KindNpm, ctx.Params(":uuid"), ctx.Params(":ref"))
+			writeBundleArtifact(ctx, bundleStore, file, "application/gzip", allow)
+		})
+
+		//
+		// bundle route, request package info
+		//
+		m.Get("/*", func(ctx *macaron.Context, allow bundle.AccessFunc) {
+			response, err := bundleStore.GetNpmPackage(ctx.Params("*"), getPackageDownloadURL(ctx, ""), allow)
+			if err == bundle.ErrPackageNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/json", response)
+		})
+	}, BundleAuthorizer(tokenStore, anonymous))
+
+	return m
+}
+
+// Respond with imported artifact
+func writeBundleArtifact(ctx *macaron.Context, store *bundle.Store, file, mime string, allow bundle.AccessFunc) {
+	response, err := store.GetArtifact(file, allow)
+	if err == bundle.ErrPackageNotFound {
+		writeNotFound(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	writeOk(ctx, mime, response)
+}
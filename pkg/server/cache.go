@@ -0,0 +1,248 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/cache"
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/registry"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/macaron.v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type (
+	// cache utilization and entries matching filter
+	cacheListResponse struct {
+		UsageList []cache.Usage `json:"usage"`
+		EntryList []cache.Entry `json:"entries"`
+	}
+
+	// rebuild archive of package version, version is tag name or commit
+	rebuildCacheRequest struct {
+		Kind    string `json:"kind"`
+		Package string `json:"package"`
+		Version string `json:"version"`
+	}
+
+	// evicted entries and rebuilt archive
+	rebuildCacheResponse struct {
+		Evicted   int    `json:"evicted"`
+		Reference string `json:"reference"`
+		Size      int    `json:"size"`
+		Shasum    string `json:"shasum"`
+	}
+)
+
+var (
+	// ErrCacheFilterRequired - whole cache is never evicted via admin API
+	ErrCacheFilterRequired = errors.New("Key or package is required")
+
+	// ErrCacheRebuildUnsupported - only archives addressed by package uuid and commit are rebuilt
+	ErrCacheRebuildUnsupported = errors.New("Rebuild is supported for composer and npm only")
+
+	// ErrCacheVersionNotFound - package has no such tag or commit
+	ErrCacheVersionNotFound = errors.New("Version not found")
+
+	// ErrCacheRebuildFrozen - archive is frozen by PAVLIK_SNAPSHOT_DIR, frozen archive is served as is
+	ErrCacheRebuildFrozen = errors.New("Archive is frozen in snapshot, it is never rebuilt")
+)
+
+//
+// Private API
+//
+
+// cache utilization and entries, json
+func serveCacheList(ctx *macaron.Context) {
+	ctx.JSON(200, getCacheList(getCacheFilter(ctx)))
+}
+
+// evict entries by key or by package and version, json
+func serveCacheEvict(ctx *macaron.Context) {
+	filter := getCacheFilter(ctx)
+	if filter.Key == "" && filter.Package == "" {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": ErrCacheFilterRequired.Error()})
+		return
+	}
+
+	ctx.JSON(200, map[string]int{"evicted": cache.Evict(filter)})
+}
+
+// evict and rebuild archive of package version, json
+func serveCacheRebuild(ctx *macaron.Context) {
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Request.Body, adminRequestSize))
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	req := &rebuildCacheRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rebuild request"})
+		return
+	}
+
+	response, err := rebuildCache(ctx.Req.Context(), req)
+	if err == ErrCacheRebuildUnsupported || err == ErrCacheVersionNotFound || err == ErrCacheRebuildFrozen || err == client.ErrServiceTokenRequired {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, response)
+}
+
+// moved tags detected, json
+func serveMovedTagList(ctx *macaron.Context) {
+	ctx.JSON(200, client.GetMovedTagList())
+}
+
+// display cache utilization, entries and moved tags, Web UI
+func serveCachePage(ctx *macaron.Context) {
+	writeCachePage(ctx, getCacheFilter(ctx))
+}
+
+// evict or rebuild entries, Web UI
+func serveCachePageAction(ctx *macaron.Context) {
+	if err := ctx.Req.ParseForm(); err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	form := ctx.Req.PostForm
+	filter := cache.Filter{
+		Key:     form.Get("key"),
+		Package: form.Get("package"),
+		Version: form.Get("version"),
+	}
+
+	switch form.Get("action") {
+	case "evict":
+		if filter.Key == "" && filter.Package == "" {
+			ctx.Data["Error"] = ErrCacheFilterRequired.Error()
+			break
+		}
+
+		ctx.Data["Message"] = fmt.Sprintf("%d entries evicted", cache.Evict(filter))
+
+	case "rebuild":
+		response, err := rebuildCache(ctx.Req.Context(), &rebuildCacheRequest{
+			Kind:    form.Get("kind"),
+			Package: filter.Package,
+			Version: filter.Version,
+		})
+		if err != nil {
+			ctx.Data["Error"] = err.Error()
+			break
+		}
+
+		ctx.Data["Message"] = fmt.Sprintf("%d entries evicted, archive %s rebuilt, shasum %s", response.Evicted, response.Reference, response.Shasum)
+	}
+
+	// filter by package only, evicted key or version is gone
+	writeCachePage(ctx, cache.Filter{Package: filter.Package})
+}
+
+// Respond with cache page
+func writeCachePage(ctx *macaron.Context, filter cache.Filter) {
+	ctx.Data["Filter"] = filter
+	ctx.Data["Cache"] = getCacheList(filter)
+	ctx.Data["MovedTagList"] = client.GetMovedTagList()
+	ctx.HTML(200, "cache_admin")
+}
+
+// filter from query string
+func getCacheFilter(ctx *macaron.Context) cache.Filter {
+	return cache.Filter{
+		Key:     ctx.Query("key"),
+		Package: ctx.Query("package"),
+		Version: ctx.Query("version"),
+	}
+}
+
+// utilization of all caches and entries of all caches matching filter
+func getCacheList(filter cache.Filter) *cacheListResponse {
+	response := &cacheListResponse{
+		UsageList: make([]cache.Usage, 0),
+		EntryList: make([]cache.Entry, 0),
+	}
+
+	for _, c := range cache.List() {
+		response.UsageList = append(response.UsageList, c.Usage())
+		response.EntryList = append(response.EntryList, c.Entries(filter)...)
+	}
+
+	return response
+}
+
+// Evict everything cached for package version (GitLab archive, repacked archive, shasum
+// and metadata files) and repack archive again. GitLab is accessed with service token,
+// as admin API is not authorized by GitLab token. Frozen archive is never rebuilt.
+func rebuildCache(ctx context.Context, req *rebuildCacheRequest) (*rebuildCacheResponse, error) {
+	if req.Kind != client.KindComposer && req.Kind != client.KindNpm {
+		return nil, ErrCacheRebuildUnsupported
+	}
+
+	conn, err := client.NewConnectionFromServiceToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := conn.GetRepo(ctx, req.Kind, req.Package)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := ""
+	for _, tag := range repo.TagList {
+		if tag.Name == req.Version || tag.Reference == req.Version {
+			reference = tag.Reference
+			break
+		}
+	}
+
+	if reference == "" {
+		return nil, ErrCacheVersionNotFound
+	}
+
+	frozen, err := helpers.IsArchiveFrozen(req.Kind, req.Package, reference)
+	if err != nil {
+		return nil, err
+	}
+	if frozen {
+		return nil, ErrCacheRebuildFrozen
+	}
+
+	// metadata files (package.json/composer.json) are cached by GitLab project id
+	response := &rebuildCacheResponse{
+		Evicted: cache.Evict(cache.Filter{Package: req.Package, Version: reference}) +
+			cache.Evict(cache.Filter{Package: strconv.Itoa(repo.Project.ID), Version: reference}),
+		Reference: reference,
+	}
+
+	var archive []byte
+	switch req.Kind {
+	case client.KindComposer:
+		archive, err = registry.NewComposerRegistry(conn).GetPackageArchive(ctx, req.Package, reference)
+
+	case client.KindNpm:
+		archive, err = registry.NewNpmRegistry(conn).GetPackageArchive(ctx, req.Package, reference)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.Size = len(archive)
+	response.Shasum = fmt.Sprintf("%x", sha1.Sum(archive))
+	return response, nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/registry"
+	"gopkg.in/macaron.v1"
+	"net/http"
+	"strings"
+)
+
+// GoProxy - serve GOPROXY protocol requests, any other request is passed to next handler.
+// Module path contains slashes, so it can't be expressed as regular route.
+func GoProxy() macaron.Handler {
+	return func(ctx *macaron.Context, r *registry.GoRegistry) {
+		// supported requests:
+		//  * /{module}/@v/list
+		//  * /{module}/@v/{version}.info
+		//  * /{module}/@v/{version}.mod
+		//  * /{module}/@v/{version}.zip
+		//  * /{module}/@latest
+		requestPath := strings.TrimLeft(ctx.Req.URL.Path, "/")
+
+		// checksum database is never proxied, go command will use it directly
+		if strings.HasPrefix(requestPath, "sumdb/") {
+			writeNotFound(ctx, "Checksum database is not proxied")
+			return
+		}
+
+		if strings.HasSuffix(requestPath, "/@latest") {
+			modulePath, err := helpers.UnescapeModulePath(strings.TrimSuffix(requestPath, "/@latest"))
+			if err != nil {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+
+			info, err := r.GetLatest(ctx.Req.Context(), modulePath)
+			if err != nil {
+				writeGoErr(ctx, err)
+				return
+			}
+
+			ctx.JSON(200, info)
+			return
+		}
+
+		pos := strings.LastIndex(requestPath, "/@v/")
+		if pos < 0 {
+			ctx.Next()
+			return
+		}
+
+		modulePath, err := helpers.UnescapeModulePath(requestPath[:pos])
+		if err != nil {
+			writeNotFound(ctx, err.Error())
+			return
+		}
+
+		file := requestPath[pos+len("/@v/"):]
+		if file == "list" {
+			versionList, err := r.GetVersionList(ctx.Req.Context(), modulePath)
+			if err != nil {
+				writeGoErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain; charset=utf-8", []byte(strings.Join(versionList, "\n")))
+			return
+		}
+
+		extPos := strings.LastIndex(file, ".")
+		if extPos < 0 {
+			writeNotFound(ctx, "Unknown GOPROXY request")
+			return
+		}
+
+		version, err := helpers.UnescapeModulePath(file[:extPos])
+		if err != nil {
+			writeNotFound(ctx, err.Error())
+			return
+		}
+
+		switch file[extPos:] {
+		case ".info":
+			info, err := r.GetVersionInfo(ctx.Req.Context(), modulePath, version)
+			if err != nil {
+				writeGoErr(ctx, err)
+				return
+			}
+
+			ctx.JSON(200, info)
+
+		case ".mod":
+			modFile, err := r.GetModFile(ctx.Req.Context(), modulePath, version)
+			if err != nil {
+				writeGoErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain; charset=utf-8", modFile)
+
+		case ".zip":
+			archive, err := r.GetModuleArchive(ctx.Req.Context(), modulePath, version)
+			if err != nil {
+				writeGoErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/zip", archive)
+
+		default:
+			writeNotFound(ctx, "Unknown GOPROXY request")
+		}
+	}
+}
+
+//
+// Private API
+//
+
+// check request is GOPROXY protocol request, used for metrics
+func isGoProxyPath(path string) bool {
+	return strings.Contains(path, "/@v/") || strings.HasSuffix(path, "/@latest") || strings.HasPrefix(path, "/sumdb/")
+}
+
+// Respond with 404 Not Found when module or version is not served by registry,
+// so go command is able to fallback to next proxy in GOPROXY list
+func writeGoErr(ctx *macaron.Context, err error) {
+	if err == registry.ErrGoModuleNotFound || err == registry.ErrGoVersionNotFound {
+		writeNotFound(ctx, err.Error())
+		return
+	}
+
+	writeErr(ctx, err)
+}
+
+// Respond with 404 Not Found
+func writeNotFound(ctx *macaron.Context, message string) {
+	ctx.Resp.Header().Set("Content-Type", "text/plain")
+	ctx.Resp.WriteHeader(http.StatusNotFound)
+	ctx.Resp.Write([]byte(message))
+}
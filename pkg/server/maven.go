@@ -0,0 +1,89 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/registry"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"gopkg.in/macaron.v1"
+	"strings"
+)
+
+// serve maven repository layout requests, every file
+// is accompanied by .md5, .sha1 and .sha256 checksum files.
+func serveMaven(ctx *macaron.Context, r *registry.MavenRegistry) {
+	// supported requests:
+	//  * /maven/{group/path}/{artifactId}/maven-metadata.xml
+	//  * /maven/{group/path}/{artifactId}/{version}/{artifactId}-{version}.pom
+	//  * /maven/{group/path}/{artifactId}/{version}/{artifactId}-{version}-sources.jar
+	segmentList := strings.Split(strings.Trim(ctx.Params("*"), "/"), "/")
+	file := segmentList[len(segmentList)-1]
+
+	// checksum is requested, calculated from original file
+	checksum := ""
+	for _, ext := range []string{".md5", ".sha1", ".sha256"} {
+		if strings.HasSuffix(file, ext) {
+			checksum = ext
+			file = strings.TrimSuffix(file, ext)
+		}
+	}
+
+	var data []byte
+	var err error
+	var mime string
+
+	switch {
+	case file == "maven-metadata.xml" && len(segmentList) >= 3:
+		groupID := strings.Join(segmentList[:len(segmentList)-2], ".")
+		artifactID := segmentList[len(segmentList)-2]
+
+		mime = "text/xml"
+		data, err = r.GetMetadata(ctx.Req.Context(), groupID, artifactID)
+
+	case len(segmentList) >= 4:
+		groupID := strings.Join(segmentList[:len(segmentList)-3], ".")
+		artifactID := segmentList[len(segmentList)-3]
+		version := segmentList[len(segmentList)-2]
+		baseName := fmt.Sprintf("%s-%s", artifactID, version)
+
+		switch file {
+		case baseName + ".pom":
+			mime = "text/xml"
+			data, err = r.GetPom(ctx.Req.Context(), groupID, artifactID, version)
+
+		case baseName + "-sources.jar":
+			mime = "application/java-archive"
+			data, err = r.GetSourcesJar(ctx.Req.Context(), groupID, artifactID, version)
+
+		default:
+			err = registry.ErrMavenArtifactNotFound
+		}
+
+	default:
+		err = registry.ErrMavenArtifactNotFound
+	}
+
+	if err == registry.ErrMavenArtifactNotFound {
+		writeNotFound(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	switch checksum {
+	case ".md5":
+		writeOk(ctx, "text/plain", []byte(fmt.Sprintf("%x", md5.Sum(data))))
+
+	case ".sha1":
+		writeOk(ctx, "text/plain", []byte(fmt.Sprintf("%x", sha1.Sum(data))))
+
+	case ".sha256":
+		writeOk(ctx, "text/plain", []byte(fmt.Sprintf("%x", sha256.Sum256(data))))
+
+	default:
+		writeOk(ctx, mime, data)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/metrics"
+	"crypto/subtle"
+	"gopkg.in/macaron.v1"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics - collect request count and latency for each route
+func Metrics() macaron.Handler {
+	return func(ctx *macaron.Context) {
+		route := getRouteName(ctx.Req.URL.Path)
+		start := time.Now()
+
+		metrics.HTTPRequestsInFlight.Add(1, route)
+		defer metrics.HTTPRequestsInFlight.Add(-1, route)
+
+		ctx.Next()
+
+		metrics.HTTPRequestsTotal.Inc(route, strconv.Itoa(ctx.Resp.Status()))
+		metrics.HTTPRequestDuration.ObserveSince(start, route)
+	}
+}
+
+// MetricsAuthorizer - protect metrics endpoint with PAVLIK_METRICS_TOKEN,
+// endpoint is disabled when token is not configured.
+func MetricsAuthorizer() macaron.Handler {
+	return func(ctx *macaron.Context) {
+		metricsToken := os.Getenv("PAVLIK_METRICS_TOKEN")
+		if metricsToken == "" {
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		token := helpers.GetTokenFromRequest(ctx.Req.Request)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			writeDenied(ctx)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// serve all collected metrics in Prometheus text format
+func serveMetrics(ctx *macaron.Context) {
+	ctx.Resp.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	ctx.Resp.WriteHeader(http.StatusOK)
+	metrics.WriteAll(ctx.Resp)
+}
+
+// map request path to route name used as metric label,
+// keep in sync with routes defined in NewServer.
+func getRouteName(path string) string {
+	switch {
+	case path == "/":
+		return "index"
+
+	case path == "/metrics":
+		return "metrics"
+
+	case strings.HasPrefix(path, "/admin/"):
+		return "admin"
+
+	case path == "/favicon.ico":
+		return "favicon"
+
+	case path == "/healthz" || path == "/readyz":
+		return "health"
+
+	case strings.HasPrefix(path, "/stats/") || strings.HasPrefix(path, "/api/stats/"):
+		return "stats"
+
+	case strings.HasPrefix(path, "/downloads/"):
+		return "npm_downloads"
+
+	case path == "/packages" || strings.HasPrefix(path, "/packages/"):
+		return "browser"
+
+	case path == "/packages.json":
+		return "composer_packages"
+
+	case strings.HasPrefix(path, "/composer/"):
+		return "composer_zip"
+
+	case strings.HasPrefix(path, "/p2/"):
+		return "composer_uplink"
+
+	case path == "/-/v1/search":
+		return "npm_search"
+
+	case path == "/search.json":
+		return "composer_search"
+
+	case path == "/-/whoami" || strings.HasPrefix(path, "/-/user/"):
+		return "npm_user"
+
+	case strings.HasPrefix(path, "/-/"):
+		return "npm_api"
+
+	case strings.HasPrefix(path, "/npm/"):
+		return "npm_tgz"
+
+	case strings.HasPrefix(path, "/uplink/npm/"):
+		return "npm_uplink_tgz"
+
+	case isGoProxyPath(path):
+		return "goproxy"
+
+	case strings.HasPrefix(path, "/simple/"):
+		return "pypi_simple"
+
+	case strings.HasPrefix(path, "/pypi/"):
+		return "pypi_sdist"
+
+	case path == "/helm/index.yaml":
+		return "helm_index"
+
+	case strings.HasPrefix(path, "/helm/"):
+		return "helm_chart"
+
+	case strings.HasPrefix(path, "/maven/"):
+		return "maven"
+
+	case strings.HasPrefix(path, "/cargo/index/"):
+		return "cargo_index"
+
+	case strings.HasPrefix(path, "/cargo/dl/"):
+		return "cargo_crate"
+
+	case strings.HasPrefix(path, "/rubygems/gems/"):
+		return "rubygems_gem"
+
+	case strings.HasPrefix(path, "/rubygems/"):
+		return "rubygems_index"
+	}
+
+	return "npm_metadata"
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/client/gitlab"
+	"encoding/json"
+	"gopkg.in/macaron.v1"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type (
+	// npm login request body, other CouchDB user fields are ignored
+	npmLoginRequest struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+)
+
+var (
+	npmUserPrefix       = "org.couchdb.user:"
+	npmLoginRequestSize = int64(64 * 1024)
+)
+
+// serve `npm login`, password is GitLab personal access token
+// which is returned back as npm token after validation.
+func serveNpmLogin(ctx *macaron.Context) {
+	userID := ctx.Params("*")
+	if !strings.HasPrefix(userID, npmUserPrefix) {
+		writeNotFound(ctx, "User not found")
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Req.Request.Body, npmLoginRequestSize))
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	req := &npmLoginRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid login request"})
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = strings.TrimPrefix(userID, npmUserPrefix)
+	}
+	if req.Password == "" {
+		writeDenied(ctx)
+		return
+	}
+
+	conn, err := client.NewConnectionFromToken(ctx.Req.Context(), req.Password)
+	if err == gitlab.ErrGitLabInvalidToken {
+		writeDenied(ctx)
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	// token should belong to user logging in
+	user, err := conn.GetCurrentUser(ctx.Req.Context())
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+	if !strings.EqualFold(user.Username, req.Name) {
+		writeDenied(ctx)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, map[string]interface{}{
+		"ok":    true,
+		"id":    npmUserPrefix + user.Username,
+		"token": req.Password,
+	})
+}
+
+// serve `npm whoami`, username is resolved from GitLab token
+func serveNpmWhoami(ctx *macaron.Context, c *client.GitLabConnection) {
+	user, err := c.GetCurrentUser(ctx.Req.Context())
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, map[string]string{"username": user.Username})
+}
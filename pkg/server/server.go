@@ -1,24 +1,52 @@
 package server
 
 import (
+	"comrade-pavlik2/pkg/audit"
 	"comrade-pavlik2/pkg/client"
 	"comrade-pavlik2/pkg/client/gitlab"
+	"comrade-pavlik2/pkg/helpers"
 	"comrade-pavlik2/pkg/registry"
+	"comrade-pavlik2/pkg/stats"
 	"comrade-pavlik2/pkg/templates"
+	"comrade-pavlik2/pkg/tokens"
+	"comrade-pavlik2/pkg/uplink"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-macaron/bindata"
 	"gopkg.in/macaron.v1"
+	"gopkg.in/yaml.v2"
+	"log"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Handler
-func GitLabConnector() macaron.Handler {
-	return func(w http.ResponseWriter, r *http.Request, ctx *macaron.Context) {
-		// create and validate new connection to gitlab
-		connection, err := client.NewConnectionFromRequest(r)
+func GitLabConnector(store *tokens.Store) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		var connection *client.GitLabConnection
+		var err error
+
+		// create and validate new connection to gitlab,
+		// tokens issued by Pavlik are verified locally
+		token := helpers.GetTokenFromRequest(ctx.Req.Request)
+		if store != nil && tokens.IsIssuedToken(token) {
+			issued, verifyErr := store.Verify(token)
+			if verifyErr != nil {
+				writeDenied(ctx)
+				return
+			}
+
+			connection, err = client.NewConnectionFromIssuedToken(ctx.Req.Context(), issued)
+		} else {
+			connection, err = client.NewConnectionFromRequest(ctx.Req.Request)
+		}
+
 		if err != nil && err == gitlab.ErrGitLabInvalidToken {
 			writeDenied(ctx)
 			return
@@ -32,13 +60,35 @@ func GitLabConnector() macaron.Handler {
 		ctx.Map(connection)
 		ctx.Map(registry.NewComposerRegistry(connection))
 		ctx.Map(registry.NewNpmRegistry(connection))
+		ctx.Map(registry.NewGoRegistry(connection))
+		ctx.Map(registry.NewPypiRegistry(connection))
+		ctx.Map(registry.NewHelmRegistry(connection))
+		ctx.Map(registry.NewMavenRegistry(connection))
+		ctx.Map(registry.NewCargoRegistry(connection))
+		ctx.Map(registry.NewGemRegistry(connection))
+
+		ctx.Next()
+	}
+}
 
+// RequestTimeout - limit overall time spent on a single request,
+// request context is cancelled when deadline is reached or client is gone.
+func RequestTimeout(timeout time.Duration) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		reqCtx, cancel := context.WithTimeout(ctx.Req.Context(), timeout)
+		defer cancel()
+
+		ctx.Req.Request = ctx.Req.WithContext(reqCtx)
 		ctx.Next()
 	}
 }
 
 // NewServer - return new server instance
 func NewServer() *macaron.Macaron {
+	if err := client.CheckConfig(); err != nil {
+		log.Fatalf("ERROR: %s", err)
+	}
+
 	// bare server
 	m := macaron.New()
 	m.Use(macaron.Renderer(macaron.RenderOptions{
@@ -52,36 +102,40 @@ func NewServer() *macaron.Macaron {
 			},
 		),
 	}))
-	m.Use(GitLabConnector())
+	m.Use(Metrics())
+	m.Use(RequestTimeout(helpers.GetDurationFromEnv("PAVLIK_REQUEST_TIMEOUT", 5*time.Minute)))
 	m.SetAutoHead(true)
 
-	// display cache route
-	m.Get("/", func(ctx *macaron.Context, c *client.GitLabConnection) {
-		archives, expire := c.GetCachedList()
-
-		ctx.Data["Count"] = len(archives)
-		ctx.Data["KGBArchives"] = archives
-		ctx.Data["Expire"] = expire.Format("15:04:05")
-		ctx.HTML(200, "cached_list")
-	})
+	// optional public registries for packages not served by GitLab
+	npmUplink := uplink.NewNpmUplink(os.Getenv("PAVLIK_NPM_UPLINK"))
+	composerUplink := uplink.NewComposerUplink(os.Getenv("PAVLIK_COMPOSER_UPLINK"))
 
-	// clear cache route
-	m.Post("/", func(ctx *macaron.Context, c *client.GitLabConnection) {
-		if err := ctx.Req.ParseForm(); err != nil {
-			writeErr(ctx, err)
-			return
-		}
+	// optional store of tokens issued by Pavlik
+	tokenStore, err := tokens.NewStore(os.Getenv("PAVLIK_DATA_DIR"))
+	if err != nil {
+		log.Fatalf("ERROR: Failed to load token store: %s", err)
+	}
 
-		switch ctx.Req.PostForm.Get("action") {
-		case "clear_cache":
-			c.ClearCachedList()
+	// optional audit log of package downloads, stored next to issued tokens
+	auditDir := ""
+	if dataDir := os.Getenv("PAVLIK_DATA_DIR"); dataDir != "" {
+		auditDir = filepath.Join(dataDir, "audit")
+	}
 
-		case "update_cache":
-			c.EnqueueProjectCache()
-		}
+	auditMaxSize := int64(helpers.GetIntFromEnv("PAVLIK_AUDIT_MAX_SIZE", 100)) * 1024 * 1024
+	auditLog, err := audit.NewLogger(auditDir, auditMaxSize, helpers.GetIntFromEnv("PAVLIK_AUDIT_MAX_FILES", 10))
+	if err != nil {
+		log.Fatalf("ERROR: Failed to open audit log: %s", err)
+	}
 
-		ctx.Redirect("/", 302)
-	})
+	// optional download counters, saved every minute
+	statsStore, err := stats.NewStore(os.Getenv("PAVLIK_DATA_DIR"), helpers.GetIntFromEnv("PAVLIK_STATS_DAYS", 365))
+	if err != nil {
+		log.Fatalf("ERROR: Failed to load download stats: %s", err)
+	}
+	if statsStore != nil {
+		statsStore.AutoSave(time.Minute)
+	}
 
 	// disable favicon route
 	m.Get("/favicon.ico", func(ctx *macaron.Context) {
@@ -89,77 +143,535 @@ func NewServer() *macaron.Macaron {
 		ctx.Resp.Write([]byte(""))
 	})
 
-	//
-	// COMPOSER PACKAGE MANAGER (WARNING: route order matters)
-	// =======================================================
-	//
-	// real route, display all packages available
-	// for provided token.
-	//
-	m.Get("/packages.json", func(ctx *macaron.Context, r *registry.ComposerRegistry) {
-		// @see getPackageDownloadURL function
-		endpoint := getPackageDownloadURL(ctx, "/composer/%s/%s.zip")
-		pkg, err := r.GetPackageInfoList(endpoint)
-		if err != nil {
-			writeErr(ctx, err)
-			return
-		}
+	// metrics route, protected by own token
+	m.Get("/metrics", MetricsAuthorizer(), serveMetrics)
 
-		ctx.JSON(200, pkg)
+	// liveness probe, no token required
+	m.Get("/healthz", func(ctx *macaron.Context) {
+		ctx.JSON(200, client.GetLivenessReport())
 	})
 
-	//
-	// real route, serve zip archive
-	// for provided token.
-	//
-	m.Get("/composer/:uuid/:ref.zip", func(ctx *macaron.Context, r *registry.ComposerRegistry) {
-		response, err := r.GetPackageArchive(ctx.Params(":uuid"), ctx.Params(":ref"))
-		if err != nil {
-			writeErr(ctx, err)
+	// offline mode, imported bundles are served without GitLab
+	if client.IsOffline() {
+		return newOfflineServer(m, tokenStore)
+	}
+
+	// readiness probe, no token required
+	m.Get("/readyz", func(ctx *macaron.Context) {
+		report := client.GetReadinessReport(ctx.Req.Context())
+		if !report.IsOk() {
+			ctx.JSON(http.StatusServiceUnavailable, report)
 			return
 		}
 
-		writeOk(ctx, "application/zip", response)
+		ctx.JSON(200, report)
 	})
 
-	//
-	// NODE.JS PACKAGE MANAGER (WARNING: Route order matters)
-	// ======================================================
-	//
-	// npm search action.
-	// with proper .npmrc setup, this route should be never called
-	//
-	m.Get("/-/*", func(ctx *macaron.Context) {
-		writeErr(ctx, errors.New("Invalid .npmrc setup, @see https://github.com/Dalee/comrade-pavlik2"))
-	})
+	// issued tokens, audit log and cache management, protected by own token
+	m.Group("/admin", func() {
+		m.Get("/tokens", TokenStore(tokenStore), serveTokenPage)
+		m.Post("/tokens", TokenStore(tokenStore), serveTokenPageAction)
+		m.Get("/api/tokens", TokenStore(tokenStore), serveTokenList)
+		m.Post("/api/tokens", TokenStore(tokenStore), serveTokenIssue)
+		m.Delete("/api/tokens/:id", TokenStore(tokenStore), serveTokenRevoke)
+		m.Get("/audit", AuditLog(auditLog), serveAuditPage)
+		m.Get("/api/audit", AuditLog(auditLog), serveAuditList)
+		m.Get("/cache", serveCachePage)
+		m.Post("/cache", serveCachePageAction)
+		m.Get("/api/cache", serveCacheList)
+		m.Delete("/api/cache", serveCacheEvict)
+		m.Post("/api/cache/rebuild", serveCacheRebuild)
+		m.Get("/api/moved-tags", serveMovedTagList)
+	}, AdminAuthorizer())
 
-	//
-	// real route, download package archive
-	//
-	m.Get("/npm/:uuid/:ref.tgz", func(ctx *macaron.Context, r *registry.NpmRegistry) {
-		response, err := r.GetPackageArchive(ctx.Params(":uuid"), ctx.Params(":ref"))
-		if err != nil {
-			writeErr(ctx, err)
-			return
-		}
+	// npm login, GitLab token is provided as password
+	m.Put("/-/user/*", serveNpmLogin)
 
-		writeOk(ctx, "application/gzip", response)
-	})
+	// every route below require valid GitLab token
+	m.Group("", func() {
+		// display cache route
+		m.Get("/", func(ctx *macaron.Context, c *client.GitLabConnection) {
+			archives, expire := c.GetCachedList()
 
-	//
-	// real route, request package info
-	//
-	m.Get("/*", func(ctx *macaron.Context, r *registry.NpmRegistry) {
-		// @see getPackageDownloadURL function
-		endpoint := getPackageDownloadURL(ctx, "/npm/%s/%s.tgz")
-		pkg, err := r.GetPackageInfo(ctx.Params("*"), endpoint)
-		if err != nil {
-			writeErr(ctx, err)
-			return
-		}
+			ctx.Data["Count"] = len(archives)
+			ctx.Data["KGBArchives"] = archives
+			ctx.Data["Expire"] = expire.Format("15:04:05")
+			ctx.HTML(200, "cached_list")
+		})
 
-		ctx.JSON(200, pkg)
-	})
+		// clear cache route
+		m.Post("/", func(ctx *macaron.Context, c *client.GitLabConnection) {
+			if err := c.CheckWriteAccess(ctx.Req.Context()); err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			if err := ctx.Req.ParseForm(); err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			switch ctx.Req.PostForm.Get("action") {
+			case "clear_cache":
+				c.ClearCachedList()
+
+			case "update_cache":
+				c.EnqueueProjectCache()
+			}
+
+			ctx.Redirect("/", 302)
+		})
+
+		//
+		// PACKAGE BROWSER
+		// ===============
+		//
+		// real route, display all packages available
+		// for provided token, grouped by kind.
+		//
+		m.Get("/packages", servePackageList)
+
+		//
+		// real route, display package version: readme,
+		// dependencies and install snippet.
+		//
+		m.Get("/packages/:kind/:uuid", func(ctx *macaron.Context) {
+			ctx.Data["StatsEnabled"] = statsStore != nil
+		}, servePackagePage)
+
+		//
+		// DOWNLOAD STATS
+		// ==============
+		//
+		// real route, download stats of package
+		// available for provided token.
+		//
+		m.Get("/stats/:kind/:uuid", StatsStore(statsStore), serveStatsPage)
+		m.Get("/api/stats/:kind/:uuid", StatsStore(statsStore), serveStatsList)
+
+		//
+		// real route, npm downloads api compatible total,
+		// e.g. /downloads/point/last-week/@acme/auth
+		//
+		m.Get("/downloads/point/:period/*", StatsStore(statsStore), serveNpmDownloads)
+
+		//
+		// COMPOSER PACKAGE MANAGER (WARNING: route order matters)
+		// =======================================================
+		//
+		// real route, display all packages available
+		// for provided token.
+		//
+		m.Get("/packages.json", func(ctx *macaron.Context, r *registry.ComposerRegistry) {
+			// @see getPackageDownloadURL function
+			endpoint := getPackageDownloadURL(ctx, "/composer/%s/%s.zip")
+			pkg, err := r.GetPackageInfoList(ctx.Req.Context(), endpoint)
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			pkg.Search = "/search.json?q=%query%&type=%type%"
+
+			// composer v2 takes inline packages first, and fetches others via metadata-url
+			if composerUplink != nil {
+				pkg.MetadataURL = "/p2/%package%.json"
+			}
+
+			ctx.JSON(200, pkg)
+		})
+
+		//
+		// real route, search packages available
+		// for provided token.
+		//
+		m.Get("/search.json", func(ctx *macaron.Context, r *registry.ComposerRegistry) {
+			result, err := r.Search(ctx.Req.Context(), ctx.Query("q"), ctx.Query("type"))
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			ctx.JSON(200, result)
+		})
+
+		//
+		// uplink route, composer v2 metadata of public packages,
+		// dist urls are not rewritten.
+		//
+		m.Get("/p2/*", func(ctx *macaron.Context) {
+			if composerUplink == nil {
+				writeNotFound(ctx, uplink.ErrUplinkNotFound.Error())
+				return
+			}
+
+			name := strings.TrimSuffix(ctx.Params("*"), ".json")
+			if !checkUplinkName(ctx, client.KindComposer, strings.TrimSuffix(name, "~dev")) {
+				return
+			}
+
+			response, err := composerUplink.GetPackageMetadata(ctx.Req.Context(), name)
+			if err == uplink.ErrUplinkNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/json", response)
+		})
+
+		//
+		// real route, serve zip archive
+		// for provided token.
+		//
+		m.Get("/composer/:uuid/:ref.zip", func(ctx *macaron.Context, r *registry.ComposerRegistry) {
+			response, err := r.GetPackageArchive(ctx.Req.Context(), ctx.Params(":uuid"), ctx.Params(":ref"))
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/zip", response)
+		})
+
+		//
+		// NODE.JS PACKAGE MANAGER (WARNING: Route order matters)
+		// ======================================================
+		//
+		// real route, search packages available
+		// for provided token.
+		//
+		m.Get("/-/v1/search", func(ctx *macaron.Context, r *registry.NpmRegistry) {
+			size := ctx.QueryInt("size")
+			if size <= 0 || size > 250 {
+				size = 20
+			}
+
+			from := ctx.QueryInt("from")
+			if from < 0 {
+				from = 0
+			}
+
+			result, err := r.Search(ctx.Req.Context(), ctx.Query("text"), from, size)
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			ctx.JSON(200, result)
+		})
+
+		//
+		// real route, username of provided token
+		//
+		m.Get("/-/whoami", serveNpmWhoami)
+
+		//
+		// other npm api actions.
+		// with proper .npmrc setup, this route should be never called
+		//
+		m.Get("/-/*", func(ctx *macaron.Context) {
+			writeErr(ctx, errors.New("Invalid .npmrc setup, @see https://github.com/Dalee/comrade-pavlik2"))
+		})
+
+		//
+		// real route, download package archive
+		//
+		m.Get("/npm/:uuid/:ref.tgz", func(ctx *macaron.Context, r *registry.NpmRegistry) {
+			response, err := r.GetPackageArchive(ctx.Req.Context(), ctx.Params(":uuid"), ctx.Params(":ref"))
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/gzip", response)
+		})
+
+		//
+		// uplink route, download public package archive
+		//
+		m.Get("/uplink/npm/*", func(ctx *macaron.Context) {
+			if npmUplink == nil {
+				writeNotFound(ctx, uplink.ErrUplinkNotFound.Error())
+				return
+			}
+
+			path := ctx.Params("*")
+			if !strings.HasPrefix(path, "@") && !checkUplinkName(ctx, client.KindNpm, strings.SplitN(path, "/-/", 2)[0]) {
+				return
+			}
+
+			response, err := npmUplink.GetTarball(ctx.Req.Context(), path)
+			if err == uplink.ErrUplinkNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/gzip", response)
+		})
+
+		//
+		// PYTHON PACKAGE INDEX (PEP 503/691)
+		// ==================================
+		//
+		// real route, display all projects available
+		// for provided token.
+		//
+		m.Get("/simple/", func(ctx *macaron.Context, r *registry.PypiRegistry) {
+			index, err := r.GetIndex(ctx.Req.Context())
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			if isPypiJSONRequested(ctx) {
+				writePypiJSON(ctx, index)
+				return
+			}
+
+			ctx.Data["Index"] = index
+			ctx.HTML(200, "pypi_index")
+		})
+
+		//
+		// real route, display all source distributions of project
+		//
+		m.Get("/simple/:project/", func(ctx *macaron.Context, r *registry.PypiRegistry) {
+			// @see getPackageDownloadURL function
+			endpoint := getPackageDownloadURL(ctx, "/pypi/%s/%s/%s")
+			project, err := r.GetProject(ctx.Req.Context(), ctx.Params(":project"), endpoint)
+			if err == registry.ErrPypiProjectNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			if isPypiJSONRequested(ctx) {
+				writePypiJSON(ctx, project)
+				return
+			}
+
+			ctx.Data["Project"] = project
+			ctx.HTML(200, "pypi_project")
+		})
+
+		//
+		// real route, download source distribution,
+		// file name is required by pip, but not used.
+		//
+		m.Get("/pypi/:uuid/:ref/:file", func(ctx *macaron.Context, r *registry.PypiRegistry) {
+			response, err := r.GetSdistArchive(ctx.Req.Context(), ctx.Params(":uuid"), ctx.Params(":ref"))
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/gzip", response)
+		})
+
+		//
+		// HELM CHART REPOSITORY
+		// =====================
+		//
+		// real route, display all charts available
+		// for provided token.
+		//
+		m.Get("/helm/index.yaml", func(ctx *macaron.Context, r *registry.HelmRegistry) {
+			// @see getPackageDownloadURL function
+			endpoint := getPackageDownloadURL(ctx, "/helm/%s/%s/%s")
+			index, err := r.GetIndex(ctx.Req.Context(), endpoint)
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			response, err := yaml.Marshal(index)
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/x-yaml", response)
+		})
+
+		//
+		// real route, download packaged chart,
+		// file name is required by helm, but not used.
+		//
+		m.Get("/helm/:uuid/:ref/:file", func(ctx *macaron.Context, r *registry.HelmRegistry) {
+			response, err := r.GetChartArchive(ctx.Req.Context(), ctx.Params(":uuid"), ctx.Params(":ref"))
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/gzip", response)
+		})
+
+		//
+		// MAVEN REPOSITORY
+		// ================
+		//
+		// real route, serve metadata, pom and sources jar
+		// in maven repository layout, @see serveMaven function
+		//
+		m.Get("/maven/*", serveMaven)
+
+		//
+		// CARGO SPARSE INDEX
+		// ==================
+		//
+		// real route, serve index config.json and index files,
+		// index file path is derived from crate name.
+		//
+		m.Get("/cargo/index/*", func(ctx *macaron.Context, r *registry.CargoRegistry) {
+			indexPath := ctx.Params("*")
+			if indexPath == "config.json" {
+				// @see getPackageDownloadURL function
+				ctx.JSON(200, &registry.CargoConfig{
+					DL:           getPackageDownloadURL(ctx, "/cargo/dl"),
+					AuthRequired: true,
+				})
+				return
+			}
+
+			name := path.Base(indexPath)
+			if helpers.GetCrateIndexPath(name) != strings.ToLower(indexPath) {
+				writeNotFound(ctx, registry.ErrCargoCrateNotFound.Error())
+				return
+			}
+
+			response, err := r.GetIndexFile(ctx.Req.Context(), name)
+			if err == registry.ErrCargoCrateNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain", response)
+		})
+
+		//
+		// real route, download packaged crate,
+		// url is formed by cargo from "dl" field of config.json
+		//
+		m.Get("/cargo/dl/:crate/:version/download", func(ctx *macaron.Context, r *registry.CargoRegistry) {
+			response, err := r.GetCrateArchive(ctx.Req.Context(), ctx.Params(":crate"), ctx.Params(":version"))
+			if err == registry.ErrCargoCrateNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/gzip", response)
+		})
+
+		//
+		// RUBYGEMS COMPACT INDEX
+		// ======================
+		//
+		// real route, display names of all gems available
+		// for provided token.
+		//
+		m.Get("/rubygems/names", func(ctx *macaron.Context, r *registry.GemRegistry) {
+			response, err := r.GetNames(ctx.Req.Context())
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain; charset=utf-8", response)
+		})
+
+		//
+		// real route, display versions of all gems available
+		// for provided token.
+		//
+		m.Get("/rubygems/versions", func(ctx *macaron.Context, r *registry.GemRegistry) {
+			response, err := r.GetVersions(ctx.Req.Context())
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain; charset=utf-8", response)
+		})
+
+		//
+		// real route, display dependencies and checksums of gem versions
+		//
+		m.Get("/rubygems/info/:gem", func(ctx *macaron.Context, r *registry.GemRegistry) {
+			response, err := r.GetInfo(ctx.Req.Context(), ctx.Params(":gem"))
+			if err == registry.ErrGemNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "text/plain; charset=utf-8", response)
+		})
+
+		//
+		// real route, download gem
+		//
+		m.Get("/rubygems/gems/:file", func(ctx *macaron.Context, r *registry.GemRegistry) {
+			response, err := r.GetGemArchive(ctx.Req.Context(), ctx.Params(":file"))
+			if err == registry.ErrGemNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			writeOk(ctx, "application/octet-stream", response)
+		})
+
+		//
+		// real route, request package info,
+		// GOPROXY requests are intercepted by GoProxy handler,
+		// packages not served by GitLab are requested from uplink.
+		//
+		m.Get("/*", GoProxy(), func(ctx *macaron.Context, r *registry.NpmRegistry) {
+			// @see getPackageDownloadURL function
+			endpoint := getPackageDownloadURL(ctx, "/npm/%s/%s.tgz")
+			pkg, err := r.GetPackageInfo(ctx.Req.Context(), ctx.Params("*"), endpoint)
+			if err == registry.ErrNpmPackageNotFound && npmUplink != nil {
+				serveNpmUplink(ctx, npmUplink)
+				return
+			}
+			if err == registry.ErrNpmPackageNotFound {
+				writeNotFound(ctx, err.Error())
+				return
+			}
+			if err != nil {
+				writeErr(ctx, err)
+				return
+			}
+
+			ctx.JSON(200, pkg)
+		})
+	}, GitLabConnector(tokenStore), Audit(auditLog), DownloadStats(statsStore))
 
 	return m
 }
@@ -176,15 +688,86 @@ func writeOk(ctx *macaron.Context, mime string, data []byte) {
 	ctx.Resp.Write(data)
 }
 
-// Respond with 500 Internal Server Error when any error is detected
+// Respond with 500 Internal Server Error when any error is detected,
+// with 504 Gateway Timeout when request deadline is reached,
+// or with 403/404 when package access is denied by access rule
 func writeErr(ctx *macaron.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case err == context.DeadlineExceeded || ctx.Req.Context().Err() == context.DeadlineExceeded:
+		status = http.StatusGatewayTimeout
+
+	case err == client.ErrPackageAccessDenied || err == client.ErrReadOnlyToken:
+		status = http.StatusForbidden
+
+	case err == client.ErrPackageNotFound:
+		status = http.StatusNotFound
+	}
+
 	data := []byte(err.Error())
 	ctx.Resp.Header().Set("Content-Type", "text/plain")
 	ctx.Resp.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
-	ctx.Resp.WriteHeader(http.StatusInternalServerError)
+	ctx.Resp.WriteHeader(status)
 	ctx.Resp.Write(data)
 }
 
+// Respond with 404 Not Found when package name is defined in repo.json, private package
+// missing for the token (hidden, denied or without tags) should never be replaced by public one.
+func checkUplinkName(ctx *macaron.Context, kind, name string) bool {
+	private, err := client.IsPrivatePackageName(ctx.Req.Context(), kind, name)
+	if err != nil {
+		writeErr(ctx, err)
+		return false
+	}
+
+	if private {
+		log.Printf("==> Notice: Private package %s is not requested from uplink", name)
+		writeErr(ctx, client.ErrPackageNotFound)
+		return false
+	}
+
+	return true
+}
+
+// Respond with public package document, tarballs are downloaded through Pavlik
+func serveNpmUplink(ctx *macaron.Context, u *uplink.NpmUplink) {
+	// scoped packages are refused by uplink, no need to resolve private names
+	name := ctx.Params("*")
+	if !strings.HasPrefix(name, "@") && !checkUplinkName(ctx, client.KindNpm, name) {
+		return
+	}
+
+	// @see getPackageDownloadURL function
+	endpoint := getPackageDownloadURL(ctx, "/uplink/npm/%s")
+	response, err := u.GetPackage(ctx.Req.Context(), name, endpoint)
+	if err == uplink.ErrUplinkNotFound {
+		writeNotFound(ctx, err.Error())
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	writeOk(ctx, "application/json", response)
+}
+
+// PEP 691 JSON response is requested via Accept header
+func isPypiJSONRequested(ctx *macaron.Context) bool {
+	return strings.Contains(ctx.Req.Header.Get("Accept"), "application/vnd.pypi.simple.v1+json")
+}
+
+// Respond with PEP 691 JSON
+func writePypiJSON(ctx *macaron.Context, data interface{}) {
+	response, err := json.Marshal(data)
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	writeOk(ctx, "application/vnd.pypi.simple.v1+json", response)
+}
+
 // Respond with 401 Unauthorized each time when request doesn't contain any kind of authorization
 func writeDenied(ctx *macaron.Context) {
 	data := []byte("Unauthorized")
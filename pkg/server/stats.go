@@ -0,0 +1,249 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"comrade-pavlik2/pkg/registry"
+	"comrade-pavlik2/pkg/stats"
+	"gopkg.in/macaron.v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// download stats of package, versions are resolved from refs
+	packageStats struct {
+		Kind      string          `json:"kind"`
+		Package   string          `json:"package"`
+		Name      string          `json:"name"`
+		From      string          `json:"from"`
+		To        string          `json:"to"`
+		Downloads int             `json:"downloads"`
+		Versions  map[string]int  `json:"versions"`
+		Clients   map[string]int  `json:"clients"`
+		Days      []stats.Counter `json:"days"`
+	}
+
+	// npm downloads api point response
+	npmDownloadsPoint struct {
+		Downloads int    `json:"downloads"`
+		Start     string `json:"start"`
+		End       string `json:"end"`
+		Package   string `json:"package"`
+	}
+)
+
+var (
+	// routes counted as package download, @see getRouteName function
+	downloadRouteList = []string{"composer_zip", "npm_tgz", "goproxy", "pypi_sdist", "helm_chart", "maven", "cargo_crate", "rubygems_gem"}
+
+	// maven checksums are requested along with every file, so they're not downloads
+	mavenChecksumExtList = []string{".md5", ".sha1", ".sha256"}
+
+	// npm downloads api periods, in days
+	npmDownloadsPeriodList = map[string]int{
+		"last-day":   1,
+		"last-week":  7,
+		"last-month": 30,
+	}
+)
+
+// DownloadStats - count successful package downloads, every kind is counted
+// by repo.json uuid and ref of the archive, which registry recorded as served.
+func DownloadStats(store *stats.Store) macaron.Handler {
+	return func(ctx *macaron.Context, c *client.GitLabConnection) {
+		if store == nil {
+			return
+		}
+
+		ctx.Next()
+
+		if ctx.Resp.Status() != http.StatusOK {
+			return
+		}
+
+		kind, uuid, ref, ok := getDownloadPackage(ctx.Req.URL.Path, c.GetDownload())
+		if !ok {
+			return
+		}
+
+		store.Add(time.Now(), kind, uuid, ref, ctx.Req.UserAgent())
+	}
+}
+
+// StatsStore - provide download stats,
+// endpoints are disabled when PAVLIK_DATA_DIR is not configured.
+func StatsStore(store *stats.Store) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		if store == nil {
+			ctx.Resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ctx.Map(store)
+		ctx.Next()
+	}
+}
+
+//
+// Private API
+//
+
+// download stats of package, json
+func serveStatsList(ctx *macaron.Context, c *client.GitLabConnection, store *stats.Store) {
+	result, err := getPackageStats(ctx, c, store)
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, result)
+}
+
+// download stats of package, Web UI
+func serveStatsPage(ctx *macaron.Context, c *client.GitLabConnection, store *stats.Store) {
+	result, err := getPackageStats(ctx, c, store)
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	ctx.Data["Stats"] = result
+	ctx.HTML(200, "package_stats")
+}
+
+// npm compatible downloads api, only point (total) is supported,
+// period is one of last-day, last-week, last-month or start:end range
+func serveNpmDownloads(ctx *macaron.Context, r *registry.NpmRegistry, store *stats.Store) {
+	from, to, ok := getDownloadsPeriod(ctx.Params(":period"), time.Now())
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, map[string]string{"error": "invalid period"})
+		return
+	}
+
+	name := ctx.Params("*")
+	uuid, err := r.GetPackageUUID(ctx.Req.Context(), name)
+	if err == registry.ErrNpmPackageNotFound {
+		ctx.JSON(http.StatusNotFound, map[string]string{"error": "package " + name + " not found"})
+		return
+	}
+	if err != nil {
+		writeErr(ctx, err)
+		return
+	}
+
+	result := &npmDownloadsPoint{
+		Start:   from.Format(stats.DayFormat),
+		End:     to.Format(stats.DayFormat),
+		Package: name,
+	}
+
+	for _, counter := range store.Query(client.KindNpm, uuid, from, to) {
+		result.Downloads += counter.Downloads
+	}
+
+	ctx.JSON(200, result)
+}
+
+// Query stats of package for last "days" days (30 by default), refs are
+// resolved to versions via tags, so GitLab repository should be visible for token.
+func getPackageStats(ctx *macaron.Context, c *client.GitLabConnection, store *stats.Store) (*packageStats, error) {
+	kind := ctx.Params(":kind")
+	uuid := ctx.Params(":uuid")
+
+	repo, err := c.GetRepo(ctx.Req.Context(), kind, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	days := ctx.QueryInt("days")
+	if days <= 0 || days > 365 {
+		days = 30
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, 1-days)
+
+	result := &packageStats{
+		Kind:     kind,
+		Package:  uuid,
+		Name:     repo.Project.Name,
+		From:     from.Format(stats.DayFormat),
+		To:       to.Format(stats.DayFormat),
+		Versions: make(map[string]int),
+		Clients:  make(map[string]int),
+		Days:     store.Query(kind, uuid, from, to),
+	}
+
+	repo.MetadataLock.RLock()
+	if name, err := repo.Metadata.GetString("name"); err == nil && name != "" {
+		result.Name = name
+	}
+	repo.MetadataLock.RUnlock()
+
+	// archives are downloaded by commit, tag could be moved since
+	versionList := make(map[string]string)
+	for _, tag := range repo.TagList {
+		versionList[tag.Reference] = tag.Name
+	}
+
+	for i, counter := range result.Days {
+		if version, ok := versionList[counter.Version]; ok {
+			result.Days[i].Version = version
+		}
+
+		result.Downloads += counter.Downloads
+		result.Versions[result.Days[i].Version] += counter.Downloads
+		result.Clients[counter.Client] += counter.Downloads
+	}
+
+	return result, nil
+}
+
+// parse npm downloads api period, both days are included
+func getDownloadsPeriod(period string, now time.Time) (time.Time, time.Time, bool) {
+	to := now.UTC()
+	if days, ok := npmDownloadsPeriodList[period]; ok {
+		return to.AddDate(0, 0, 1-days), to, true
+	}
+
+	dayList := strings.Split(period, ":")
+	if len(dayList) != 2 {
+		return to, to, false
+	}
+
+	from, fromErr := time.Parse(stats.DayFormat, dayList[0])
+	to, toErr := time.Parse(stats.DayFormat, dayList[1])
+	if fromErr != nil || toErr != nil || to.Before(from) {
+		return to, to, false
+	}
+
+	return from, to, true
+}
+
+// Kind, uuid and ref of downloaded archive, when request is counted as download.
+// Archive is recorded by registry, metadata requests (e.g. go .info/.mod) never record it.
+func getDownloadPackage(requestPath string, d *client.Download) (string, string, string, bool) {
+	if d == nil || !isDownloadRoute(getRouteName(requestPath)) {
+		return "", "", "", false
+	}
+
+	for _, ext := range mavenChecksumExtList {
+		if d.Kind == client.KindMaven && strings.HasSuffix(requestPath, ext) {
+			return "", "", "", false
+		}
+	}
+
+	return d.Kind, d.UUID, d.Reference, true
+}
+
+// route is counted as package download
+func isDownloadRoute(routeName string) bool {
+	for _, name := range downloadRouteList {
+		if name == routeName {
+			return true
+		}
+	}
+
+	return false
+}
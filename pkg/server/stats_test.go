@@ -0,0 +1,84 @@
+package server
+
+import (
+	"comrade-pavlik2/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetDownloadPackage(t *testing.T) {
+	testList := []struct {
+		path     string
+		download *client.Download
+		counted  bool
+	}{
+		{
+			path:     "/composer/uuid-auth/48bfe31a.zip",
+			download: &client.Download{Kind: client.KindComposer, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/npm/uuid-auth/48bfe31a.tgz",
+			download: &client.Download{Kind: client.KindNpm, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/gitlab.local/acme/auth/@v/v1.2.0.zip",
+			download: &client.Download{Kind: client.KindGo, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:    "/gitlab.local/acme/auth/@v/v1.2.0.info",
+			counted: false,
+		},
+		{
+			path:     "/pypi/uuid-auth/48bfe31a/acme-auth-1.2.0.tar.gz",
+			download: &client.Download{Kind: client.KindPypi, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/helm/uuid-auth/48bfe31a/auth-1.2.0.tgz",
+			download: &client.Download{Kind: client.KindHelm, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/maven/com/acme/auth/1.2.0/auth-1.2.0-sources.jar",
+			download: &client.Download{Kind: client.KindMaven, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/maven/com/acme/auth/1.2.0/auth-1.2.0-sources.jar.sha1",
+			download: &client.Download{Kind: client.KindMaven, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  false,
+		},
+		{
+			path:    "/maven/com/acme/auth/1.2.0/auth-1.2.0.pom",
+			counted: false,
+		},
+		{
+			path:     "/cargo/dl/acme-auth/1.2.0/download",
+			download: &client.Download{Kind: client.KindCargo, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/rubygems/gems/acme-auth-1.2.0.gem",
+			download: &client.Download{Kind: client.KindGem, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  true,
+		},
+		{
+			path:     "/-/v1/search",
+			download: &client.Download{Kind: client.KindNpm, UUID: "uuid-auth", Reference: "48bfe31a"},
+			counted:  false,
+		},
+	}
+
+	for _, test := range testList {
+		kind, uuid, ref, ok := getDownloadPackage(test.path, test.download)
+		assert.Equal(t, test.counted, ok, test.path)
+		if test.counted {
+			assert.Equal(t, test.download.Kind, kind, test.path)
+			assert.Equal(t, "uuid-auth", uuid, test.path)
+			assert.Equal(t, "48bfe31a", ref, test.path)
+		}
+	}
+}
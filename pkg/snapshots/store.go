@@ -0,0 +1,235 @@
+package snapshots
+
+// Immutable artifacts of package versions: archive is frozen the first time
+// it is built, and is never rebuilt or overwritten later.
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Info - metadata of frozen artifact, stored next to artifact
+	Info struct {
+		Key     string    `json:"key"`
+		Size    int       `json:"size"`
+		SHA1    string    `json:"sha1"`
+		SHA256  string    `json:"sha256"`
+		Created time.Time `json:"created"`
+	}
+
+	// Store - artifacts in directory, one subdirectory per artifact type
+	Store struct {
+		dir string
+	}
+)
+
+var (
+	// ErrSnapshotNotFound - artifact is not frozen yet
+	ErrSnapshotNotFound = errors.New("Snapshot not found")
+
+	// ErrSnapshotExists - artifact is already frozen, it is never overwritten
+	ErrSnapshotExists = errors.New("Snapshot already exists")
+
+	// ErrSnapshotCorrupted - artifact doesn't match checksum recorded when it was frozen
+	ErrSnapshotCorrupted = errors.New("Snapshot corrupted")
+
+	// ErrInvalidKey - key is not "type_package_version"
+	ErrInvalidKey = errors.New("Invalid snapshot key")
+)
+
+// NewStore - store in directory, nil when directory is not provided.
+// Directory is created on first write.
+func NewStore(dir string) *Store {
+	if dir == "" {
+		return nil
+	}
+
+	return &Store{dir: dir}
+}
+
+// Check - make sure directory exists and writable
+func (s *Store) Check() error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.dir, "check_")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Get - frozen artifact and its metadata, checksum is verified on every read
+func (s *Store) Get(key string) ([]byte, *Info, error) {
+	path, err := s.getPath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := readInfo(path + ".json")
+	if os.IsNotExist(err) {
+		return nil, nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(data) != info.Size || fmt.Sprintf("%x", sha256.Sum256(data)) != info.SHA256 {
+		return nil, nil, ErrSnapshotCorrupted
+	}
+
+	return data, info, nil
+}
+
+// Put - freeze artifact, ErrSnapshotExists is returned when artifact is already
+// frozen (by another request or another instance sharing directory).
+func (s *Store) Put(key string, data []byte) (*Info, error) {
+	path, err := s.getPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Key:     key,
+		Size:    len(data),
+		SHA1:    fmt.Sprintf("%x", sha1.Sum(data)),
+		SHA256:  fmt.Sprintf("%x", sha256.Sum256(data)),
+		Created: time.Now().UTC(),
+	}
+
+	infoData, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// artifact is written to temporary file and linked, link fails when artifact exists,
+	// so first writer always wins and artifact is never left half-written
+	tmpPath := fmt.Sprintf("%s.%d.tmp", path, time.Now().UnixNano())
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := ioutil.WriteFile(tmpPath+".json", infoData, 0600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath + ".json")
+
+	if err := os.Link(tmpPath, path); err != nil {
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if _, err := os.Stat(path + ".json"); err == nil {
+			return nil, ErrSnapshotExists
+		}
+
+		// previous write is interrupted before metadata is stored, artifact is not frozen
+		if err := os.Rename(tmpPath, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(tmpPath+".json", path+".json"); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// List - keys of artifacts of given type frozen for package, e.g. all frozen
+// versions of package, keys are sorted.
+func (s *Store) List(keyType, pkg string) ([]string, error) {
+	keyList := make([]string, 0)
+
+	fileList, err := ioutil.ReadDir(filepath.Join(s.dir, url.PathEscape(keyType)))
+	if os.IsNotExist(err) {
+		return keyList, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fileList {
+		name := f.Name()
+		if f.IsDir() || strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+
+		rest, err := url.PathUnescape(name)
+		if err != nil || !strings.HasPrefix(rest, pkg+"_") {
+			continue
+		}
+
+		// artifact without metadata is not frozen yet
+		if _, err := os.Stat(filepath.Join(s.dir, url.PathEscape(keyType), name+".json")); err != nil {
+			continue
+		}
+
+		keyList = append(keyList, keyType+"_"+rest)
+	}
+
+	sort.Strings(keyList)
+	return keyList, nil
+}
+
+//
+// Private API
+//
+
+// path of artifact, metadata path is artifact path with ".json" suffix
+func (s *Store) getPath(key string) (string, error) {
+	parts := strings.SplitN(key, "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", ErrInvalidKey
+	}
+
+	// slashes in go module paths are escaped too
+	name := url.PathEscape(parts[1])
+	if name == "." || name == ".." || strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".tmp") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.dir, url.PathEscape(parts[0]), name), nil
+}
+
+// read artifact metadata
+func readInfo(path string) (*Info, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
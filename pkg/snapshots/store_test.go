@@ -0,0 +1,134 @@
+package snapshots
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewStore_Disabled(t *testing.T) {
+	assert.Nil(t, NewStore(""))
+}
+
+func TestStore_Put(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewStore(dir)
+	assert.Nil(t, s.Check())
+
+	_, _, err = s.Get("gozip_github.com/acme/mod_v1.0.0")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+
+	info, err := s.Put("gozip_github.com/acme/mod_v1.0.0", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, info.Size)
+	assert.Equal(t, "e0996a37c13d44c3b06074939d43fa3759bd32c1", info.SHA1)
+
+	// frozen artifact is never overwritten
+	_, err = s.Put("gozip_github.com/acme/mod_v1.0.0", []byte("second"))
+	assert.Equal(t, ErrSnapshotExists, err)
+
+	data, info, err := s.Get("gozip_github.com/acme/mod_v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first", string(data))
+	assert.Equal(t, "gozip_github.com/acme/mod_v1.0.0", info.Key)
+
+	// slashes are escaped, artifact is stored in type directory
+	_, err = os.Stat(filepath.Join(dir, "gozip", "github.com%2Facme%2Fmod_v1.0.0"))
+	assert.Nil(t, err)
+}
+
+func TestStore_Get_Corrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewStore(dir)
+	if _, err := s.Put("archive_48bfe31a_abc", []byte("tgz")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "archive", "48bfe31a_abc"), []byte("tgx"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = s.Get("archive_48bfe31a_abc")
+	assert.Equal(t, ErrSnapshotCorrupted, err)
+}
+
+func TestStore_Put_Interrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// artifact without metadata is left by interrupted write
+	if err := os.MkdirAll(filepath.Join(dir, "chart"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "chart", "acme-api_1.2.0"), []byte("half"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore(dir)
+	_, _, err = s.Get("chart_acme-api_1.2.0")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+
+	_, err = s.Put("chart_acme-api_1.2.0", []byte("chart"))
+	assert.Nil(t, err)
+
+	data, _, err := s.Get("chart_acme-api_1.2.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "chart", string(data))
+}
+
+func TestStore_InvalidKey(t *testing.T) {
+	s := NewStore(os.TempDir())
+
+	for _, key := range []string{"archive", "archive_", "_abc", "archive_..", "archive_abc.json"} {
+		_, err := s.Put(key, []byte("data"))
+		assert.Equal(t, ErrInvalidKey, err, key)
+	}
+}
+
+func TestStore_List(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pavlik-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewStore(dir)
+
+	keyList, err := s.List("npm-version", "48bfe31a")
+	assert.Nil(t, err)
+	assert.Empty(t, keyList)
+
+	for _, key := range []string{"npm-version_48bfe31a_def", "npm-version_48bfe31a_abc", "npm-version_6104942a_abc", "npm-archive_48bfe31a_abc"} {
+		if _, err := s.Put(key, []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// artifact without metadata is left by interrupted write
+	if err := ioutil.WriteFile(filepath.Join(dir, "npm-version", "48bfe31a_fed"), []byte("half"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyList, err = s.List("npm-version", "48bfe31a")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"npm-version_48bfe31a_abc", "npm-version_48bfe31a_def"}, keyList)
+}
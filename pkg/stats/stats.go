@@ -0,0 +1,237 @@
+package stats
+
+// Download counters per package version, client and day
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Counter - downloads of package version by client during day
+	Counter struct {
+		Day       string `json:"day"` // UTC, 2006-01-02
+		Kind      string `json:"kind"`
+		Package   string `json:"package"`
+		Version   string `json:"version"`
+		Client    string `json:"client"`
+		Downloads int    `json:"downloads"`
+	}
+
+	// Store - counters persisted as json file, counters are kept
+	// in memory and saved periodically
+	Store struct {
+		path      string
+		retention int // days
+		lock      *sync.Mutex
+		counters  map[counterKey]int
+		dirty     bool
+	}
+
+	// counter without value
+	counterKey struct {
+		Day     string
+		Kind    string
+		Package string
+		Version string
+		Client  string
+	}
+)
+
+var (
+	// DayFormat - format of counter day
+	DayFormat = "2006-01-02"
+
+	storeFile = "stats.json"
+)
+
+// NewStore - load counters from data directory, counters older than retention
+// days are dropped on save, store is disabled (nil) when directory is not provided.
+func NewStore(dataDir string, retention int) (*Store, error) {
+	if dataDir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:      filepath.Join(dataDir, storeFile),
+		retention: retention,
+		lock:      new(sync.Mutex),
+		counters:  make(map[counterKey]int),
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Counter, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, c := range list {
+		s.counters[getCounterKey(&c)] += c.Downloads
+	}
+
+	return s, nil
+}
+
+// Add - count single download of package version
+func (s *Store) Add(t time.Time, kind, pkg, version, userAgent string) {
+	key := counterKey{
+		Day:     t.UTC().Format(DayFormat),
+		Kind:    kind,
+		Package: pkg,
+		Version: version,
+		Client:  GetClientName(userAgent),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.counters[key]++
+	s.dirty = true
+}
+
+// Query - get counters of package for days in range (inclusive), ordered by day
+func (s *Store) Query(kind, pkg string, from, to time.Time) []Counter {
+	fromDay := from.UTC().Format(DayFormat)
+	toDay := to.UTC().Format(DayFormat)
+
+	s.lock.Lock()
+	list := make([]Counter, 0)
+	for key, downloads := range s.counters {
+		if key.Kind != kind || key.Package != pkg || key.Day < fromDay || key.Day > toDay {
+			continue
+		}
+
+		list = append(list, getCounter(key, downloads))
+	}
+	s.lock.Unlock()
+
+	sortCounterList(list)
+	return list
+}
+
+// Save - write counters to disk if anything is changed since last save
+func (s *Store) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	oldestDay := time.Now().UTC().AddDate(0, 0, -s.retention).Format(DayFormat)
+	list := make([]Counter, 0, len(s.counters))
+	for key, downloads := range s.counters {
+		if key.Day < oldestDay {
+			delete(s.counters, key)
+			continue
+		}
+
+		list = append(list, getCounter(key, downloads))
+	}
+
+	sortCounterList(list)
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	// store is never left half-written
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// AutoSave - save counters in background, counters collected
+// since last save are lost if process is killed.
+func (s *Store) AutoSave(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.Save(); err != nil {
+				log.Printf("==> Stats: failed to save counters: %s", err)
+			}
+		}
+	}()
+}
+
+// GetClientName - get client name from user agent, first product
+// of user agent is used, e.g. "npm/5.6.0 node/v8.9.4" is "npm".
+func GetClientName(userAgent string) string {
+	fieldList := strings.Fields(userAgent)
+	if len(fieldList) == 0 {
+		return "unknown"
+	}
+
+	return strings.ToLower(strings.SplitN(fieldList[0], "/", 2)[0])
+}
+
+//
+// Private API
+//
+
+func getCounterKey(c *Counter) counterKey {
+	return counterKey{
+		Day:     c.Day,
+		Kind:    c.Kind,
+		Package: c.Package,
+		Version: c.Version,
+		Client:  c.Client,
+	}
+}
+
+func getCounter(key counterKey, downloads int) Counter {
+	return Counter{
+		Day:       key.Day,
+		Kind:      key.Kind,
+		Package:   key.Package,
+		Version:   key.Version,
+		Client:    key.Client,
+		Downloads: downloads,
+	}
+}
+
+// counters are stored in map, so order is stabilized
+func sortCounterList(list []Counter) {
+	sort.Slice(list, func(i, j int) bool {
+		a := getCounterKey(&list[i])
+		b := getCounterKey(&list[j])
+
+		switch {
+		case a.Day != b.Day:
+			return a.Day < b.Day
+		case a.Kind != b.Kind:
+			return a.Kind < b.Kind
+		case a.Package != b.Package:
+			return a.Package < b.Package
+		case a.Version != b.Version:
+			return a.Version < b.Version
+		}
+
+		return a.Client < b.Client
+	})
+}
@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewStore_Disabled(t *testing.T) {
+	s, err := NewStore("", 30)
+
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+}
+
+func TestStore_Query(t *testing.T) {
+	dir := createTestStoreDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+
+	s.Add(today, "npm", "uuid-auth", "abc", "npm/5.6.0 node/v8.9.4 linux x64")
+	s.Add(today, "npm", "uuid-auth", "abc", "npm/5.7.1 node/v9.4.0 darwin x64")
+	s.Add(today, "npm", "uuid-auth", "abc", "yarn/1.3.2 npm/? node/v8.9.4 linux x64")
+	s.Add(yesterday, "npm", "uuid-auth", "def", "npm/5.6.0 node/v8.9.4 linux x64")
+	s.Add(today, "composer", "uuid-auth", "abc", "Composer/1.6.3 (Linux; 4.9.0; PHP 7.1.14)")
+
+	list := s.Query("npm", "uuid-auth", yesterday, today)
+	assert.Len(t, list, 3)
+	assert.Equal(t, "def", list[0].Version)
+	assert.Equal(t, "npm", list[1].Client)
+	assert.Equal(t, 2, list[1].Downloads)
+	assert.Equal(t, "yarn", list[2].Client)
+
+	list = s.Query("npm", "uuid-auth", today, today)
+	assert.Len(t, list, 2)
+
+	list = s.Query("composer", "uuid-auth", today, today)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "composer", list[0].Client)
+}
+
+func TestStore_Save(t *testing.T) {
+	dir := createTestStoreDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now()
+	expired := today.AddDate(0, 0, -31)
+
+	s.Add(today, "npm", "uuid-auth", "abc", "npm/5.6.0")
+	s.Add(expired, "npm", "uuid-auth", "abc", "npm/5.6.0")
+	assert.Nil(t, s.Save())
+
+	s, err = NewStore(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := s.Query("npm", "uuid-auth", expired, today)
+	assert.Len(t, list, 1)
+	assert.Equal(t, 1, list[0].Downloads)
+}
+
+func TestGetClientName(t *testing.T) {
+	assert.Equal(t, "npm", GetClientName("npm/5.6.0 node/v8.9.4 linux x64"))
+	assert.Equal(t, "composer", GetClientName("Composer/1.6.3 (Linux; 4.9.0; PHP 7.1.14)"))
+	assert.Equal(t, "pip", GetClientName("pip/9.0.1 {\"python\": \"3.6.4\"}"))
+	assert.Equal(t, "unknown", GetClientName(""))
+}
+
+func createTestStoreDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pavlik-stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
@@ -0,0 +1,251 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Token - token issued by Pavlik, only hash of token value is stored
+	Token struct {
+		ID       string    `json:"id"`
+		Name     string    `json:"name"`
+		Hash     string    `json:"hash,omitempty"`
+		KindList []string  `json:"kinds"`    // empty list allows any kind
+		UUIDList []string  `json:"packages"` // empty list allows any package
+		Created  time.Time `json:"created"`
+		Expires  time.Time `json:"expires"` // zero time never expires
+		Revoked  bool      `json:"revoked"`
+	}
+
+	// Store - issued tokens persisted as json file
+	Store struct {
+		path      string
+		lock      *sync.RWMutex
+		tokenList []*Token
+	}
+)
+
+var (
+	// ErrTokenInvalid - token is unknown or malformed
+	ErrTokenInvalid = errors.New("Invalid token")
+
+	// ErrTokenExpired - token is expired or revoked
+	ErrTokenExpired = errors.New("Token expired or revoked")
+
+	// ErrTokenNotFound - no token with such id
+	ErrTokenNotFound = errors.New("Token not found")
+
+	// ErrTokenNameRequired - token should be named after its owner
+	ErrTokenNameRequired = errors.New("Token name is required")
+
+	tokenPrefix = "pvk_"
+	storeFile   = "tokens.json"
+)
+
+// IsIssuedToken - check token is issued by Pavlik, not by GitLab
+func IsIssuedToken(value string) bool {
+	return strings.HasPrefix(value, tokenPrefix)
+}
+
+// NewStore - load token store from data directory,
+// store is disabled (nil) when directory is not provided.
+func NewStore(dataDir string) (*Store, error) {
+	if dataDir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:      filepath.Join(dataDir, storeFile),
+		lock:      new(sync.RWMutex),
+		tokenList: make([]*Token, 0),
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.tokenList); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Issue - create new token, token value is returned only once
+func (s *Store) Issue(name string, kindList, uuidList []string, ttl time.Duration) (string, *Token, error) {
+	if name == "" {
+		return "", nil, ErrTokenNameRequired
+	}
+
+	id, err := getRandomHex(8)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := getRandomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	value := tokenPrefix + secret
+	t := &Token{
+		ID:       id,
+		Name:     name,
+		Hash:     getTokenHash(value),
+		KindList: kindList,
+		UUIDList: uuidList,
+		Created:  time.Now().UTC(),
+	}
+
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tokenList = append(s.tokenList, t)
+	if err := s.save(); err != nil {
+		s.tokenList = s.tokenList[:len(s.tokenList)-1]
+		return "", nil, err
+	}
+
+	return value, t, nil
+}
+
+// Verify - find token by value, token should not be expired or revoked
+func (s *Store) Verify(value string) (*Token, error) {
+	if !IsIssuedToken(value) {
+		return nil, ErrTokenInvalid
+	}
+
+	hash := []byte(getTokenHash(value))
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, t := range s.tokenList {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) != 1 {
+			continue
+		}
+
+		if t.IsExpired() {
+			return nil, ErrTokenExpired
+		}
+
+		verified := *t
+		return &verified, nil
+	}
+
+	return nil, ErrTokenInvalid
+}
+
+// Revoke - revoke token by id, revoked tokens are kept for history
+func (s *Store) Revoke(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, t := range s.tokenList {
+		if t.ID == id {
+			t.Revoked = true
+			return s.save()
+		}
+	}
+
+	return ErrTokenNotFound
+}
+
+// List - get all issued tokens without hashes, newest first
+func (s *Store) List() []Token {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	list := make([]Token, 0)
+	for i := len(s.tokenList) - 1; i >= 0; i-- {
+		t := *s.tokenList[i]
+		t.Hash = ""
+		list = append(list, t)
+	}
+
+	return list
+}
+
+// IsExpired - check token is expired or revoked
+func (t Token) IsExpired() bool {
+	return t.Revoked || (!t.Expires.IsZero() && t.Expires.Before(time.Now()))
+}
+
+// Allows - check token scope allows package of kind
+func (t Token) Allows(kind, uuid string) bool {
+	return isAllowed(t.KindList, kind) && isAllowed(t.UUIDList, uuid)
+}
+
+//
+// Private API
+//
+
+// write tokens to temporary file and replace store,
+// store is never left half-written
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.tokenList, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// empty list allows anything
+func isAllowed(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokens are random, so plain sha256 is enough
+func getTokenHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// hex encoded random bytes
+func getRandomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,124 @@
+package tokens
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewStore_Disabled(t *testing.T) {
+	s, err := NewStore("")
+
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+}
+
+func TestStore_IssueVerify(t *testing.T) {
+	dataDir := createTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, token, err := s.Issue("build-farm", []string{"npm"}, []string{"uuid-1"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, IsIssuedToken(value))
+	assert.Equal(t, "build-farm", token.Name)
+	assert.True(t, token.Expires.IsZero())
+
+	// token value is never stored
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, strings.Contains(string(data), value))
+
+	// store is persisted
+	s, err = NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := s.Verify(value)
+	assert.Nil(t, err)
+	assert.Equal(t, token.ID, verified.ID)
+	assert.True(t, verified.Allows("npm", "uuid-1"))
+	assert.False(t, verified.Allows("npm", "uuid-2"))
+	assert.False(t, verified.Allows("composer", "uuid-1"))
+
+	_, err = s.Verify(value + "0")
+	assert.Equal(t, ErrTokenInvalid, err)
+
+	_, err = s.Verify("glpat-token")
+	assert.Equal(t, ErrTokenInvalid, err)
+}
+
+func TestStore_Expired(t *testing.T) {
+	dataDir := createTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, _, err := s.Issue("expired", nil, nil, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+	_, err = s.Verify(value)
+	assert.Equal(t, ErrTokenExpired, err)
+
+	_, _, err = s.Issue("", nil, nil, 0)
+	assert.Equal(t, ErrTokenNameRequired, err)
+}
+
+func TestStore_Revoke(t *testing.T) {
+	dataDir := createTestDataDir(t)
+	defer os.RemoveAll(dataDir)
+
+	s, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, token, err := s.Issue("contractor", nil, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := s.Verify(value)
+	assert.Nil(t, err)
+	assert.True(t, verified.Allows("composer", "any-uuid"))
+
+	assert.Nil(t, s.Revoke(token.ID))
+	assert.Equal(t, ErrTokenNotFound, s.Revoke("unknown"))
+
+	_, err = s.Verify(value)
+	assert.Equal(t, ErrTokenExpired, err)
+
+	// revoked tokens are kept
+	list := s.List()
+	assert.Len(t, list, 1)
+	assert.True(t, list[0].Revoked)
+}
+
+func createTestDataDir(t *testing.T) string {
+	dataDir, err := ioutil.TempDir("", "pavlik-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dataDir
+}
@@ -0,0 +1,57 @@
+package uplink
+
+import (
+	"comrade-pavlik2/pkg/helpers"
+	"context"
+	"regexp"
+	"strings"
+)
+
+type (
+	// ComposerUplink - public composer repository, e.g. https://repo.packagist.org
+	ComposerUplink struct {
+		*Uplink
+		privateVendorList []string // vendors never requested from public repository
+	}
+)
+
+var (
+	// vendor/package, optionally with ~dev suffix for dev versions
+	composerNameRegexp = regexp.MustCompile(`^[a-z0-9]([_.-]?[a-z0-9]+)*/[a-z0-9](([_.]|-{1,2})?[a-z0-9]+)*(~dev)?$`)
+)
+
+// NewComposerUplink - construct composer uplink, uplink is disabled (nil) when url is empty
+func NewComposerUplink(baseURL string) *ComposerUplink {
+	u := NewUplink(baseURL)
+	if u == nil {
+		return nil
+	}
+
+	return &ComposerUplink{
+		Uplink:            u,
+		privateVendorList: helpers.GetListFromEnv("PAVLIK_COMPOSER_PRIVATE_VENDORS"),
+	}
+}
+
+// GetPackageMetadata - get composer v2 metadata of a package (p2/vendor/package.json),
+// dist urls are kept as is, so archives are downloaded directly.
+// Packages of private vendors are never requested from public repository.
+func (u *ComposerUplink) GetPackageMetadata(ctx context.Context, name string) ([]byte, error) {
+	if !composerNameRegexp.MatchString(name) || u.isPrivateVendor(name) {
+		return nil, ErrUplinkNotFound
+	}
+
+	return u.getMetadata(ctx, "p2/"+name+".json")
+}
+
+// check package vendor is listed in PAVLIK_COMPOSER_PRIVATE_VENDORS
+func (u *ComposerUplink) isPrivateVendor(name string) bool {
+	vendor := strings.SplitN(name, "/", 2)[0]
+	for _, privateVendor := range u.privateVendorList {
+		if strings.EqualFold(privateVendor, vendor) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package uplink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type (
+	// NpmUplink - public npm registry, e.g. https://registry.npmjs.org
+	NpmUplink struct {
+		*Uplink
+	}
+)
+
+// NewNpmUplink - construct npm uplink, uplink is disabled (nil) when url is empty
+func NewNpmUplink(baseURL string) *NpmUplink {
+	u := NewUplink(baseURL)
+	if u == nil {
+		return nil
+	}
+
+	return &NpmUplink{u}
+}
+
+// GetPackage - get package document, tarball urls pointing to public registry
+// are rewritten to endpoint, so archives are downloaded through Pavlik.
+// Scoped packages are private, they are never requested from public registry,
+// otherwise missing or denied private package would be replaced by public one.
+func (u *NpmUplink) GetPackage(ctx context.Context, name string, endpoint string) ([]byte, error) {
+	if !isValidPath(name) || strings.HasPrefix(name, "@") {
+		return nil, ErrUplinkNotFound
+	}
+
+	data, err := u.getMetadata(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := make(map[string]interface{}, 0)
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	versionMap, _ := pkg["versions"].(map[string]interface{})
+	for _, version := range versionMap {
+		versionInfo, _ := version.(map[string]interface{})
+		dist, _ := versionInfo["dist"].(map[string]interface{})
+		tarball, _ := dist["tarball"].(string)
+
+		if path := strings.TrimPrefix(tarball, u.baseURL+"/"); path != tarball {
+			dist["tarball"] = fmt.Sprintf(endpoint, path)
+		}
+	}
+
+	return json.Marshal(pkg)
+}
+
+// GetTarball - get package archive by path relative to public registry,
+// e.g. "@babel/core/-/core-7.0.0.tgz"
+func (u *NpmUplink) GetTarball(ctx context.Context, path string) ([]byte, error) {
+	if !isValidPath(path) || strings.HasPrefix(path, "@") || !strings.Contains(path, "/-/") || !strings.HasSuffix(path, ".tgz") {
+		return nil, ErrUplinkNotFound
+	}
+
+	return u.getArchive(ctx, path)
+}
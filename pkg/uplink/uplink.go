@@ -0,0 +1,173 @@
+package uplink
+
+// Proxying of public registries for packages not served by GitLab
+
+import (
+	"comrade-pavlik2/pkg/helpers"
+	"comrade-pavlik2/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/golang-lru"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// Uplink - public registry, metadata is cached for a short time and served
+	// stale when registry is not available, archives are cached until evicted.
+	Uplink struct {
+		baseURL     string
+		client      *http.Client
+		metadataTTL time.Duration
+		cache       *lru.Cache
+		flight      *helpers.FlightGroup
+	}
+
+	// cached metadata document
+	cachedMetadata struct {
+		expire time.Time
+		data   []byte
+	}
+)
+
+var (
+	// ErrUplinkNotFound - package or archive doesn't exist in public registry
+	ErrUplinkNotFound = errors.New("Package not found in uplink")
+)
+
+// NewUplink - construct uplink to public registry, uplink is disabled (nil) when url is empty
+func NewUplink(baseURL string) *Uplink {
+	if baseURL == "" {
+		return nil
+	}
+
+	size := helpers.GetIntFromEnv("PAVLIK_UPLINK_CACHE_SIZE", 512)
+	if size == 0 {
+		size = 1
+	}
+
+	cache, _ := lru.New(size)
+	return &Uplink{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		client:      &http.Client{},
+		metadataTTL: helpers.GetDurationFromEnv("PAVLIK_UPLINK_TTL", 5*time.Minute),
+		cache:       cache,
+		flight:      helpers.NewFlightGroup(),
+	}
+}
+
+//
+// Private API
+//
+
+// get metadata document, stale document is returned when registry fails
+func (u *Uplink) getMetadata(ctx context.Context, path string) ([]byte, error) {
+	cacheKey := "metadata_" + path
+
+	var cached *cachedMetadata
+	if item, ok := u.cache.Get(cacheKey); ok {
+		cached, _ = item.(*cachedMetadata)
+	}
+
+	if cached != nil && time.Now().Before(cached.expire) {
+		metrics.CacheHit("uplink")
+		return cached.data, nil
+	}
+	metrics.CacheMiss("uplink")
+
+	value, err := u.flight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		data, err := u.fetch(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		u.cacheAdd(cacheKey, &cachedMetadata{
+			expire: time.Now().Add(u.metadataTTL),
+			data:   data,
+		})
+
+		return data, nil
+	})
+
+	if err != nil && err != ErrUplinkNotFound && cached != nil && ctx.Err() == nil {
+		log.Printf("==> Notice: uplink %s failed, serving stale metadata %s: %s", helpers.RedactURL(u.baseURL), path, err)
+		return cached.data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// get archive, archives are immutable, so they are never refreshed
+func (u *Uplink) getArchive(ctx context.Context, path string) ([]byte, error) {
+	cacheKey := "archive_" + path
+
+	if item, ok := u.cache.Get(cacheKey); ok {
+		if data, ok := item.([]byte); ok {
+			log.Printf("Cache hit: uplink %s", path)
+			metrics.CacheHit("uplink")
+			return data, nil
+		}
+	}
+
+	log.Printf("Cache miss: uplink %s", path)
+	metrics.CacheMiss("uplink")
+
+	value, err := u.flight.Do(ctx, cacheKey, func(ctx context.Context) (interface{}, error) {
+		data, err := u.fetch(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		u.cacheAdd(cacheKey, data)
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// request public registry
+func (u *Uplink) fetch(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u.baseURL+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrUplinkNotFound
+
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Uplink %s responded with: %s", u.baseURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// put item into uplink cache, keeping track of evictions
+func (u *Uplink) cacheAdd(key string, value interface{}) {
+	if evicted := u.cache.Add(key, value); evicted {
+		metrics.CacheEvictionsTotal.Inc("uplink")
+	}
+}
+
+// path parts provided by client should never leave registry
+func isValidPath(path string) bool {
+	return path != "" && !strings.Contains(path, "..") && !strings.HasPrefix(path, "/") && !strings.Contains(path, "://")
+}
@@ -0,0 +1,149 @@
+package uplink
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewUplink_Disabled(t *testing.T) {
+	assert.Nil(t, NewNpmUplink(""))
+	assert.Nil(t, NewComposerUplink(""))
+}
+
+func TestNpmUplink_GetPackage(t *testing.T) {
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/lodash" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"name":"lodash","versions":{"4.17.21":{"dist":{"tarball":"` +
+			upstream.URL + `/lodash/-/lodash-4.17.21.tgz","shasum":"abc"}}}}`))
+	}))
+	defer upstream.Close()
+
+	u := NewNpmUplink(upstream.URL + "/")
+	data, err := u.GetPackage(context.Background(), "lodash", "https://packages.example.com/uplink/npm/%s")
+	assert.Nil(t, err)
+
+	pkg := make(map[string]interface{}, 0)
+	assert.Nil(t, json.Unmarshal(data, &pkg))
+
+	dist := pkg["versions"].(map[string]interface{})["4.17.21"].(map[string]interface{})["dist"].(map[string]interface{})
+	assert.Equal(t, "https://packages.example.com/uplink/npm/lodash/-/lodash-4.17.21.tgz", dist["tarball"])
+	assert.Equal(t, "abc", dist["shasum"])
+
+	_, err = u.GetPackage(context.Background(), "left-pad", "%s")
+	assert.Equal(t, ErrUplinkNotFound, err)
+}
+
+func TestNpmUplink_GetPackage_Scoped(t *testing.T) {
+	requestCount := int32(0)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.Write([]byte(`{"name":"@acme/secret","versions":{}}`))
+	}))
+	defer upstream.Close()
+
+	u := NewNpmUplink(upstream.URL)
+
+	// missing private package is never replaced by public one
+	_, err := u.GetPackage(context.Background(), "@acme/secret", "%s")
+	assert.Equal(t, ErrUplinkNotFound, err)
+
+	_, err = u.GetTarball(context.Background(), "@acme/secret/-/secret-1.0.0.tgz")
+	assert.Equal(t, ErrUplinkNotFound, err)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requestCount))
+}
+
+func TestNpmUplink_GetTarball(t *testing.T) {
+	requestCount := int32(0)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.Write([]byte("tarball"))
+	}))
+	defer upstream.Close()
+
+	u := NewNpmUplink(upstream.URL)
+	for i := 0; i < 2; i++ {
+		data, err := u.GetTarball(context.Background(), "lodash/-/lodash-4.17.21.tgz")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("tarball"), data)
+	}
+
+	// archives are cached forever
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requestCount))
+
+	_, err := u.GetTarball(context.Background(), "lodash/-/../../etc/passwd.tgz")
+	assert.Equal(t, ErrUplinkNotFound, err)
+
+	_, err = u.GetTarball(context.Background(), "lodash")
+	assert.Equal(t, ErrUplinkNotFound, err)
+}
+
+func TestComposerUplink_GetPackageMetadata_Stale(t *testing.T) {
+	available := int32(1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		assert.Equal(t, "/p2/monolog/monolog.json", r.URL.Path)
+		w.Write([]byte(`{"packages":{}}`))
+	}))
+	defer upstream.Close()
+
+	u := NewComposerUplink(upstream.URL)
+	u.metadataTTL = time.Nanosecond
+
+	data, err := u.GetPackageMetadata(context.Background(), "monolog/monolog")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"packages":{}}`), data)
+
+	// registry is down, stale metadata is served
+	atomic.StoreInt32(&available, 0)
+	time.Sleep(time.Millisecond)
+
+	data, err = u.GetPackageMetadata(context.Background(), "monolog/monolog")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"packages":{}}`), data)
+
+	// nothing cached, error is returned
+	_, err = u.GetPackageMetadata(context.Background(), "psr/log")
+	assert.NotNil(t, err)
+
+	_, err = u.GetPackageMetadata(context.Background(), "../monolog")
+	assert.Equal(t, ErrUplinkNotFound, err)
+}
+
+func TestComposerUplink_GetPackageMetadata_PrivateVendor(t *testing.T) {
+	requestCount := int32(0)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requestCount, 1)
+		w.Write([]byte(`{"packages":{}}`))
+	}))
+	defer upstream.Close()
+
+	u := NewComposerUplink(upstream.URL)
+	u.privateVendorList = []string{"Acme"}
+
+	_, err := u.GetPackageMetadata(context.Background(), "acme/secret")
+	assert.Equal(t, ErrUplinkNotFound, err)
+
+	_, err = u.GetPackageMetadata(context.Background(), "acme/secret~dev")
+	assert.Equal(t, ErrUplinkNotFound, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requestCount))
+
+	_, err = u.GetPackageMetadata(context.Background(), "acme-labs/client")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requestCount))
+}